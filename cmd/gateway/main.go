@@ -1,21 +1,70 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 
 	"latent-journey/pkg/api"
 )
 
-// CORS middleware
-func corsMiddleware(next http.Handler) http.Handler {
+// sseSelfCheckTimeout is how long /healthz waits for the SSE hub's
+// self-check probe to be delivered.
+const sseSelfCheckTimeout = time.Second
+
+// CORS middleware. The allow lists are read from config for each request,
+// so a reload applies to the next one.
+func corsMiddleware(mux *http.ServeMux, config func() api.Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Cache-Control")
+		cfg := config()
+
+		// Headers the gateway itself reads are always allowed
+		headers := append([]string{}, cfg.CORSAllowedHeaders...)
+		for _, required := range api.RequiredHeaders {
+			if !containsFold(headers, required) {
+				headers = append(headers, required)
+			}
+		}
+		allowedHeaders := strings.Join(headers, ", ")
+		anyOrigin := slices.Contains(cfg.CORSAllowedOrigins, "*")
+
+		// Narrow the configured methods to the ones the matched route accepts
+		methods := cfg.CORSAllowedMethods
+		if _, pattern := mux.Handler(r); pattern != "" {
+			if routeMethods := api.AllowedMethods(pattern); routeMethods != nil {
+				methods = nil
+				for _, method := range routeMethods {
+					if containsFold(cfg.CORSAllowedMethods, method) {
+						methods = append(methods, method)
+					}
+				}
+			}
+		}
+
+		// Set CORS headers. A listed origin is echoed back, so the answer
+		// depends on it; unlisted origins get no Allow-Origin at all.
+		if anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); origin != "" && slices.Contains(cfg.CORSAllowedOrigins, origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				if cfg.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
 		w.Header().Set("Access-Control-Max-Age", "86400")
 
 		// Handle preflight requests
@@ -24,16 +73,97 @@ func corsMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		mux.ServeHTTP(w, r)
 	})
 }
 
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// newServer returns a server for handler on addr with the configured
+// timeouts and header limit.
+func newServer(addr string, handler http.Handler, cfg api.Config) *http.Server {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	if cfg.H2C {
+		// Accept cleartext HTTP/2 alongside HTTP/1.1 for deployments without
+		// TLS termination in front of the gateway.
+		var protocols http.Protocols
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		server.Protocols = &protocols
+	}
+	return server
+}
+
+// root answers "/" with a greeting; any other unmatched path, such as a
+// mistyped /api route, gets a JSON 404.
+func root(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		api.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprint(w, "I am Gateway")
+}
+
+// healthz reports the gateway's health, including a self-check that the
+// SSE hub still delivers events within timeout. HEAD runs the same checks
+// without the body.
+func healthz(hub *api.SSEHub, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, code := "healthy", http.StatusOK
+		sse := map[string]any{"ok": true}
+		latency, err := hub.SelfCheck(timeout)
+		if err != nil {
+			status, code = "unhealthy", http.StatusServiceUnavailable
+			sse = map[string]any{"ok": false, "error": err.Error()}
+		} else {
+			sse["latency_ms"] = float64(latency.Microseconds()) / 1000
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":    status,
+			"service":   "gateway",
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"sse":       sse,
+		})
+	}
+}
+
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := api.SetupTracing(context.Background())
+	if err != nil {
+		log.Fatalf("tracing setup failed: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	mux := http.NewServeMux()
 
+	cfg := api.LoadConfig()
+	gateway := api.NewGateway(cfg)
+
 	// Register API routes
 	fmt.Println("Registering API routes...")
-	api.RegisterRoutes(mux)
+	gateway.RegisterRoutes(mux)
 	fmt.Println("API routes registered")
 
 	// Keep ping endpoint for health checks
@@ -43,17 +173,66 @@ func main() {
 		fmt.Fprintf(w, `{"message": "I am Gateway", "service": "gateway", "status": "running"}`)
 	})
 
-	// Health check endpoint
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status": "healthy", "service": "gateway", "timestamp": "%s"}`, time.Now().Format(time.RFC3339))
-	})
+	mux.HandleFunc("/healthz", api.WithHead(healthz(gateway.Hub(), sseSelfCheckTimeout)))
 
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain")
-	})
+	mux.HandleFunc("/", root)
+
+	server := newServer(":8080", gateway.LimitInFlight(corsMiddleware(mux, gateway.Config)), cfg)
 
 	fmt.Println("Gateway service starting on :8080")
-	log.Fatal(http.ListenAndServe(":8080", corsMiddleware(mux)))
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// Admin endpoints get their own listener, kept off the public API
+	var adminServer *http.Server
+	if cfg.AdminAddr != "" {
+		adminMux := http.NewServeMux()
+		gateway.RegisterAdminRoutes(adminMux)
+		adminMux.HandleFunc("/", api.NotFound)
+		adminServer = newServer(cfg.AdminAddr, adminMux, cfg)
+
+		fmt.Printf("Admin endpoints listening on %s\n", cfg.AdminAddr)
+		go func() {
+			if err := adminServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	// SIGHUP reloads the settings that can change while running, such as
+	// timeouts and allow lists, from the environment and CONFIG_FILE.
+	// Open connections are left alone.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			gateway.Reload(api.LoadConfig())
+		}
+	}()
+
+	<-ctx.Done()
+	fmt.Println("Gateway shutting down")
+
+	// SSE connections never finish on their own, so they are cut once
+	// in-flight requests have had their chance to complete
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			adminServer.Close()
+		}
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := gateway.Close(flushCtx); err != nil {
+		log.Printf("gateway close: %v", err)
+	}
 }
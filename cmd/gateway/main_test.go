@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"latent-journey/pkg/api"
+)
+
+// newTestMux returns a mux with the gateway's routes for cfg. The gateway is
+// closed right away, which stops its status monitor; the routes keep
+// working.
+func newTestMux(t *testing.T, cfg api.Config) (*http.ServeMux, *api.Gateway) {
+	t.Helper()
+	gateway := api.NewGateway(cfg)
+	mux := http.NewServeMux()
+	gateway.RegisterRoutes(mux)
+	gateway.Close(context.Background())
+	return mux, gateway
+}
+
+func preflight(t *testing.T, h http.Handler, path string) http.Header {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodOptions, path, nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("preflight %s: status %d, want 200", path, rec.Code)
+	}
+	return rec.Header()
+}
+
+func TestCORSAllowsConfiguredAndRequiredHeaders(t *testing.T) {
+	mux, gateway := newTestMux(t, api.Config{CORSAllowedHeaders: []string{"Content-Type", "Idempotency-Key"}})
+	header := preflight(t, corsMiddleware(mux, gateway.Config), "/api/embeddings/add")
+
+	allowed := strings.Split(header.Get("Access-Control-Allow-Headers"), ", ")
+	for _, want := range append([]string{"Idempotency-Key"}, api.RequiredHeaders...) {
+		if !containsFold(allowed, want) {
+			t.Errorf("Access-Control-Allow-Headers %q lacks %s", header.Get("Access-Control-Allow-Headers"), want)
+		}
+	}
+}
+
+func TestCORSPreflightNarrowsMethodsToRoute(t *testing.T) {
+	mux, gateway := newTestMux(t, api.Config{})
+	cors := corsMiddleware(mux, gateway.Config)
+
+	for path, want := range map[string]string{
+		"/api/embeddings/add": "POST, OPTIONS",
+		"/api/embeddings":     "GET, OPTIONS",
+	} {
+		if got := preflight(t, cors, path).Get("Access-Control-Allow-Methods"); got != want {
+			t.Errorf("%s: Access-Control-Allow-Methods %q, want %q", path, got, want)
+		}
+	}
+}
+
+// serveConfigured starts a test server for h configured as newServer would
+// for cfg.
+func serveConfigured(t *testing.T, h http.Handler, cfg api.Config) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(h)
+	srv.Config = newServer("", h, cfg)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// serveH2C starts a test server for h configured as newServer would for
+// cfg, and returns it with a client that speaks only cleartext HTTP/2.
+func serveH2C(t *testing.T, h http.Handler, cfg api.Config) (*httptest.Server, *http.Client) {
+	t.Helper()
+	srv := serveConfigured(t, h, cfg)
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return srv, &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+}
+
+func TestH2CRequest(t *testing.T) {
+	mux, _ := newTestMux(t, api.Config{H2C: true})
+	srv, client := serveH2C(t, mux, api.Config{H2C: true})
+
+	resp, err := client.Get(srv.URL + "/api/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Errorf("got %s status %d, want HTTP/2 200", resp.Proto, resp.StatusCode)
+	}
+}
+
+func TestH2CStreamsEvents(t *testing.T) {
+	mux, gateway := newTestMux(t, api.Config{H2C: true})
+	srv, client := serveH2C(t, mux, api.Config{H2C: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("stream served over %s, want HTTP/2", resp.Proto)
+	}
+
+	lines := make(chan string, 16)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+				lines <- data
+			}
+		}
+	}()
+	next := func() string {
+		t.Helper()
+		select {
+		case data := <-lines:
+			return data
+		case <-time.After(2 * time.Second):
+			t.Fatal("event not flushed to the HTTP/2 stream")
+			return ""
+		}
+	}
+
+	if data := next(); !strings.Contains(data, `"type":"connection"`) {
+		t.Fatalf("first event %s, want the connection event", data)
+	}
+	gateway.Hub().Broadcast(`{"type":"marker"}`)
+	if data := next(); !strings.Contains(data, `"type":"marker"`) {
+		t.Errorf("got %s, want the broadcast marker", data)
+	}
+}
+
+func TestUnknownAPIPathIsJSON404(t *testing.T) {
+	mux, _ := newTestMux(t, api.Config{})
+	mux.HandleFunc("/", root)
+
+	for _, path := range []string{"/api/embedings", "/api/vision/frames", "/nope"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: status %d, Content-Type %q, want a JSON 404", path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error.Code != "not_found" || !strings.Contains(body.Error.Message, path) {
+			t.Errorf("%s: body %s, want a not_found error naming the path", path, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "I am Gateway" {
+		t.Errorf("/: status %d %q, want the greeting", rec.Code, rec.Body)
+	}
+}
+
+func TestSlowHeadersAreTimedOut(t *testing.T) {
+	cfg := api.Config{ReadHeaderTimeout: 200 * time.Millisecond}
+	mux, _ := newTestMux(t, cfg)
+	srv := serveConfigured(t, mux, cfg)
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// A slow-loris client trickles its headers and never finishes them
+	fmt.Fprint(conn, "GET /api/config HTTP/1.1\r\nHost: gateway\r\n")
+	go func() {
+		for {
+			time.Sleep(50 * time.Millisecond)
+			if _, err := fmt.Fprint(conn, "X-Slow: 1\r\n"); err != nil {
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	// The server hangs up, possibly resetting the connection mid-trickle
+	if _, err := io.ReadAll(conn); errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("connection still open after the header timeout")
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("connection ended after %s, before the header timeout", elapsed)
+	}
+}
+
+func TestOversizedHeadersAreRejected(t *testing.T) {
+	cfg := api.Config{MaxHeaderBytes: 4 << 10}
+	mux, _ := newTestMux(t, cfg)
+	srv := serveConfigured(t, mux, cfg)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/config", nil)
+	req.Header.Set("X-Padding", strings.Repeat("x", 64<<10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("status %d, want 431", resp.StatusCode)
+	}
+}
+
+func TestEventStreamOutlivesWriteTimeout(t *testing.T) {
+	cfg := api.Config{WriteTimeout: 200 * time.Millisecond}
+	mux, gateway := newTestMux(t, cfg)
+	srv := serveConfigured(t, mux, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string, 16)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+				lines <- data
+			}
+		}
+	}()
+	<-lines
+
+	// Well past the server's write timeout, the stream still delivers
+	time.Sleep(500 * time.Millisecond)
+	gateway.Hub().Broadcast(`{"type":"marker"}`)
+	select {
+	case data, ok := <-lines:
+		if !ok || !strings.Contains(data, `"type":"marker"`) {
+			t.Errorf("got %q (open %t), want the marker", data, ok)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream stopped delivering after the write timeout")
+	}
+}
+
+func TestHealthzReportsSSESelfCheck(t *testing.T) {
+	_, gateway := newTestMux(t, api.Config{})
+	rec := httptest.NewRecorder()
+	healthz(gateway.Hub(), time.Second)(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var health struct {
+		Status string `json:"status"`
+		SSE    struct {
+			OK        bool     `json:"ok"`
+			LatencyMS *float64 `json:"latency_ms"`
+		} `json:"sse"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	if health.Status != "healthy" || !health.SSE.OK || health.SSE.LatencyMS == nil {
+		t.Errorf("health %s, want healthy with an ok SSE check and its latency", rec.Body)
+	}
+}
+
+func TestHealthzHeadSetsHeadersWithoutBody(t *testing.T) {
+	_, gateway := newTestMux(t, api.Config{})
+	h := api.WithHead(healthz(gateway.Hub(), time.Second))
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodHead, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("HEAD wrote a body: %q", rec.Body)
+	}
+	if rec.Header().Get("Content-Type") != "application/json" || rec.Header().Get("Content-Length") == "" {
+		t.Errorf("headers %v, want Content-Type and Content-Length", rec.Header())
+	}
+}
+
+func TestCORSCredentialedPreflight(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		wantOrigin  string
+		wantCreds   string
+	}{
+		{"listed origin", []string{"http://localhost:3000"}, true, "http://localhost:3000", "true"},
+		{"credentials off", []string{"http://localhost:3000"}, false, "http://localhost:3000", ""},
+		{"unlisted origin", []string{"https://app.example.com"}, true, "", ""},
+		// LoadConfig refuses this combination; the middleware never sends
+		// credentials with a wildcard either
+		{"wildcard", []string{"*"}, true, "*", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux, gateway := newTestMux(t, api.Config{CORSAllowedOrigins: tt.origins, AllowCredentials: tt.credentials})
+			header := preflight(t, corsMiddleware(mux, gateway.Config), "/api/embeddings/add")
+
+			if got := header.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin %q, want %q", got, tt.wantOrigin)
+			}
+			if got := header.Get("Access-Control-Allow-Credentials"); got != tt.wantCreds {
+				t.Errorf("Access-Control-Allow-Credentials %q, want %q", got, tt.wantCreds)
+			}
+			if tt.wantOrigin != "*" && header.Get("Vary") != "Origin" {
+				t.Errorf("Vary %q, want Origin for an echoed origin", header.Get("Vary"))
+			}
+		})
+	}
+}
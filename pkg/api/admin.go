@@ -0,0 +1,221 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const drainRetryAfter = "30"
+
+// requireAPIKey guards admin endpoints. The key is accepted as a bearer
+// token or an X-API-Key header; without a configured key the endpoints are
+// disabled.
+func (g *Gateway) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return requireKey(next, g.config().APIKey, "API_KEY")
+}
+
+// requireAdminToken guards the admin endpoints on the separate admin
+// listener, which has its own token so the public API key cannot reach it.
+func (g *Gateway) requireAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return requireKey(next, g.config().AdminToken, "ADMIN_TOKEN")
+}
+
+// requireKey accepts requests carrying secret as a bearer token or an
+// X-API-Key header. An empty secret disables the endpoint; envName names
+// the setting that enables it.
+func requireKey(next http.HandlerFunc, secret, envName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if secret == "" {
+			http.Error(w, "admin endpoints disabled: "+envName+" is not set", http.StatusForbidden)
+			return
+		}
+
+		key := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(key), []byte(secret)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// RegisterAdminRoutes registers the admin endpoints on mux, guarded by the
+// admin token. It is used for the admin listener when ADMIN_ADDR is set;
+// otherwise RegisterRoutes puts them on the public mux behind the API key.
+func (g *Gateway) RegisterAdminRoutes(mux *http.ServeMux) {
+	g.registerAdminRoutes(mux, g.requireAdminToken)
+}
+
+func (g *Gateway) registerAdminRoutes(mux *http.ServeMux, guard func(http.HandlerFunc) http.HandlerFunc) {
+	handle(mux, "/api/admin/drain", guard(g.postAdminDrain), http.MethodPost)
+	handle(mux, "/api/admin/undrain", guard(g.postAdminUndrain), http.MethodPost)
+	handle(mux, "/api/admin/reset", guard(g.postAdminReset), http.MethodPost)
+	handle(mux, "/api/admin/broadcast/pause", guard(g.postAdminBroadcastPause), http.MethodPost)
+	handle(mux, "/api/admin/broadcast/resume", guard(g.postAdminBroadcastResume), http.MethodPost)
+	handle(mux, "/api/admin/clients", guard(g.getAdminClients), http.MethodGet)
+	handle(mux, "/api/admin/config/sources", guard(g.getAdminConfigSources), http.MethodGet)
+	handle(mux, "/api/admin/events/replay", guard(g.getAdminEventReplay), http.MethodGet)
+}
+
+// rejectWhenDraining refuses new work with a 503 while the gateway drains.
+func (g *Gateway) rejectWhenDraining(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if g.draining.Load() {
+			w.Header().Set("Retry-After", drainRetryAfter)
+			http.Error(w, "gateway is draining", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// rejectWhenSaturated refuses ingestion up front with a 503 when a service
+// the handler depends on is known to be unable to take the work, so large
+// bodies are not read only to fail deeper in the pipeline. ?force skips the
+// check like it skips the offline fast path, and dry runs never reach the
+// services at all.
+func (g *Gateway) rejectWhenSaturated(next http.HandlerFunc, services ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isForced(r.Context()) && !isDryRun(r) {
+			for _, service := range services {
+				if g.saturated(service) {
+					w.Header().Set("Retry-After", offlineRetryAfter)
+					writeJSONError(w, http.StatusServiceUnavailable, errorBody{Code: "service_unavailable", Message: service + " service is unavailable", Service: service})
+					return
+				}
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (g *Gateway) postAdminDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g.draining.Store(true)
+	fmt.Println("Gateway draining - refusing new SSE connections and ingestion")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status": "draining"}`))
+}
+
+func (g *Gateway) postAdminUndrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g.draining.Store(false)
+	fmt.Println("Gateway undrained - accepting new work")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status": "accepting"}`))
+}
+
+// postAdminReset clears the gateway's cached service statuses and vision
+// frame, closes the pipeline circuit and zeroes the SSE broadcast and
+// downstream failure counters, reporting the values that were cleared. A
+// circuit that was open is announced as recovered.
+func (g *Gateway) postAdminReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses := g.resetServiceStatus()
+	llmStatus := g.lastKnownLLMStatus.Swap("unknown")
+	broadcasts, dropped, queueDropped := g.hub.resetCounters()
+	frameCached := g.forgetFrame()
+	pipelineDegraded := g.pipeline.reset()
+	if pipelineDegraded {
+		g.broadcastPipelineState(false, pipelineState{})
+	}
+	failures := g.failures.reset()
+	fmt.Println("Gateway state reset by admin")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": "reset",
+		"cleared": map[string]any{
+			"service_statuses":    statuses,
+			"llm_status":          llmStatus,
+			"sse_broadcasts":      broadcasts,
+			"sse_dropped_events":  dropped,
+			"sse_queue_dropped":   queueDropped,
+			"vision_frame_cache":  frameCached,
+			"pipeline_degraded":   pipelineDegraded,
+			"downstream_failures": failures,
+		},
+	})
+}
+
+func (g *Gateway) postAdminBroadcastPause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	g.hub.Pause()
+	fmt.Println("SSE broadcasting paused by admin")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status": "paused"}`))
+}
+
+func (g *Gateway) postAdminBroadcastResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	replayed := g.hub.Resume()
+	fmt.Printf("SSE broadcasting resumed by admin, replayed %d events\n", replayed)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":   "resumed",
+		"replayed": replayed,
+	})
+}
+
+// getAdminClients lists the connected SSE clients for operators.
+func (g *Gateway) getAdminClients(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clients := g.hub.clientsSnapshot()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"count":   len(clients),
+		"clients": clients,
+	})
+}
+
+// getAdminConfigSources reports each setting's effective value and whether
+// it came from the environment, CONFIG_FILE or a default, by environment
+// variable, to tell why a deployment behaves the way it does. Secrets only
+// show whether they are set.
+func (g *Gateway) getAdminConfigSources(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sources := g.config().sources
+	if sources == nil {
+		sources = map[string]settingSource{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"count":    len(sources),
+		"settings": sources,
+	})
+}
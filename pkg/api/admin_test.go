@@ -0,0 +1,382 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAPIKey = "test-key"
+
+func TestDrainRejectsNewWorkButKeepsHealthAndOpenStreams(t *testing.T) {
+	g, srv := newTestGateway(t, Config{APIKey: testAPIKey})
+	open := openSSE(t, srv.URL+"/events", nil)
+	open.expect("connection")
+
+	if resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/admin/drain", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("drain without the API key: status %d, want 401", resp.StatusCode)
+	}
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/admin/drain", "", "X-API-Key", testAPIKey); resp.StatusCode != http.StatusOK {
+		t.Fatalf("drain: status %d, want 200: %s", resp.StatusCode, body)
+	}
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/events"},
+		{http.MethodPost, "/api/vision/frame"},
+		{http.MethodPost, "/api/speech/transcript"},
+		{http.MethodPost, "/api/embeddings/add"},
+	} {
+		resp, _ := doRequest(t, req.method, srv.URL+req.path, `{}`)
+		if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+			t.Errorf("%s %s while draining: status %d, Retry-After %q, want 503 with Retry-After",
+				req.method, req.path, resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+	}
+	if resp, _ := doRequest(t, http.MethodGet, srv.URL+"/readyz", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("/readyz while draining: status %d, want 200", resp.StatusCode)
+	}
+
+	// The stream opened before the drain keeps receiving events
+	g.hub.Broadcast(`{"type":"marker"}`)
+	open.expect("marker")
+
+	if resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/admin/undrain", "", "Authorization", "Bearer "+testAPIKey); resp.StatusCode != http.StatusOK {
+		t.Fatalf("undrain: status %d, want 200", resp.StatusCode)
+	}
+	openSSE(t, srv.URL+"/events", nil).expect("connection")
+}
+
+func TestAdminResetClearsCachesAndCounters(t *testing.T) {
+	g, srv := newTestGateway(t, Config{APIKey: testAPIKey, PipelineErrorThreshold: 0.5, PipelineMinRequests: 2})
+	stubPipeline(t, g, defaultPipeline())
+
+	g.setServiceStatus(serviceML, "offline")
+	g.setServiceStatus(serviceLLM, "online")
+	g.rememberFrame(sha256.Sum256([]byte("frame")), defaultCameraID, []scoredLabel{{"person", 0.9}})
+	g.hub.Broadcast(`{"type":"marker"}`)
+	g.countFailure(serviceML, outcomeUpstream5xx)
+	g.countFailure(serviceLLM, outcomeUpstream4xx)
+	cfg := g.config()
+	for range 2 {
+		g.pipeline.record(g.now(), true, cfg.PipelineErrorWindow, cfg.PipelineErrorThreshold, cfg.PipelineMinRequests)
+	}
+
+	if resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/admin/reset", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("reset without the API key: status %d, want 401", resp.StatusCode)
+	}
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/admin/reset", "", "X-API-Key", testAPIKey)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("reset: status %d, want 200: %s", resp.StatusCode, body)
+	}
+	var summary struct {
+		Cleared struct {
+			ServiceStatuses    int    `json:"service_statuses"`
+			SSEBroadcasts      uint64 `json:"sse_broadcasts"`
+			VisionFrameCache   bool   `json:"vision_frame_cache"`
+			PipelineDegraded   bool   `json:"pipeline_degraded"`
+			DownstreamFailures uint64 `json:"downstream_failures"`
+		} `json:"cleared"`
+	}
+	if err := json.Unmarshal([]byte(body), &summary); err != nil {
+		t.Fatal(err)
+	}
+	c := summary.Cleared
+	if c.ServiceStatuses != 2 || c.SSEBroadcasts == 0 || !c.VisionFrameCache || !c.PipelineDegraded || c.DownstreamFailures != 2 {
+		t.Errorf("summary %s does not report the state that was cleared", body)
+	}
+
+	if g.serviceOffline(serviceML) {
+		t.Error("ML still cached as offline")
+	}
+	if g.forgetFrame() {
+		t.Error("vision frame still cached")
+	}
+	if broadcasts, dropped, _ := g.hub.resetCounters(); broadcasts > 1 || dropped != 0 {
+		t.Errorf("broadcast counters %d and %d after reset, want only the recovery event", broadcasts, dropped)
+	}
+	if keys, _ := g.failures.snapshot(); len(keys) != 0 {
+		t.Errorf("failure counters %v after reset", keys)
+	}
+	if events := recordedEvents(t, g, "pipeline.recovered"); len(events) != 1 {
+		t.Errorf("got %d pipeline.recovered events, want 1", len(events))
+	}
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", `{"image_base64":"aGVsbG8="}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("frame after reset: status %d, want 200 with the circuit closed: %s", resp.StatusCode, body)
+	}
+}
+
+// trackedBody records whether a request body was read.
+type trackedBody struct {
+	io.Reader
+	read bool
+}
+
+func (b *trackedBody) Read(p []byte) (int, error) {
+	b.read = true
+	return b.Reader.Read(p)
+}
+
+func (b *trackedBody) Close() error { return nil }
+
+func TestSaturatedServiceRejectsBeforeBodyRead(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	calls := stubPipeline(t, g, defaultPipeline())
+	g.setServiceStatus(serviceML, "offline")
+
+	var reached bool
+	h := g.rejectWhenSaturated(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		io.ReadAll(r.Body)
+	}, serviceML)
+	body := &trackedBody{Reader: strings.NewReader(strings.Repeat("x", 1<<20))}
+	req := httptest.NewRequest(http.MethodPost, "/api/vision/frame", body)
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("status %d, Retry-After %q, want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if reached || body.read {
+		t.Error("body read although the ML service is saturated")
+	}
+
+	resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/speech/transcript", speechRequest)
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("speech with ML offline: status %d, want 503 with Retry-After", resp.StatusCode)
+	}
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame?force", `{"image_base64":"aGVsbG8="}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("forced frame: status %d, want 200: %s", resp.StatusCode, body)
+	}
+	if clip := calls.get("/infer/clip"); len(clip) != 1 {
+		t.Errorf("ML service called %d times, want only for the forced frame", len(clip))
+	}
+}
+
+func TestMLFallbackKeepsIngestionOpen(t *testing.T) {
+	g, _ := newTestGateway(t, Config{MLFallbackURL: "http://fallback.example"})
+	g.setServiceStatus(serviceML, "offline")
+	var reached bool
+	h := g.rejectWhenSaturated(func(w http.ResponseWriter, r *http.Request) { reached = true }, serviceML)
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/vision/frame", nil))
+	if !reached {
+		t.Error("ingestion refused although an ML fallback is configured")
+	}
+}
+
+func TestBroadcastPauseHoldsEventsUntilResume(t *testing.T) {
+	g, srv := newTestGateway(t, Config{APIKey: testAPIKey})
+	stream := openSSE(t, srv.URL+"/events", nil)
+	stream.expect("connection")
+
+	if resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/admin/broadcast/pause", "", "X-API-Key", testAPIKey); resp.StatusCode != http.StatusOK {
+		t.Fatalf("pause: status %d, want 200", resp.StatusCode)
+	}
+	g.hub.Broadcast(`{"type":"held","n":1}`)
+	g.hub.Broadcast(`{"type":"held","n":2}`)
+	stream.quiet(200 * time.Millisecond)
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/admin/broadcast/resume", "", "X-API-Key", testAPIKey)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"replayed":2`) {
+		t.Fatalf("resume: status %d %s, want 200 reporting 2 replayed", resp.StatusCode, body)
+	}
+	for n := 1.0; n <= 2; n++ {
+		if ev := stream.expect("held"); ev["n"] != n {
+			t.Errorf("got %v, want held event %v", ev, n)
+		}
+	}
+	g.hub.Broadcast(`{"type":"live"}`)
+	stream.expect("live")
+}
+
+func TestBroadcastPausePastHistoryRequiresResync(t *testing.T) {
+	hub := NewSSEHub()
+	hub.history = newEventHistory(2)
+	srv := serve(t, hub)
+	stream := openSSE(t, srv.URL, nil)
+	stream.expect("connection")
+
+	hub.Pause()
+	for range 3 {
+		hub.Broadcast(`{"type":"held"}`)
+	}
+	if replayed := hub.Resume(); replayed != 0 {
+		t.Errorf("replayed %d events that overflowed the history", replayed)
+	}
+	stream.expect("resync_required")
+}
+
+func TestAdminRoutesMoveToAdminListener(t *testing.T) {
+	const adminToken = "admin-token"
+	g, public := newTestGateway(t, Config{APIKey: testAPIKey, AdminAddr: "127.0.0.1:0", AdminToken: adminToken})
+	mux := http.NewServeMux()
+	g.RegisterAdminRoutes(mux)
+	admin := serve(t, mux)
+
+	for _, tc := range []struct {
+		name   string
+		url    string
+		header []string
+		status int
+	}{
+		{"public with API key", public.URL, []string{"X-API-Key", testAPIKey}, http.StatusNotFound},
+		{"public with admin token", public.URL, []string{"X-API-Key", adminToken}, http.StatusNotFound},
+		{"admin with admin token", admin.URL, []string{"Authorization", "Bearer " + adminToken}, http.StatusOK},
+		{"admin with API key", admin.URL, []string{"X-API-Key", testAPIKey}, http.StatusUnauthorized},
+		{"admin without token", admin.URL, nil, http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if resp, body := doRequest(t, http.MethodGet, tc.url+"/api/admin/clients", "", tc.header...); resp.StatusCode != tc.status {
+				t.Errorf("status %d %s, want %d", resp.StatusCode, body, tc.status)
+			}
+		})
+	}
+	if _, body := doRequest(t, http.MethodGet, public.URL+"/api/config", ""); !strings.Contains(body, `"admin_enabled":false`) {
+		t.Errorf("public config %s, want admin reported as off the public API", body)
+	}
+}
+
+func TestAdminRoutesStayOnPublicAPIByDefault(t *testing.T) {
+	_, srv := newTestGateway(t, Config{APIKey: testAPIKey, AdminToken: "admin-token"})
+	if resp, _ := doRequest(t, http.MethodGet, srv.URL+"/api/admin/clients", "", "X-API-Key", testAPIKey); resp.StatusCode != http.StatusOK {
+		t.Errorf("with API key: status %d, want 200", resp.StatusCode)
+	}
+	if resp, _ := doRequest(t, http.MethodGet, srv.URL+"/api/admin/clients", "", "X-API-Key", "admin-token"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("with the admin token: status %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestAdminClientsListsConnectedClients(t *testing.T) {
+	g, srv := newTestGateway(t, Config{APIKey: testAPIKey})
+	before := time.Now().Add(-time.Second)
+	openSSE(t, srv.URL+"/events?session=kiosk&fields=type,seq", nil).expect("connection")
+	cameraID, _ := openSSE(t, srv.URL+"/events?camera=front", nil).expect("connection")["client_id"].(string)
+	g.hub.mu.Lock()
+	g.hub.clients[cameraID].drops.total.Add(3)
+	g.hub.mu.Unlock()
+
+	resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/admin/clients", "", "X-API-Key", testAPIKey)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	var out struct {
+		Count   int          `json:"count"`
+		Clients []clientInfo `json:"clients"`
+	}
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Count != 2 || len(out.Clients) != 2 {
+		t.Fatalf("listed %d clients (count %d), want 2: %s", len(out.Clients), out.Count, body)
+	}
+
+	// Longest connected first
+	kiosk, camera := out.Clients[0], out.Clients[1]
+	if kiosk.Session != "kiosk" || kiosk.Fields != "type,seq" || kiosk.Cameras != "" || kiosk.DroppedCount != 0 {
+		t.Errorf("first client %+v, want the kiosk session with its projection", kiosk)
+	}
+	if camera.ID != cameraID || camera.Cameras != "front" || camera.Session != "" || camera.DroppedCount != 3 {
+		t.Errorf("second client %+v, want %s on camera front with 3 drops", camera, cameraID)
+	}
+	for _, c := range out.Clients {
+		if c.ID == "" || !strings.HasPrefix(c.RemoteAddr, "127.0.0.1:") {
+			t.Errorf("client %+v, want an ID and a loopback remote address", c)
+		}
+		if c.ConnectedSince.Before(before) || c.ConnectedSince.After(time.Now()) {
+			t.Errorf("client connected since %s, want the time it connected", c.ConnectedSince)
+		}
+	}
+	if kiosk.ConnectedSince.After(camera.ConnectedSince) {
+		t.Error("clients not ordered by connection time")
+	}
+}
+
+func TestAdminConfigSourcesReportsProvenance(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "gateway.env")
+	if err := os.WriteFile(file, []byte("# overrides\nSSE_CLIENT_BUFFER=8\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("MEMORY_TIMEOUT", "3s")
+	t.Setenv("TIMEOUT_MULTIPLIER", "not-a-number")
+	t.Setenv("SPEECH_TIMEOUT", "")
+	t.Setenv("API_KEY", testAPIKey)
+	t.Setenv("ADMIN_TOKEN", "")
+	_, srv := newTestGateway(t, LoadConfig())
+
+	if resp, _ := doRequest(t, http.MethodGet, srv.URL+"/api/admin/config/sources", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("sources without the API key: status %d, want 401", resp.StatusCode)
+	}
+	resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/admin/config/sources", "", "X-API-Key", testAPIKey)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	var out struct {
+		Count    int                       `json:"count"`
+		Settings map[string]map[string]any `json:"settings"`
+	}
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	if out.Count != len(out.Settings) || out.Count == 0 {
+		t.Errorf("count %d for %d settings", out.Count, len(out.Settings))
+	}
+
+	tests := []struct {
+		key    string
+		source string
+		value  any
+	}{
+		{"MEMORY_TIMEOUT", sourceEnv, "3s"},
+		{"SSE_CLIENT_BUFFER", sourceFile, 8.0},
+		{"SPEECH_TIMEOUT", sourceDefault, "30s"},
+		// An invalid value falls back to the default and says so
+		{"TIMEOUT_MULTIPLIER", sourceDefault, 1.0},
+	}
+	for _, tt := range tests {
+		got := out.Settings[tt.key]
+		if got["source"] != tt.source || got["value"] != tt.value {
+			t.Errorf("%s = %v, want value %v from %s", tt.key, got, tt.value, tt.source)
+		}
+	}
+
+	for key, set := range map[string]bool{"API_KEY": true, "ADMIN_TOKEN": false} {
+		got := out.Settings[key]
+		if _, ok := got["value"]; ok || got["set"] != set {
+			t.Errorf("%s = %v, want only set=%t", key, got, set)
+		}
+	}
+	if strings.Contains(body, testAPIKey) {
+		t.Error("response reveals the API key")
+	}
+}
+
+func TestWebhookProvenance(t *testing.T) {
+	const hooks = `[{"url":"https://hooks.example/x?token=abc"}]`
+	file := filepath.Join(t.TempDir(), "gateway.env")
+	if err := os.WriteFile(file, []byte("WEBHOOKS="+hooks+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, file, env, source string
+	}{
+		{"from the config file", file, "", sourceFile},
+		{"from the environment", "", hooks, sourceEnv},
+		{"unset", "", "", sourceDefault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", tt.file)
+			t.Setenv("WEBHOOKS", tt.env)
+			got := LoadConfig().sources["WEBHOOKS"]
+			if got.Source != tt.source || !got.Secret {
+				t.Errorf("WEBHOOKS source %+v, want a secret from %s", got, tt.source)
+			}
+		})
+	}
+}
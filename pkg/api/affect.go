@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// affectStats is the moving average and variance of one affect dimension.
+type affectStats struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+}
+
+// affectWindow keeps the most recent per-frame affect values, so a smoothed
+// trend can be broadcast instead of the jittery instantaneous values.
+type affectWindow struct {
+	mu       sync.Mutex
+	valence  []float64
+	arousal  []float64
+	next     int
+	count    int
+	interval time.Duration
+	lastSent time.Time
+}
+
+func newAffectWindow(size int, interval time.Duration) *affectWindow {
+	return &affectWindow{
+		valence:  make([]float64, size),
+		arousal:  make([]float64, size),
+		interval: interval,
+	}
+}
+
+// add records a frame's affect at now. It reports the window's statistics
+// and true when at least interval has passed since the last reported trend.
+func (a *affectWindow) add(valence, arousal float64, now time.Time) (affectStats, affectStats, int, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.valence[a.next] = valence
+	a.arousal[a.next] = arousal
+	a.next = (a.next + 1) % len(a.valence)
+	if a.count < len(a.valence) {
+		a.count++
+	}
+
+	if !a.lastSent.IsZero() && now.Sub(a.lastSent) < a.interval {
+		return affectStats{}, affectStats{}, 0, false
+	}
+	a.lastSent = now
+	return windowStats(a.valence[:a.count]), windowStats(a.arousal[:a.count]), a.count, true
+}
+
+// windowStats returns the mean and population variance of values. Only the
+// filled part of the ring is passed in, and order does not matter.
+func windowStats(values []float64) affectStats {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return affectStats{Mean: mean, Variance: sq / float64(len(values))}
+}
+
+// recordAffect adds a frame's affect to the rolling window and broadcasts
+// an affect.trend event, at most once per AffectTrendInterval.
+func (g *Gateway) recordAffect(valence, arousal float64) {
+	valenceStats, arousalStats, samples, ok := g.affect.add(valence, arousal, time.Now())
+	if !ok {
+		return
+	}
+	evBytes, _ := json.Marshal(map[string]any{
+		"type":      "affect.trend",
+		"valence":   valenceStats,
+		"arousal":   arousalStats,
+		"samples":   samples,
+		"timestamp": g.timestamp(),
+	})
+	g.hub.Broadcast(string(evBytes))
+}
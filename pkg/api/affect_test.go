@@ -0,0 +1,73 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAffectWindowAveragesAndThrottles(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	window := newAffectWindow(3, time.Second)
+	for i, step := range []struct {
+		valence, arousal float64
+		after            time.Duration
+		sent             bool
+		samples          int
+		valenceMean      float64
+		arousalMean      float64
+		variance         float64
+	}{
+		{0.2, 0.1, 0, true, 1, 0.2, 0.1, 0},
+		{0.4, 0.3, 100 * time.Millisecond, false, 0, 0, 0, 0},
+		{0.6, 0.5, time.Second, true, 3, 0.4, 0.3, 0.08 / 3},
+		{0.8, 0.7, 1500 * time.Millisecond, false, 0, 0, 0, 0},
+		// The window holds three frames, so the first has dropped out
+		{1.0, 0.9, 2 * time.Second, true, 3, 0.8, 0.7, 0.08 / 3},
+	} {
+		valence, arousal, samples, sent := window.add(step.valence, step.arousal, start.Add(step.after))
+		if sent != step.sent {
+			t.Fatalf("frame %d: sent %t, want %t", i, sent, step.sent)
+		}
+		if !sent {
+			continue
+		}
+		if samples != step.samples {
+			t.Errorf("frame %d: %d samples, want %d", i, samples, step.samples)
+		}
+		for _, got := range []struct {
+			name        string
+			value, want float64
+		}{
+			{"valence mean", valence.Mean, step.valenceMean},
+			{"arousal mean", arousal.Mean, step.arousalMean},
+			{"valence variance", valence.Variance, step.variance},
+			{"arousal variance", arousal.Variance, step.variance},
+		} {
+			if math.Abs(got.value-got.want) > 1e-9 {
+				t.Errorf("frame %d: %s %v, want %v", i, got.name, got.value, got.want)
+			}
+		}
+	}
+}
+
+func TestVisionFrameBroadcastsAffectTrend(t *testing.T) {
+	g, srv := newTestGateway(t, Config{AffectTrendInterval: time.Hour})
+	stubPipeline(t, g, defaultPipeline())
+
+	for range 2 {
+		if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame); resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+		}
+	}
+	trends := recordedEvents(t, g, "affect.trend")
+	if len(trends) != 1 {
+		t.Fatalf("got %d affect.trend events within the interval, want 1", len(trends))
+	}
+	valence, _ := trends[0]["valence"].(map[string]any)
+	arousal, _ := trends[0]["arousal"].(map[string]any)
+	if valence["mean"] != 0.6 || arousal["mean"] != 0.4 || trends[0]["samples"] != float64(1) {
+		t.Errorf("trend %v, want the first frame's valence 0.6 and arousal 0.4", trends[0])
+	}
+}
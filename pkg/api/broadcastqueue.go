@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// broadcastQueue holds broadcasts between the handlers that make them and
+// the single goroutine that sequences, records and fans them out, so a
+// burst of events costs the handlers a queue append instead of a turn on
+// the hub's lock. When it is full the oldest queued broadcast is dropped.
+type broadcastQueue struct {
+	mu      sync.Mutex
+	pending []string // ring buffer of len(pending) slots
+	head    int
+	count   int
+	closed  bool
+
+	ready chan struct{}
+	done  chan struct{}
+
+	// dropped counts broadcasts pushed out of a full queue
+	dropped atomic.Uint64
+}
+
+func newBroadcastQueue(size int) *broadcastQueue {
+	return &broadcastQueue{
+		pending: make([]string, size),
+		ready:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// push queues msg, dropping the oldest queued broadcast when the queue is
+// full. It reports false once the queue is closed.
+func (q *broadcastQueue) push(msg string) bool {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return false
+	}
+	if q.count == len(q.pending) {
+		q.pending[q.head] = ""
+		q.head = (q.head + 1) % len(q.pending)
+		q.count--
+		q.dropped.Add(1)
+	}
+	q.pending[(q.head+q.count)%len(q.pending)] = msg
+	q.count++
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pop takes the oldest queued broadcast. It reports false when the queue is
+// empty, along with whether it has been closed.
+func (q *broadcastQueue) pop() (msg string, ok, closed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.count == 0 {
+		return "", false, q.closed
+	}
+	msg = q.pending[q.head]
+	q.pending[q.head] = ""
+	q.head = (q.head + 1) % len(q.pending)
+	q.count--
+	return msg, true, false
+}
+
+// startQueue makes Broadcast hand messages to a queue of size entries
+// drained by a single goroutine, until stopQueue is called.
+func (h *SSEHub) startQueue(size int) {
+	q := newBroadcastQueue(size)
+	h.queue = q
+	go func() {
+		defer close(q.done)
+		for {
+			msg, ok, closed := q.pop()
+			if closed {
+				return
+			}
+			if !ok {
+				<-q.ready
+				continue
+			}
+			h.broadcast(msg, func(ClientMeta) bool { return true }, true)
+		}
+	}()
+}
+
+// stopQueue stops accepting queued broadcasts, after which Broadcast sends
+// directly again, and waits until ctx is done for the queued ones to go
+// out.
+func (h *SSEHub) stopQueue(ctx context.Context) error {
+	q := h.queue
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBroadcastQueueDropsOldestWhenFull(t *testing.T) {
+	q := newBroadcastQueue(3)
+	for i := range 5 {
+		if !q.push(fmt.Sprint(i)) {
+			t.Fatalf("push %d refused by an open queue", i)
+		}
+	}
+	if n := q.dropped.Load(); n != 2 {
+		t.Errorf("dropped %d, want 2", n)
+	}
+
+	var got []string
+	for {
+		msg, ok, _ := q.pop()
+		if !ok {
+			break
+		}
+		got = append(got, msg)
+	}
+	if want := []string{"2", "3", "4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("popped %v, want the newest %v in order", got, want)
+	}
+
+	q.closed = true
+	if q.push("late") {
+		t.Error("closed queue accepted a broadcast")
+	}
+	if _, ok, closed := q.pop(); ok || !closed {
+		t.Errorf("pop on a closed empty queue: ok %t closed %t", ok, closed)
+	}
+}
+
+func TestQueuedBroadcastsKeepOrder(t *testing.T) {
+	g, _ := newTestGateway(t, Config{SSEBroadcastQueue: 1000, SSEHistorySize: 1000})
+	for i := range 500 {
+		g.hub.Broadcast(fmt.Sprintf(`{"type":"burst","n":%d}`, i))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := g.hub.stopQueue(ctx); err != nil {
+		t.Fatalf("draining the queue: %v", err)
+	}
+
+	events := recordedEvents(t, g, "burst")
+	if len(events) != 500 {
+		t.Fatalf("recorded %d broadcasts, want 500", len(events))
+	}
+	for i, ev := range events {
+		if ev["n"] != float64(i) || ev["seq"] != float64(i+1) {
+			t.Fatalf("event %d is n=%v seq=%v, want n=%d seq=%d", i, ev["n"], ev["seq"], i, i+1)
+		}
+	}
+	if n := g.hub.queue.dropped.Load(); n != 0 {
+		t.Errorf("dropped %d broadcasts from a queue that never filled", n)
+	}
+}
+
+func TestFloodedBroadcastQueueCountsOverflow(t *testing.T) {
+	g, _ := newTestGateway(t, Config{SSEBroadcastQueue: 10, SSEHistorySize: 1000})
+	const flood = 100
+	// Holding the hub's lock stalls the broadcaster so the queue fills
+	g.hub.mu.Lock()
+	for i := range flood {
+		g.hub.Broadcast(fmt.Sprintf(`{"type":"burst","n":%d}`, i))
+	}
+	g.hub.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := g.hub.stopQueue(ctx); err != nil {
+		t.Fatalf("draining the queue: %v", err)
+	}
+
+	events := recordedEvents(t, g, "burst")
+	dropped := g.hub.queue.dropped.Load()
+	if dropped == 0 || int(dropped)+len(events) != flood {
+		t.Errorf("dropped %d and delivered %d of %d broadcasts", dropped, len(events), flood)
+	}
+	// The broadcaster may already hold the first event when the lock is
+	// taken; the rest are the newest ones, still in order
+	if len(events) > 11 {
+		t.Errorf("delivered %d broadcasts through a queue of 10", len(events))
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i]["n"].(float64) <= events[i-1]["n"].(float64) {
+			t.Fatalf("delivered out of order: %v after %v", events[i]["n"], events[i-1]["n"])
+		}
+	}
+	if last := events[len(events)-1]["n"]; last != float64(flood-1) {
+		t.Errorf("last delivered n=%v, want the newest %d", last, flood-1)
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// defaultCameraID is the camera a vision frame is attributed to when it
+// does not name one.
+const defaultCameraID = "cam-0"
+
+// maxCameraIDLength bounds camera identifiers, which end up in embedding
+// IDs and every vision event.
+const maxCameraIDLength = 64
+
+// validCameraID reports whether id is a non-empty identifier made of
+// letters, digits, dots, dashes and underscores.
+func validCameraID(id string) bool {
+	if id == "" || len(id) > maxCameraIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// cameraFilter is the set of cameras a client subscribed to with ?camera=.
+// An empty filter lets every event through.
+type cameraFilter map[string]bool
+
+// parseCameraFilter parses a ?camera= spec: comma-separated camera IDs.
+func parseCameraFilter(spec string) cameraFilter {
+	f := cameraFilter{}
+	for _, id := range strings.Split(spec, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			f[id] = true
+		}
+	}
+	return f
+}
+
+// allows reports whether an event should reach the client. Events that
+// are not tied to a camera, such as service statuses, always do.
+func (f cameraFilter) allows(data string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	var ev struct {
+		CameraID string `json:"camera_id"`
+	}
+	if json.Unmarshal([]byte(data), &ev) != nil || ev.CameraID == "" {
+		return true
+	}
+	return f[ev.CameraID]
+}
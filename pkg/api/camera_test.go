@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// camerasUntil reads stream up to a marker event, returning the camera of
+// each vision.observation before it and every camera_id seen at all.
+func camerasUntil(s *sseStream, marker string) (observed, seen []string) {
+	s.t.Helper()
+	for {
+		ev := s.next()
+		if ev["type"] == marker {
+			return observed, seen
+		}
+		camera, _ := ev["camera_id"].(string)
+		if camera != "" {
+			seen = append(seen, camera)
+		}
+		if ev["type"] == "vision.observation" {
+			observed = append(observed, camera)
+		}
+	}
+}
+
+func TestCameraSourcesAreTaggedAndFiltered(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	calls := stubPipeline(t, g, defaultPipeline())
+	front := openSSE(t, srv.URL+"/events?camera=front", nil)
+	rest := openSSE(t, srv.URL+"/events?camera=back,cam-0", nil)
+	all := openSSE(t, srv.URL+"/events", nil)
+	for _, s := range []*sseStream{front, rest, all} {
+		s.expect("connection")
+	}
+
+	for _, frame := range []string{
+		`{"image_base64":"ZnJvbnQ=","camera_id":"front"}`,
+		`{"image_base64":"YmFjaw==","camera_id":"back"}`,
+		`{"image_base64":"bm9uZQ=="}`,
+	} {
+		if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", frame); resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d, want 200: %s", frame, resp.StatusCode, body)
+		}
+	}
+	g.Hub().Broadcast(`{"type":"marker"}`)
+
+	observations := recordedEvents(t, g, "vision.observation")
+	runs := calls.get("/run")
+	if len(observations) != 3 || len(runs) != 3 {
+		t.Fatalf("got %d observations and %d runs, want 3 of each", len(observations), len(runs))
+	}
+	for i, camera := range []string{"front", "back", "cam-0"} {
+		if observations[i]["camera_id"] != camera || !strings.HasPrefix(observations[i]["embedding_id"].(string), "emb-"+camera+"-") {
+			t.Errorf("observation %v, want it from %s with an embedding ID naming it", observations[i], camera)
+		}
+		var run struct {
+			CameraID string `json:"camera_id"`
+		}
+		json.Unmarshal([]byte(runs[i]), &run)
+		if run.CameraID != camera {
+			t.Errorf("sentience run %d for camera %q, want %s", i, run.CameraID, camera)
+		}
+	}
+	tokens := recordedEvents(t, g, "sentience.token")
+	if len(tokens) != 3 || tokens[0]["camera_id"] != "front" || tokens[1]["camera_id"] != "back" || tokens[2]["camera_id"] != "cam-0" {
+		t.Errorf("sentience tokens %v, want one from each camera in order", tokens)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		stream  *sseStream
+		want    []string
+		cameras map[string]bool
+	}{
+		{"front", front, []string{"front"}, map[string]bool{"front": true}},
+		{"back and default", rest, []string{"back", "cam-0"}, map[string]bool{"back": true, "cam-0": true}},
+		{"unfiltered", all, []string{"front", "back", "cam-0"}, map[string]bool{"front": true, "back": true, "cam-0": true}},
+	} {
+		observed, seen := camerasUntil(tc.stream, "marker")
+		if strings.Join(observed, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: observed cameras %v, want %v", tc.name, observed, tc.want)
+		}
+		for _, camera := range seen {
+			if !tc.cameras[camera] {
+				t.Errorf("%s: received an event from camera %s", tc.name, camera)
+			}
+		}
+	}
+}
+
+func TestInvalidCameraIDIsRejected(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	calls := stubPipeline(t, g, defaultPipeline())
+	for _, camera := range []string{"front door", "cam/1", strings.Repeat("c", maxCameraIDLength+1)} {
+		resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", `{"image_base64":"aGVsbG8=","camera_id":"`+camera+`"}`)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "camera_id") {
+			t.Errorf("camera %q: status %d %s, want a 400 on camera_id", camera, resp.StatusCode, body)
+		}
+	}
+	if clip := calls.get("/infer/clip"); len(clip) != 0 {
+		t.Errorf("frames with invalid cameras reached the ML service %d times", len(clip))
+	}
+}
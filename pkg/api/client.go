@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Client performs the gateway's downstream HTTP calls. Tests can substitute
+// a fake to observe or stub backend interactions.
+type Client interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// get issues a GET to one of the downstream services. A zero timeout leaves
+// the request bounded only by ctx.
+func (g *Gateway) get(ctx context.Context, service, url string, timeout time.Duration) (*http.Response, error) {
+	return g.send(ctx, service, http.MethodGet, url, nil, timeout)
+}
+
+// post issues a JSON POST to one of the downstream services. A zero timeout
+// leaves the request bounded only by ctx.
+func (g *Gateway) post(ctx context.Context, service, url string, body []byte, timeout time.Duration) (*http.Response, error) {
+	return g.send(ctx, service, http.MethodPost, url, body, timeout)
+}
+
+// serviceMLFallback labels calls to the fallback ML endpoint. It has no
+// status of its own, so it is never skipped as offline.
+const serviceMLFallback = "ml-fallback"
+
+// inferML posts body to path on the ML service, first waiting in the ML
+// queue when MLConcurrency is set; the slot is held until the response body
+// is closed. When the primary fails or is known to be offline and
+// MLFallbackURL is set, the request is retried against the fallback, and
+// degraded reports that its response was used. If the fallback fails too,
+// the primary's error is returned.
+func (g *Gateway) inferML(ctx context.Context, path string, body []byte) (resp *http.Response, degraded bool, err error) {
+	if err := g.mlSlots.acquire(ctx, g.config().MLQueueTimeout); err != nil {
+		return nil, false, &serviceError{service: serviceML, err: err}
+	}
+	resp, degraded, err = g.inferMLWithFallback(ctx, path, body)
+	return g.mlSlots.holdUntilClosed(resp), degraded, err
+}
+
+func (g *Gateway) inferMLWithFallback(ctx context.Context, path string, body []byte) (resp *http.Response, degraded bool, err error) {
+	resp, err = g.post(ctx, serviceML, g.serviceURL(serviceML, path), body, 0)
+	if err == nil && resp.StatusCode < 500 {
+		return resp, false, nil
+	}
+	if g.config().MLFallbackURL == "" || ctx.Err() != nil {
+		return resp, false, err
+	}
+	if err == nil {
+		resp.Body.Close()
+		err = fmt.Errorf("ml service error: status %d", resp.StatusCode)
+	}
+
+	fallback, fbErr := g.post(ctx, serviceMLFallback, strings.TrimSuffix(g.config().MLFallbackURL, "/")+path, body, 0)
+	if fbErr != nil {
+		return nil, false, err
+	}
+	if fallback.StatusCode >= 500 {
+		fallback.Body.Close()
+		return nil, false, err
+	}
+	fmt.Printf("ML service failed (%v), used fallback for %s\n", err, path)
+	return fallback, true, nil
+}
+
+// scaleTimeout applies the configured TimeoutMultiplier to a downstream
+// timeout. A product too large for a Duration is capped rather than left
+// to wrap negative, which would time every call out at once.
+func (g *Gateway) scaleTimeout(timeout time.Duration) time.Duration {
+	m := g.config().TimeoutMultiplier
+	if !(m > 0) {
+		return timeout
+	}
+	scaled := float64(timeout) * m
+	if scaled >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(scaled)
+}
+
+func (g *Gateway) send(ctx context.Context, service, method, url string, body []byte, timeout time.Duration) (*http.Response, error) {
+	// Skip services known to be down rather than waiting out a dial timeout
+	if !isForced(ctx) && g.serviceOffline(service) {
+		return nil, &serviceError{service: service, err: errServiceOffline}
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, g.scaleTimeout(timeout))
+	}
+
+	// The timeout covers every attempt, each of which replays body from
+	// the start
+	attempts := g.retryAttempts(ctx, body)
+	var resp *http.Response
+	var span trace.Span
+	var err error
+	for attempt := 1; ; attempt++ {
+		resp, span, err = g.sendOnce(ctx, service, method, url, body)
+		if err == nil || attempt == attempts || !connectionError(err) || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		case <-ctx.Done():
+		}
+	}
+	if err != nil {
+		cancel()
+		g.countSendError(service, err)
+		return nil, &serviceError{service: service, err: err}
+	}
+	g.countResponse(service, resp.StatusCode)
+	g.limitBody(service, resp)
+	// The timeout and span must keep covering the body, so both end on Close
+	resp.Body = &onClose{ReadCloser: resp.Body, fn: func() {
+		endClientSpan(span, resp, nil)
+		cancel()
+	}}
+	return resp, nil
+}
+
+// sendOnce makes a single attempt at a downstream call. A failed attempt
+// has already ended its span.
+func (g *Gateway) sendOnce(ctx context.Context, service, method, url string, body []byte) (*http.Response, trace.Span, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if isSynthetic(ctx) {
+		req.Header.Set(syntheticHeader, "true")
+	}
+
+	req, span := startClientSpan(req, service)
+	resp, err := g.client.Do(req)
+	if err != nil {
+		endClientSpan(span, nil, err)
+		return nil, nil, err
+	}
+	return resp, span, nil
+}
+
+type onClose struct {
+	io.ReadCloser
+	fn   func()
+	once sync.Once
+}
+
+func (c *onClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.once.Do(c.fn)
+	return err
+}
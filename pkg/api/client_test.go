@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClient answers downstream calls with respond, recording each request
+// and its body. Like a real client it fails requests whose context is done.
+type fakeClient struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+	respond  func(*http.Request) (*http.Response, error)
+}
+
+func (c *fakeClient) Do(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	var body string
+	if req.Body != nil {
+		b, _ := io.ReadAll(req.Body)
+		body = string(b)
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.bodies = append(c.bodies, body)
+	c.mu.Unlock()
+	return c.respond(req)
+}
+
+// jsonResponse returns a response with status and a JSON body.
+func jsonResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestTokenizeThroughFakeClient(t *testing.T) {
+	fake := &fakeClient{respond: func(*http.Request) (*http.Response, error) {
+		return jsonResponse(http.StatusOK, `{"type":"sentience.token","embedding_id":"e1","facets":{"vision.object":"cat"}}`), nil
+	}}
+	g, srv := newTestGatewayWith(t, Config{}, func(g *Gateway) { g.SetClient(fake) })
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/sentience/tokenize", `{"embedding_id":"e1","clip_topk":[{"label":"cat","score":0.9}]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+
+	if len(fake.requests) != 1 {
+		t.Fatalf("made %d downstream calls, want 1", len(fake.requests))
+	}
+	req := fake.requests[0]
+	if req.Method != http.MethodPost || req.URL.String() != "http://localhost:8082/tokenize" {
+		t.Errorf("downstream call %s %s, want POST http://localhost:8082/tokenize", req.Method, req.URL)
+	}
+	if !strings.Contains(fake.bodies[0], `"embedding_id":"e1"`) || !strings.Contains(fake.bodies[0], `"label":"cat"`) {
+		t.Errorf("downstream body %s does not carry the request", fake.bodies[0])
+	}
+	tokens := recordedEvents(t, g, "sentience.token")
+	if len(tokens) != 1 || tokens[0]["embedding_id"] != "e1" {
+		t.Errorf("broadcast %v, want the token from the fake response", tokens)
+	}
+}
+
+// stubMLFallback serves a fallback ML endpoint answering the vision and
+// speech inference paths, recording the paths it was called on.
+func stubMLFallback(t *testing.T) (*httptest.Server, *backendCalls) {
+	t.Helper()
+	calls := &backendCalls{bodies: make(map[string][]string)}
+	responses := defaultPipeline()
+	srv := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.add(r.URL.Path, "")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(responses[r.URL.Path]))
+	}))
+	return srv, calls
+}
+
+func TestMLFallbackTagsDegradedResults(t *testing.T) {
+	for _, tc := range []struct {
+		name, path, request, event, inference string
+	}{
+		{"vision", "/api/vision/frame", testFrame, "vision.observation", "/infer/clip"},
+		{"speech", "/api/speech/transcript", speechRequest, "speech.transcript", "/infer/whisper"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fallback, fallbackCalls := stubMLFallback(t)
+			g, srv := newTestGateway(t, Config{MLFallbackURL: fallback.URL + "/"})
+			// The primary answers only sentience calls, failing every inference
+			stubPipeline(t, g, map[string]string{"/run": runResponse})
+
+			if resp, body := doRequest(t, http.MethodPost, srv.URL+tc.path, tc.request); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200 from the fallback: %s", resp.StatusCode, body)
+			}
+			if n := len(fallbackCalls.get(tc.inference)); n != 1 {
+				t.Errorf("fallback called %d times on %s, want 1", n, tc.inference)
+			}
+			events := recordedEvents(t, g, tc.event)
+			if len(events) != 1 || events[0]["degraded_ml"] != true {
+				t.Errorf("broadcast %v, want one %s tagged degraded_ml", events, tc.event)
+			}
+		})
+	}
+}
+
+func TestMLFallbackUnusedWhilePrimaryHealthy(t *testing.T) {
+	fallback, fallbackCalls := stubMLFallback(t)
+	g, srv := newTestGateway(t, Config{MLFallbackURL: fallback.URL})
+	stubPipeline(t, g, defaultPipeline())
+
+	doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame)
+	if n := len(fallbackCalls.get("/infer/clip")); n != 0 {
+		t.Errorf("fallback called %d times with a healthy primary", n)
+	}
+	if events := recordedEvents(t, g, "vision.observation"); len(events) != 1 || events[0]["degraded_ml"] != nil {
+		t.Errorf("broadcast %v, want one observation without degraded_ml", events)
+	}
+}
+
+func TestMLFallbackReplacesOfflinePrimary(t *testing.T) {
+	fallback, fallbackCalls := stubMLFallback(t)
+	g, srv := newTestGateway(t, Config{MLFallbackURL: fallback.URL})
+	primaryCalls := stubPipeline(t, g, defaultPipeline())
+	g.setServiceStatus(serviceML, "offline")
+
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200 from the fallback: %s", resp.StatusCode, body)
+	}
+	if n := len(primaryCalls.get("/infer/clip")); n != 0 {
+		t.Errorf("offline primary called %d times", n)
+	}
+	if n := len(fallbackCalls.get("/infer/clip")); n != 1 {
+		t.Errorf("fallback called %d times, want 1", n)
+	}
+}
+
+func TestMLFallbackFailingReportsPrimaryError(t *testing.T) {
+	fallback := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "fallback down", http.StatusServiceUnavailable)
+	}))
+	g, srv := newTestGateway(t, Config{MLFallbackURL: fallback.URL})
+	stubPipeline(t, g, map[string]string{})
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame)
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(body, "status 500") {
+		t.Errorf("status %d %s, want 502 with the primary's error", resp.StatusCode, body)
+	}
+	if events := recordedEvents(t, g, "vision.observation"); len(events) != 0 {
+		t.Errorf("broadcast %v with both ML endpoints down", events)
+	}
+}
+
+func TestTimeoutMultiplierScalesDownstreamDeadline(t *testing.T) {
+	tests := []struct {
+		multiplier float64
+		want       time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{3, 3 * time.Second},
+		{0.5, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.multiplier), func(t *testing.T) {
+			fake := &fakeClient{respond: func(*http.Request) (*http.Response, error) {
+				return jsonResponse(http.StatusOK, `{}`), nil
+			}}
+			g, _ := newTestGatewayWith(t, Config{}, func(g *Gateway) { g.SetClient(fake) })
+			// Stored after construction so a zero multiplier is not defaulted
+			cfg := *g.config()
+			cfg.TimeoutMultiplier = tt.multiplier
+			g.cfg.Store(&cfg)
+
+			start := time.Now()
+			resp, err := g.send(context.Background(), serviceML, http.MethodGet, g.serviceURL(serviceML, "/health"), nil, time.Second)
+			if err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			resp.Body.Close()
+
+			deadline, ok := fake.requests[0].Context().Deadline()
+			if !ok {
+				t.Fatal("downstream request has no deadline")
+			}
+			if got := deadline.Sub(start); got < tt.want || got > tt.want+100*time.Millisecond {
+				t.Errorf("effective timeout %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutMultiplierExtendsMemoryTimeout(t *testing.T) {
+	g, srv := newTestGateway(t, Config{MemoryTimeout: 50 * time.Millisecond, TimeoutMultiplier: 20})
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[]`)
+	})
+
+	resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/memory", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d %s, want 200 once MemoryTimeout is scaled past the backend's delay", resp.StatusCode, body)
+	}
+}
+
+func TestTimeoutMultiplierFromEnv(t *testing.T) {
+	t.Setenv("TIMEOUT_MULTIPLIER", "2.5")
+	if got := LoadConfig().TimeoutMultiplier; got != 2.5 {
+		t.Errorf("TimeoutMultiplier %v, want 2.5", got)
+	}
+	for _, v := range []string{"", "NaN", "0", "-2", "Inf"} {
+		t.Setenv("TIMEOUT_MULTIPLIER", v)
+		if got := LoadConfig().TimeoutMultiplier; got != 1 {
+			t.Errorf("TIMEOUT_MULTIPLIER=%q gives %v, want the default of 1", v, got)
+		}
+	}
+}
+
+func TestScaleTimeoutStaysPositive(t *testing.T) {
+	tests := []struct {
+		multiplier float64
+		want       time.Duration
+	}{
+		{math.NaN(), time.Second},
+		{1e300, math.MaxInt64},
+		{math.MaxInt64 / float64(time.Second), math.MaxInt64},
+		{1e6, 1e6 * time.Second},
+	}
+	for _, tt := range tests {
+		g, _ := newTestGateway(t, Config{})
+		cfg := *g.config()
+		cfg.TimeoutMultiplier = tt.multiplier
+		g.cfg.Store(&cfg)
+		if got := g.scaleTimeout(time.Second); got != tt.want {
+			t.Errorf("multiplier %g scales 1s to %v, want %v", tt.multiplier, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package api
+
+import "time"
+
+// Clock supplies the current time for the timestamps the gateway puts on
+// events and responses. Tests can substitute a fixed clock to make them
+// deterministic.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SetClock replaces the clock used for generated timestamps.
+func (g *Gateway) SetClock(c Clock) {
+	g.clock = c
+	g.hub.clock = c
+}
+
+// now returns the current time from the gateway's clock, in UTC.
+func (g *Gateway) now() time.Time {
+	return g.clock.Now().UTC()
+}
+
+// timestamp returns the current time as the unix milliseconds events carry
+// in their timestamp field.
+func (g *Gateway) timestamp() int64 {
+	return g.clock.Now().UnixMilli()
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGeneratedTimestampsUseClock(t *testing.T) {
+	// A clock in a zone east of UTC, so local time would show
+	now := time.Date(2026, 3, 1, 17, 30, 0, 0, time.FixedZone("UTC+5", 5*60*60))
+	millis := float64(now.UnixMilli())
+	g, srv := newTestGatewayWith(t, Config{APIKey: testAPIKey, DegradedThoughts: true, LLMAttempts: 1}, func(g *Gateway) {
+		g.SetClock(fixedClock(now))
+	})
+	stubPipeline(t, g, defaultPipeline())
+	stubLLMDown(t, g)
+	openSSE(t, srv.URL+"/events", nil).expect("connection")
+
+	doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame)
+	doRequest(t, http.MethodPost, srv.URL+"/api/speech/transcript", speechRequest)
+	doRequest(t, http.MethodPost, srv.URL+"/api/events/emit", `{"type":"marker"}`, "X-API-Key", testAPIKey)
+	_, body := doRequest(t, http.MethodPost, srv.URL+"/api/llm/generate-thought", thoughtInput)
+
+	stamped := make(map[string]bool)
+	for _, ev := range recordedEvents(t, g, "") {
+		ts, ok := ev["timestamp"]
+		if !ok {
+			continue
+		}
+		stamped[ev["type"].(string)] = true
+		if ts != millis {
+			t.Errorf("%v event stamped %v, want the clock's %v", ev["type"], ts, millis)
+		}
+	}
+	for _, typ := range []string{"sentience.token", "pipeline.trace", "affect.trend", "marker"} {
+		if !stamped[typ] {
+			t.Errorf("no %s event carried a timestamp", typ)
+		}
+	}
+
+	// Thoughts keep the LLM service's RFC 3339 format, in UTC
+	var thought struct {
+		Timestamp string `json:"timestamp"`
+		Thought   struct {
+			Timestamp string `json:"timestamp"`
+		} `json:"thought"`
+	}
+	json.Unmarshal([]byte(body), &thought)
+	if want := "2026-03-01T12:30:00Z"; thought.Timestamp != want || thought.Thought.Timestamp != want {
+		t.Errorf("degraded thought stamped %q and %q, want %q", thought.Timestamp, thought.Thought.Timestamp, want)
+	}
+
+	clients := g.hub.clientsSnapshot()
+	if len(clients) != 1 || !clients[0].ConnectedSince.Equal(now) || clients[0].ConnectedSince.Location() != time.UTC {
+		t.Errorf("clients %+v, want one connected at the clock's time in UTC", clients)
+	}
+}
@@ -0,0 +1,741 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds gateway settings that can be tuned through the environment.
+type Config struct {
+	// MemoryTimeout bounds the memory proxy. In stream mode it only bounds
+	// the wait for the sentience service's response headers.
+	MemoryTimeout time.Duration
+
+	// TimeoutMultiplier scales the downstream call timeouts, MemoryTimeout
+	// and SpeechTimeout, for environments where the services are slow to
+	// answer, such as a laptop running all of them. It does not relax the
+	// server's own timeouts towards clients.
+	TimeoutMultiplier float64
+
+	// SpeechTimeout bounds a whole speech ingestion: whisper, the text
+	// embedding and the sentience run share it.
+	SpeechTimeout time.Duration
+
+	// SSEWriteTimeout is the deadline for each write to an SSE client; a
+	// client that cannot accept a write in time is disconnected.
+	SSEWriteTimeout time.Duration
+
+	// SSEMaxLifetime closes an SSE connection this long after it opened,
+	// with a "reconnect" event, before a proxy that kills long-lived
+	// connections can cut it mid-event. Zero keeps connections open.
+	SSEMaxLifetime time.Duration
+
+	// SSEClientBuffer is the number of events buffered per SSE client before
+	// further broadcasts to it are dropped.
+	SSEClientBuffer int
+
+	// SSEHistorySize is the number of recent broadcasts kept for clients
+	// that reconnect with Last-Event-ID or a resume token.
+	SSEHistorySize int
+
+	// SSEHistoryExclude lists event types that are broadcast live but kept
+	// out of the history and the event log, so frequent noise does not
+	// evict the events worth replaying. They carry no seq.
+	SSEHistoryExclude []string
+
+	// SSEBroadcastWorkers is the number of goroutines a broadcast fans out
+	// across. Raising it helps when many clients are connected.
+	SSEBroadcastWorkers int
+
+	// SSEReconnectLimit is how many times one IP may connect to the event
+	// streams within SSEReconnectWindow before getting a 429.
+	SSEReconnectLimit  int
+	SSEReconnectWindow time.Duration
+
+	// SSEBroadcastQueue, when set, queues up to this many broadcasts for a
+	// single goroutine to send, so handlers do not wait on the fan-out.
+	// When it is full the oldest queued broadcast is dropped.
+	SSEBroadcastQueue int
+
+	// WSCompression negotiates permessage-deflate on /ws connections when
+	// the client supports it.
+	WSCompression bool
+
+	// WSBinaryThreshold is the size in bytes from which /ws sends an event
+	// as a binary msgpack frame instead of text JSON.
+	WSBinaryThreshold int
+
+	// EmbeddingsBatchConcurrency caps the number of concurrent forwards to
+	// the embeddings service while handling a batch add.
+	EmbeddingsBatchConcurrency int
+
+	// MaxInFlight caps the requests the gateway serves at once; the excess
+	// gets a 503. Event streams and health checks are not counted. Zero
+	// disables the limit.
+	MaxInFlight int
+
+	// PipelineErrorThreshold is the fraction of ingestion requests that may
+	// fail with a 5xx within PipelineErrorWindow, once there are at least
+	// PipelineMinRequests of them, before new ingestion is shed with a 503
+	// until the rate drops. Zero, the default, disables the check.
+	PipelineErrorThreshold float64
+	PipelineErrorWindow    time.Duration
+	PipelineMinRequests    int
+
+	// StartupCheck probes every backend once at startup and logs a report.
+	// Until the StartupCritical services have answered, retried every
+	// StartupCheckInterval, /readyz reports the gateway as not ready.
+	StartupCheck         bool
+	StartupCheckTimeout  time.Duration
+	StartupCheckInterval time.Duration
+	StartupCritical      []string
+
+	// StatusCheckJitter is the most each service's health check is delayed
+	// within a monitor cycle, spreading the checks out over time.
+	StatusCheckJitter time.Duration
+
+	// MLConcurrency caps the concurrent calls to the ML service, with up to
+	// MLQueueDepth more waiting in arrival order for at most MLQueueTimeout.
+	// Zero leaves ML calls unbounded.
+	MLConcurrency  int
+	MLQueueDepth   int
+	MLQueueTimeout time.Duration
+
+	// FanOutConcurrency caps the concurrent backend calls made by endpoints
+	// that query every service, such as the latency probe and the status
+	// monitor. Zero runs them all at once.
+	FanOutConcurrency int
+
+	// CORSAllowedMethods and CORSAllowedHeaders are the global CORS allow
+	// lists. Preflights narrow the methods to those a route accepts.
+	CORSAllowedMethods []string
+	CORSAllowedHeaders []string
+
+	// CORSAllowedOrigins are the origins allowed to call the gateway from a
+	// browser; "*" allows any. A listed Origin is echoed back exactly.
+	CORSAllowedOrigins []string
+
+	// AllowCredentials answers cross-origin requests with
+	// Access-Control-Allow-Credentials, so browsers send cookies and auth
+	// headers along. Browsers refuse that for a wildcard origin, so it is
+	// only honored when CORSAllowedOrigins lists the origins.
+	AllowCredentials bool
+
+	// MaxResponseBytes caps downstream response bodies per service, with a
+	// "default" entry for services without their own limit.
+	MaxResponseBytes map[string]int64
+
+	// LLMAttempts is how many times a thought generation is tried before
+	// giving up on the LLM service.
+	LLMAttempts int
+
+	// ProxyRetries is how many times a downstream call from an idempotent
+	// route is retried after a connection error, such as a backend that is
+	// restarting. Calls whose body is larger than RetryBodyLimit bytes are
+	// not retried, since their body would have to be kept for replaying.
+	ProxyRetries   int
+	RetryBodyLimit int
+
+	// DegradedThoughts makes generate-thought answer with a placeholder
+	// thought, flagged as degraded, when the LLM service is unavailable.
+	DegradedThoughts bool
+
+	// StrictJSON rejects request bodies with unknown fields. It is on by
+	// default; existing clients that send extra fields can opt out per
+	// request with an X-JSON-Decode: lenient header.
+	StrictJSON bool
+
+	// MaxEventHops is how many times an event may be fed back into the
+	// gateway before ingestion drops it.
+	MaxEventHops int
+
+	// MLFallbackURL is a secondary ML endpoint, such as a smaller CPU
+	// model, used for vision and whisper inference when the primary fails.
+	// Empty disables the fallback.
+	MLFallbackURL string
+
+	// ServiceURLs overrides the base URL of backend services by name, such
+	// as ml=http://ml:8081, for backends not on their default local port.
+	ServiceURLs map[string]string
+
+	// SyntheticEmbeddingsURL is an embeddings service that requests marked
+	// X-Synthetic use instead of the real one, keeping load-test vectors
+	// out of the real store. Empty sends them to the real one, tagged.
+	SyntheticEmbeddingsURL string
+
+	// VisionDedupWindow enables frame deduplication: a frame identical to
+	// the last one processed within this window reuses its observation
+	// instead of calling the ML and sentience services. Zero disables it.
+	VisionDedupWindow time.Duration
+
+	// VisionLabelAllowList restricts the CLIP labels forwarded to clients
+	// and the sentience service. Empty allows every label.
+	VisionLabelAllowList []string
+
+	// VisionMaxPixels rejects vision frames whose header declares more
+	// pixels than this, before a small file that decodes to an enormous
+	// image reaches the ML service. Zero disables the check.
+	VisionMaxPixels int
+
+	// ReductionMethods are the reduce-dimensions methods the ML service is
+	// asked for; requests naming another get a 400. Requests without one
+	// use ReductionDefaultMethod.
+	ReductionMethods       []string
+	ReductionDefaultMethod string
+
+	// VisionEventEmbedding adds the raw CLIP embedding to vision.observation
+	// events for clients that project it themselves. Frames can override it
+	// with ?include_embedding=.
+	VisionEventEmbedding bool
+
+	// TopKContext is how many of the top CLIP labels go into the context
+	// string sent to the sentience service. Clients still get every label.
+	TopKContext int
+
+	// NormalizeEmbeddings L2-normalizes embeddings before they are added to
+	// the embeddings service. A ?normalize= request parameter overrides it.
+	NormalizeEmbeddings bool
+
+	// AffectWindow is how many recent frames the affect.trend moving average
+	// and variance cover.
+	AffectWindow int
+
+	// AffectTrendInterval is the minimum time between affect.trend events.
+	AffectTrendInterval time.Duration
+
+	// Webhooks receive broadcast events by HTTP POST, each from its own
+	// queue of WebhookQueue events.
+	Webhooks     []Webhook
+	WebhookQueue int
+
+	// MetricsPollInterval is how often the LLM service's consciousness
+	// metrics are fetched to broadcast consciousness.delta events. Zero
+	// disables polling.
+	MetricsPollInterval time.Duration
+
+	// JanitorInterval is how often stale cache entries are evicted in the
+	// background; zero leaves them until the caches are next used. SSE
+	// sessions not seen for SSESessionTTL are forgotten then, zero keeping
+	// them until maxSessions forces the oldest out.
+	JanitorInterval time.Duration
+	SSESessionTTL   time.Duration
+
+	// MetricsThresholds is how far a metric has to move from the value
+	// last reported before a delta is broadcast, per metric, with a
+	// "default" entry for metrics without their own threshold.
+	MetricsThresholds map[string]float64
+
+	// UpstreamEvents maps an origin name to a backend SSE endpoint whose
+	// events are relayed into /events, tagged with that origin.
+	UpstreamEvents map[string]string
+
+	// EventLogPath is a JSONL file every broadcast is appended to. Empty
+	// disables the event log.
+	EventLogPath string
+
+	// EventLogQueue is how many events may wait to be written to the event
+	// log before further ones are dropped.
+	EventLogQueue int
+
+	// EventLogCompress writes the event log gzip-compressed, flushed every
+	// EventLogFlushInterval so a crash loses at most that much of it.
+	EventLogCompress      bool
+	EventLogFlushInterval time.Duration
+
+	// H2C makes the server accept cleartext HTTP/2 in addition to HTTP/1.1.
+	H2C bool
+
+	// Server timeouts and header limit, so slow clients such as ones
+	// trickling headers cannot hold connections open indefinitely. The SSE
+	// stream opts out of the read and write timeouts and bounds each write
+	// with SSEWriteTimeout instead.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+
+	// APIKey guards the admin endpoints. It is a secret and must never be
+	// exposed in responses or logs.
+	APIKey string
+
+	// AdminAddr moves the admin endpoints off the public API onto their own
+	// listener, guarded by AdminToken instead of APIKey. Empty keeps them on
+	// the public API.
+	AdminAddr string
+
+	// AdminToken guards the admin listener. Like APIKey it is a secret.
+	AdminToken string
+
+	// sources records where LoadConfig took each setting from, by
+	// environment variable. It is empty for a Config built by hand.
+	sources map[string]settingSource
+}
+
+// LoadConfig reads the gateway settings from the environment, falling back
+// to defaults for anything unset or invalid. Settings in the file named by
+// CONFIG_FILE take precedence over the environment; unlike the
+// environment, the file can be edited and read again with Reload.
+func LoadConfig() Config {
+	return loadConfig(&configLoader{sources: make(map[string]settingSource), file: readConfigFile(os.Getenv("CONFIG_FILE"))})
+}
+
+// DefaultConfig returns the settings LoadConfig uses when the environment
+// sets none of them.
+func DefaultConfig() Config {
+	return loadConfig(&configLoader{sources: make(map[string]settingSource), defaultsOnly: true})
+}
+
+func loadConfig(l *configLoader) Config {
+	cfg := Config{
+		MemoryTimeout:              l.envDuration("MEMORY_TIMEOUT", 30*time.Second),
+		TimeoutMultiplier:          l.envFloat("TIMEOUT_MULTIPLIER", 1),
+		SpeechTimeout:              l.envDuration("SPEECH_TIMEOUT", 30*time.Second),
+		SSEWriteTimeout:            l.envDuration("SSE_WRITE_TIMEOUT", 10*time.Second),
+		SSEMaxLifetime:             l.envDuration("SSE_MAX_LIFETIME", 0),
+		SSEClientBuffer:            l.envInt("SSE_CLIENT_BUFFER", 16),
+		SSEHistorySize:             l.envInt("SSE_HISTORY_SIZE", 256),
+		SSEHistoryExclude:          l.envList("SSE_HISTORY_EXCLUDE", []string{"ping", "service.status"}),
+		SSEBroadcastWorkers:        l.envInt("SSE_BROADCAST_WORKERS", 1),
+		SSEBroadcastQueue:          l.envInt("SSE_BROADCAST_QUEUE", 0),
+		SSEReconnectLimit:          l.envInt("SSE_RECONNECT_LIMIT", 20),
+		SSEReconnectWindow:         l.envDuration("SSE_RECONNECT_WINDOW", 10*time.Second),
+		WSCompression:              l.envBool("WS_COMPRESSION", true),
+		WSBinaryThreshold:          l.envInt("WS_BINARY_THRESHOLD", 16<<10),
+		EmbeddingsBatchConcurrency: l.envInt("EMBEDDINGS_BATCH_CONCURRENCY", 4),
+		MaxInFlight:                l.envInt("MAX_IN_FLIGHT", 0),
+		PipelineErrorThreshold:     l.envFloatAllowZero("PIPELINE_ERROR_THRESHOLD", 0),
+		PipelineErrorWindow:        l.envDuration("PIPELINE_ERROR_WINDOW", 30*time.Second),
+		PipelineMinRequests:        l.envInt("PIPELINE_MIN_REQUESTS", 20),
+		StartupCheck:               l.envBool("STARTUP_CHECK", false),
+		StartupCheckTimeout:        l.envDuration("STARTUP_CHECK_TIMEOUT", 2*time.Second),
+		StartupCheckInterval:       l.envDuration("STARTUP_CHECK_INTERVAL", 5*time.Second),
+		StartupCritical:            l.envList("STARTUP_CRITICAL_SERVICES", nil),
+		StatusCheckJitter:          l.envDuration("STATUS_CHECK_JITTER", time.Second),
+		FanOutConcurrency:          l.envInt("FANOUT_CONCURRENCY", 0),
+		MLConcurrency:              l.envInt("ML_CONCURRENCY", 0),
+		MLQueueDepth:               l.envInt("ML_QUEUE_DEPTH", 32),
+		MLQueueTimeout:             l.envDuration("ML_QUEUE_TIMEOUT", 5*time.Second),
+		CORSAllowedMethods:         l.envList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+		CORSAllowedHeaders:         l.envList("CORS_ALLOWED_HEADERS", []string{"Content-Type", "Authorization", "Cache-Control"}),
+		CORSAllowedOrigins:         l.envList("CORS_ALLOWED_ORIGINS", []string{"*"}),
+		AllowCredentials:           l.envBool("ALLOW_CREDENTIALS", false),
+		MaxResponseBytes: map[string]int64{
+			"default":         l.envInt64("MAX_RESPONSE_BYTES", 16<<20),
+			serviceSentience:  l.envInt64("MAX_RESPONSE_BYTES_SENTIENCE", 64<<20),
+			serviceEmbeddings: l.envInt64("MAX_RESPONSE_BYTES_EMBEDDINGS", 64<<20),
+		},
+		LLMAttempts:            l.envInt("LLM_ATTEMPTS", 2),
+		ProxyRetries:           l.envInt("PROXY_RETRIES", 1),
+		RetryBodyLimit:         l.envInt("RETRY_BODY_LIMIT", 1<<20),
+		DegradedThoughts:       l.envBool("DEGRADED_THOUGHTS", false),
+		StrictJSON:             l.envBool("STRICT_JSON", true),
+		MaxEventHops:           l.envInt("MAX_EVENT_HOPS", 3),
+		MLFallbackURL:          l.envString("ML_FALLBACK_URL", ""),
+		ServiceURLs:            l.envPairs("SERVICE_URLS"),
+		SyntheticEmbeddingsURL: l.envString("SYNTHETIC_EMBEDDINGS_URL", ""),
+		VisionDedupWindow:      l.envDuration("VISION_DEDUP_WINDOW", 0),
+		VisionLabelAllowList:   l.envList("VISION_LABEL_ALLOWLIST", nil),
+		VisionMaxPixels:        l.envIntAllowZero("VISION_MAX_PIXELS", 40_000_000),
+		VisionEventEmbedding:   l.envBool("VISION_EVENT_EMBEDDING", false),
+		ReductionMethods:       l.envList("REDUCTION_METHODS", []string{"pca", "tsne", "umap"}),
+		ReductionDefaultMethod: l.envString("REDUCTION_DEFAULT_METHOD", "pca"),
+		TopKContext:            l.envInt("TOPK_CONTEXT", 3),
+		NormalizeEmbeddings:    l.envBool("NORMALIZE_EMBEDDINGS", false),
+		AffectWindow:           l.envInt("AFFECT_WINDOW", 20),
+		AffectTrendInterval:    l.envDuration("AFFECT_TREND_INTERVAL", time.Second),
+		Webhooks:               l.envWebhooks("WEBHOOKS"),
+		WebhookQueue:           l.envInt("WEBHOOK_QUEUE", 256),
+		MetricsPollInterval:    l.envDuration("METRICS_POLL_INTERVAL", 0),
+		JanitorInterval:        l.envDurationAllowZero("JANITOR_INTERVAL", time.Minute),
+		SSESessionTTL:          l.envDurationAllowZero("SSE_SESSION_TTL", time.Hour),
+		MetricsThresholds:      l.envThresholds("METRICS_DELTA_THRESHOLDS", l.envFloat("METRICS_DELTA_THRESHOLD", 0.05)),
+		UpstreamEvents:         l.envPairs("UPSTREAM_EVENTS"),
+		EventLogPath:           l.envString("EVENT_LOG_PATH", ""),
+		EventLogQueue:          l.envInt("EVENT_LOG_QUEUE", 1024),
+		EventLogCompress:       l.envBool("EVENT_LOG_COMPRESS", false),
+		EventLogFlushInterval:  l.envDuration("EVENT_LOG_FLUSH_INTERVAL", time.Second),
+		H2C:                    l.envBool("H2C", false),
+		ReadHeaderTimeout:      l.envDuration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:            l.envDuration("SERVER_READ_TIMEOUT", time.Minute),
+		WriteTimeout:           l.envDuration("SERVER_WRITE_TIMEOUT", 5*time.Minute),
+		IdleTimeout:            l.envDuration("SERVER_IDLE_TIMEOUT", 2*time.Minute),
+		MaxHeaderBytes:         l.envInt("SERVER_MAX_HEADER_BYTES", 64<<10),
+		APIKey:                 l.envSecret("API_KEY"),
+		AdminAddr:              l.envString("ADMIN_ADDR", ""),
+		AdminToken:             l.envSecret("ADMIN_TOKEN"),
+	}
+	if cfg.AllowCredentials && slices.Contains(cfg.CORSAllowedOrigins, "*") {
+		log.Printf("ALLOW_CREDENTIALS cannot be combined with a * in CORS_ALLOWED_ORIGINS, disabling credentials")
+		cfg.AllowCredentials = record(l, "ALLOW_CREDENTIALS", false, false)
+	}
+	cfg.sources = l.sources
+	return cfg
+}
+
+// withDefaults returns c with the settings that have no meaning at zero,
+// such as timeouts, buffer sizes and concurrency caps, taken from
+// DefaultConfig when unset, so a Config built by hand with only the
+// settings of interest still works. Settings where zero disables a feature
+// are left as they are.
+func (c Config) withDefaults() Config {
+	def := DefaultConfig()
+	fill(&c.MemoryTimeout, def.MemoryTimeout)
+	fill(&c.TimeoutMultiplier, def.TimeoutMultiplier)
+	fill(&c.SpeechTimeout, def.SpeechTimeout)
+	fill(&c.SSEWriteTimeout, def.SSEWriteTimeout)
+	fill(&c.SSEClientBuffer, def.SSEClientBuffer)
+	fill(&c.SSEHistorySize, def.SSEHistorySize)
+	fill(&c.SSEBroadcastWorkers, def.SSEBroadcastWorkers)
+	fill(&c.SSEReconnectLimit, def.SSEReconnectLimit)
+	fill(&c.SSEReconnectWindow, def.SSEReconnectWindow)
+	fill(&c.EmbeddingsBatchConcurrency, def.EmbeddingsBatchConcurrency)
+	fill(&c.PipelineErrorWindow, def.PipelineErrorWindow)
+	fill(&c.PipelineMinRequests, def.PipelineMinRequests)
+	fill(&c.StartupCheckTimeout, def.StartupCheckTimeout)
+	fill(&c.StartupCheckInterval, def.StartupCheckInterval)
+	fill(&c.MLQueueTimeout, def.MLQueueTimeout)
+	if c.CORSAllowedMethods == nil {
+		c.CORSAllowedMethods = def.CORSAllowedMethods
+	}
+	if c.CORSAllowedHeaders == nil {
+		c.CORSAllowedHeaders = def.CORSAllowedHeaders
+	}
+	if c.CORSAllowedOrigins == nil {
+		c.CORSAllowedOrigins = def.CORSAllowedOrigins
+	}
+	if c.MaxResponseBytes == nil {
+		c.MaxResponseBytes = def.MaxResponseBytes
+	}
+	fill(&c.LLMAttempts, def.LLMAttempts)
+	fill(&c.RetryBodyLimit, def.RetryBodyLimit)
+	fill(&c.MaxEventHops, def.MaxEventHops)
+	if c.ReductionMethods == nil {
+		c.ReductionMethods = def.ReductionMethods
+	}
+	fill(&c.ReductionDefaultMethod, def.ReductionDefaultMethod)
+	fill(&c.TopKContext, def.TopKContext)
+	fill(&c.AffectWindow, def.AffectWindow)
+	fill(&c.AffectTrendInterval, def.AffectTrendInterval)
+	fill(&c.WebhookQueue, def.WebhookQueue)
+	fill(&c.EventLogQueue, def.EventLogQueue)
+	fill(&c.EventLogFlushInterval, def.EventLogFlushInterval)
+	if c.MetricsThresholds == nil {
+		c.MetricsThresholds = def.MetricsThresholds
+	}
+	return c
+}
+
+// fill sets *dst to def when it is the zero value.
+func fill[T comparable](dst *T, def T) {
+	var zero T
+	if *dst == zero {
+		*dst = def
+	}
+}
+
+// Where a setting's effective value came from.
+const (
+	sourceEnv     = "env"
+	sourceFile    = "file"
+	sourceDefault = "default"
+)
+
+// settingSource is a setting's effective value and where it came from.
+// Secrets only report whether they are set.
+type settingSource struct {
+	Value  any
+	Source string
+	Secret bool
+}
+
+func (s settingSource) MarshalJSON() ([]byte, error) {
+	if s.Secret {
+		return json.Marshal(map[string]any{"set": s.Source != sourceDefault, "source": s.Source})
+	}
+	return json.Marshal(map[string]any{"value": s.Value, "source": s.Source})
+}
+
+// configLoader reads settings from the environment and records where each
+// one came from, for the admin config sources endpoint. A value that is
+// set but invalid falls back to its default and is reported as such.
+type configLoader struct {
+	sources map[string]settingSource
+
+	// file holds the settings read from CONFIG_FILE
+	file map[string]string
+
+	// defaultsOnly ignores the environment, for DefaultConfig
+	defaultsOnly bool
+}
+
+// getenv returns the value of key, from the config file if it sets it.
+func (l *configLoader) getenv(key string) string {
+	if l.defaultsOnly {
+		return ""
+	}
+	if v, ok := l.file[key]; ok {
+		return v
+	}
+	return os.Getenv(key)
+}
+
+// origin is the source reported for a setting that is set.
+func (l *configLoader) origin(key string) string {
+	if _, ok := l.file[key]; ok {
+		return sourceFile
+	}
+	return sourceEnv
+}
+
+// readConfigFile reads KEY=VALUE lines from path, in the format of
+// .env.example: blank lines and lines starting with # are skipped. An
+// unreadable file is logged and treated as empty.
+func readConfigFile(path string) map[string]string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("invalid CONFIG_FILE: %v", err)
+		return nil
+	}
+	settings := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			log.Printf("invalid CONFIG_FILE line %q, expected KEY=VALUE", line)
+			continue
+		}
+		settings[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return settings
+}
+
+// record notes the effective value of key and returns it.
+func record[T any](l *configLoader, key string, value T, fromEnv bool) T {
+	src := settingSource{Value: value, Source: sourceDefault}
+	if d, ok := any(value).(time.Duration); ok {
+		src.Value = d.String()
+	}
+	if fromEnv {
+		src.Source = l.origin(key)
+	}
+	l.sources[key] = src
+	return value
+}
+
+// envSecret reads a secret, recording only whether it is set.
+func (l *configLoader) envSecret(key string) string {
+	v := l.getenv(key)
+	source := sourceDefault
+	if v != "" {
+		source = l.origin(key)
+	}
+	l.sources[key] = settingSource{Source: source, Secret: true}
+	return v
+}
+
+func (l *configLoader) envString(key, def string) string {
+	v := l.getenv(key)
+	if v == "" {
+		return record(l, key, def, false)
+	}
+	return record(l, key, v, true)
+}
+
+func (l *configLoader) envList(key string, def []string) []string {
+	v := l.getenv(key)
+	if v == "" {
+		return record(l, key, def, false)
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	if len(list) == 0 {
+		return record(l, key, def, false)
+	}
+	return record(l, key, list, true)
+}
+
+// envPairs reads a comma-separated list of name=value pairs.
+func (l *configLoader) envPairs(key string) map[string]string {
+	pairs := make(map[string]string)
+	for _, item := range l.envList(key, nil) {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+			log.Printf("invalid %s entry %q, expected name=value", key, item)
+			continue
+		}
+		pairs[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return record(l, key, pairs, len(pairs) > 0)
+}
+
+// envThresholds reads name=value pairs of non-negative numbers, adding def
+// as the "default" entry unless one is given. An invalid entry is dropped,
+// so its name falls back to the default.
+func (l *configLoader) envThresholds(key string, def float64) map[string]float64 {
+	thresholds := map[string]float64{"default": def}
+	fromEnv := false
+	for name, value := range l.envPairs(key) {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+			log.Printf("invalid %s entry %s=%q, using the default threshold", key, name, value)
+			continue
+		}
+		thresholds[name] = f
+		fromEnv = true
+	}
+	return record(l, key, thresholds, fromEnv)
+}
+
+// envWebhooks reads a JSON array of webhooks. Entries without a URL are
+// skipped. Webhook URLs often embed a token, so like the signing secrets
+// they are only recorded as set or not.
+func (l *configLoader) envWebhooks(key string) []Webhook {
+	l.sources[key] = settingSource{Source: sourceDefault, Secret: true}
+	v := l.getenv(key)
+	if v == "" {
+		return nil
+	}
+	var hooks []Webhook
+	if err := json.Unmarshal([]byte(v), &hooks); err != nil {
+		log.Printf("invalid %s: %v", key, err)
+		return nil
+	}
+	valid := hooks[:0]
+	for _, hook := range hooks {
+		if hook.URL == "" {
+			log.Printf("invalid %s entry without url, skipping", key)
+			continue
+		}
+		valid = append(valid, hook)
+	}
+	if len(valid) > 0 {
+		l.sources[key] = settingSource{Source: l.origin(key), Secret: true}
+	}
+	return valid
+}
+
+func (l *configLoader) envBool(key string, def bool) bool {
+	v := l.getenv(key)
+	if v == "" {
+		return record(l, key, def, false)
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("invalid %s=%q, using default %t", key, v, def)
+		return record(l, key, def, false)
+	}
+	return record(l, key, b, true)
+}
+
+func (l *configLoader) envInt(key string, def int) int {
+	v := l.getenv(key)
+	if v == "" {
+		return record(l, key, def, false)
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("invalid %s=%q, using default %d", key, v, def)
+		return record(l, key, def, false)
+	}
+	return record(l, key, n, true)
+}
+
+// envIntAllowZero is envInt for settings where zero turns a feature off.
+func (l *configLoader) envIntAllowZero(key string, def int) int {
+	v := l.getenv(key)
+	if v == "" {
+		return record(l, key, def, false)
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("invalid %s=%q, using default %d", key, v, def)
+		return record(l, key, def, false)
+	}
+	return record(l, key, n, true)
+}
+
+func (l *configLoader) envInt64(key string, def int64) int64 {
+	v := l.getenv(key)
+	if v == "" {
+		return record(l, key, def, false)
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		log.Printf("invalid %s=%q, using default %d", key, v, def)
+		return record(l, key, def, false)
+	}
+	return record(l, key, n, true)
+}
+
+func (l *configLoader) envFloat(key string, def float64) float64 {
+	v := l.getenv(key)
+	if v == "" {
+		return record(l, key, def, false)
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		log.Printf("invalid %s=%q, using default %g", key, v, def)
+		return record(l, key, def, false)
+	}
+	return record(l, key, f, true)
+}
+
+// envFloatAllowZero is envFloat for settings where zero turns a feature
+// off.
+func (l *configLoader) envFloatAllowZero(key string, def float64) float64 {
+	v := l.getenv(key)
+	if v == "" {
+		return record(l, key, def, false)
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		log.Printf("invalid %s=%q, using default %g", key, v, def)
+		return record(l, key, def, false)
+	}
+	return record(l, key, f, true)
+}
+
+func (l *configLoader) envDuration(key string, def time.Duration) time.Duration {
+	v := l.getenv(key)
+	if v == "" {
+		return record(l, key, def, false)
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("invalid %s=%q, using default %s", key, v, def)
+		return record(l, key, def, false)
+	}
+	return record(l, key, d, true)
+}
+
+// envDurationAllowZero is envDuration for settings where zero turns a
+// feature off.
+func (l *configLoader) envDurationAllowZero(key string, def time.Duration) time.Duration {
+	v := l.getenv(key)
+	if v == "" {
+		return record(l, key, def, false)
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("invalid %s=%q, using default %s", key, v, def)
+		return record(l, key, def, false)
+	}
+	return record(l, key, d, true)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// correlation ties together the events one ingestion broadcasts, such as a
+// frame's vision.observation, its sentience.token and its pipeline.trace.
+// Each is tagged "correlation_id", the ingestion's embedding ID, and
+// "correlation_seq", counting from 1 in the order they were broadcast.
+// Events from one ingestion are broadcast one after another, inline or
+// through the broadcast queue, so every client gets them in that order;
+// the tags let clients regroup them when other frames' events arrive in
+// between, and spot a missing one by a gap in correlation_seq.
+type correlation struct {
+	id  string
+	seq atomic.Uint64
+}
+
+type correlationKey struct{}
+
+// withCorrelation starts a correlation for the events broadcast while
+// serving a request with ctx.
+func withCorrelation(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, &correlation{id: id})
+}
+
+// correlationFrom returns the correlation of ctx, or nil when there is
+// none.
+func correlationFrom(ctx context.Context) *correlation {
+	c, _ := ctx.Value(correlationKey{}).(*correlation)
+	return c
+}
+
+// tag inserts the correlation fields at the start of a JSON event, taking
+// the next correlation_seq. A nil correlation returns data unchanged.
+func (c *correlation) tag(data string) string {
+	if c == nil {
+		return data
+	}
+	id, _ := json.Marshal(c.id)
+	return prependField(data, fmt.Sprintf(`"correlation_id":%s,"correlation_seq":%d`, id, c.seq.Add(1)))
+}
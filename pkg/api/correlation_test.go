@@ -0,0 +1,129 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInterleavedFramesKeepCorrelatedOrder(t *testing.T) {
+	for _, queue := range []int{0, 64} {
+		t.Run(fmt.Sprintf("broadcast queue %d", queue), func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{SSEBroadcastQueue: queue})
+			// The second frame comes back without an embedding, so its run
+			// goes ahead with a warning that belongs to that frame alone
+			stubService(t, g, serviceML, func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				resp := clipResponse
+				if strings.Contains(string(body), "c2Vjb25k") {
+					resp = strings.Replace(clipResponse, "[0.1,0.2,0.3]", "[0,0,0]", 1)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(resp))
+			})
+
+			// The first frame's sentience run is held until the second
+			// frame's token has been delivered, so their events interleave
+			held, release := make(chan struct{}), make(chan struct{})
+			var once sync.Once
+			unblock := func() { once.Do(func() { close(release) }) }
+			var runs atomic.Int32
+			stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				if runs.Add(1) == 1 {
+					close(held)
+					<-release
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(runResponse))
+			})
+			// A failed test must not leave the first run holding up the server
+			t.Cleanup(unblock)
+			stream := openSSE(t, srv.URL+"/events", nil)
+			stream.expect("connection")
+
+			done := make(chan int, 2)
+			post := func(frame string) {
+				resp, err := http.Post(srv.URL+"/api/vision/frame", "application/json", strings.NewReader(frame))
+				if err != nil {
+					done <- 0
+					return
+				}
+				resp.Body.Close()
+				done <- resp.StatusCode
+			}
+			go post(`{"image_base64":"Zmlyc3Q="}`)
+			first := stream.next()
+			for first["type"] != "vision.observation" {
+				first = stream.next()
+			}
+			<-held
+			go post(`{"image_base64":"c2Vjb25k"}`)
+
+			// Collect every event until both frames are done
+			firstID := first["correlation_id"].(string)
+			byFrame := map[string][]map[string]any{firstID: {first}}
+			order := []string{firstID}
+			var tokens []string
+			for len(tokens) < 2 {
+				ev := stream.next()
+				id, _ := ev["correlation_id"].(string)
+				if id == "" {
+					continue
+				}
+				if _, ok := byFrame[id]; !ok {
+					order = append(order, id)
+				}
+				byFrame[id] = append(byFrame[id], ev)
+				if ev["type"] == "sentience.token" {
+					tokens = append(tokens, id)
+					// The first frame's run finishes once the second's token is out
+					unblock()
+				}
+			}
+			for range 2 {
+				if status := <-done; status != http.StatusOK {
+					t.Fatalf("frame status %d, want 200", status)
+				}
+			}
+
+			if len(order) != 2 {
+				t.Fatalf("got correlation ids %v, want one per frame", order)
+			}
+			// The second frame's token arrives before the first frame's
+			if want := []string{order[1], order[0]}; !slices.Equal(tokens, want) {
+				t.Errorf("tokens arrived for %v, want %v", tokens, want)
+			}
+			for _, id := range order {
+				events := byFrame[id]
+				var types []string
+				for i, ev := range events {
+					types = append(types, ev["type"].(string))
+					if ev["correlation_seq"] != float64(i+1) {
+						t.Errorf("%s event %d has correlation_seq %v, want %d", id, i, ev["correlation_seq"], i+1)
+					}
+					if ev["embedding_id"] != nil && ev["type"] == "vision.observation" && ev["embedding_id"] != id {
+						t.Errorf("observation embedding_id %v, want the correlation id %s", ev["embedding_id"], id)
+					}
+				}
+				obs, token := slices.Index(types, "vision.observation"), slices.Index(types, "sentience.token")
+				if obs != 0 || token <= obs {
+					t.Errorf("%s events %v, want the observation first and then its token", id, types)
+				}
+				// Only the second frame's warning carries its correlation
+				warning := slices.Index(types, "pipeline.warning")
+				if id == order[1] && (warning <= obs || warning >= token) {
+					t.Errorf("%s events %v, want its warning between the observation and the token", id, types)
+				}
+				if id == order[0] && warning >= 0 {
+					t.Errorf("%s events %v, want no warning for the first frame", id, types)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// RequiredHeaders lists the request headers the gateway's own handlers
+// depend on. The CORS middleware always allows them, whatever is configured.
+var RequiredHeaders = []string{"Content-Type", "Authorization", "X-API-Key", "X-JSON-Decode", "Content-Encoding", "X-Deadline-Ms", "X-Request-ID", "X-Dry-Run", "X-Synthetic"}
+
+var (
+	routeMethodsMu sync.RWMutex
+	routeMethods   = map[string][]string{}
+)
+
+// handle registers h on mux and records the methods it accepts so CORS
+// preflight responses can advertise them per route. Requests are traced,
+// a ?force query makes the handler's downstream calls skip the
+// offline-service fast path, an X-Deadline-Ms header bounds them, and an
+// X-Synthetic header marks them as test traffic.
+// Routes that accept GET also answer HEAD, except for the event streams.
+func handle(mux *http.ServeMux, pattern string, h http.HandlerFunc, methods ...string) {
+	methods = headMethods(pattern, methods)
+	routeMethodsMu.Lock()
+	routeMethods[pattern] = append(methods, http.MethodOptions)
+	routeMethodsMu.Unlock()
+	if slices.Contains(methods, http.MethodHead) {
+		h = WithHead(h)
+	}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// Handlers take HEAD for GET, which for a stream would hold the
+		// connection open with nothing to send
+		if r.Method == http.MethodHead && !slices.Contains(methods, http.MethodHead) {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Query().Has("force") {
+			r = r.WithContext(withForce(r.Context()))
+		}
+		if syntheticRequest(r) {
+			r = r.WithContext(withSynthetic(r.Context()))
+		}
+		if v := r.Header.Get("X-Deadline-Ms"); v != "" {
+			ctx, cancel, err := withClientDeadline(r.Context(), v)
+			if err != nil {
+				http.Error(w, "bad request: invalid X-Deadline-Ms", http.StatusBadRequest)
+				return
+			}
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		h(w, r)
+	}
+	// SSE and WebSocket connections live for hours, which makes them
+	// useless as spans; the tracing wrapper would also hide the Hijacker
+	if !slices.Contains(streamPatterns, pattern) {
+		handler = traced(pattern, handler)
+	}
+	mux.HandleFunc(pattern, handler)
+}
+
+// AllowedMethods returns the methods registered for a mux pattern, or nil
+// when the pattern was not registered by this package.
+func AllowedMethods(pattern string) []string {
+	routeMethodsMu.RLock()
+	defer routeMethodsMu.RUnlock()
+	return routeMethods[pattern]
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestAllowedMethodsPerRoute(t *testing.T) {
+	newTestGateway(t, Config{})
+
+	for pattern, want := range map[string][]string{
+		"/api/embeddings/batch": {http.MethodPost, http.MethodOptions},
+		"/api/embeddings":       {http.MethodGet, http.MethodHead, http.MethodOptions},
+		"/events":               {http.MethodGet, http.MethodOptions},
+	} {
+		if got := AllowedMethods(pattern); !slices.Equal(got, want) {
+			t.Errorf("AllowedMethods(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+	if got := AllowedMethods("/not/registered"); got != nil {
+		t.Errorf("AllowedMethods of an unregistered pattern = %v, want nil", got)
+	}
+}
+
+func TestAllowCredentialsRejectsWildcardOrigin(t *testing.T) {
+	for _, tt := range []struct {
+		origins string
+		want    bool
+	}{
+		{"https://app.example.com,http://localhost:3000", true},
+		{"*", false},
+		{"https://app.example.com,*", false},
+	} {
+		t.Setenv("ALLOW_CREDENTIALS", "true")
+		t.Setenv("CORS_ALLOWED_ORIGINS", tt.origins)
+		cfg := LoadConfig()
+		if cfg.AllowCredentials != tt.want {
+			t.Errorf("origins %q: AllowCredentials %t, want %t", tt.origins, cfg.AllowCredentials, tt.want)
+		}
+		if src := cfg.sources["ALLOW_CREDENTIALS"]; !tt.want && src.Source != sourceDefault {
+			t.Errorf("origins %q: ALLOW_CREDENTIALS reported from %s, want it reported as the default", tt.origins, src.Source)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// limitRequestBody caps the request body at maxSize bytes. Gzip-encoded
+// bodies are decompressed transparently and the cap applies to the
+// decompressed size, so a small compressed upload cannot expand without
+// bound.
+func limitRequestBody(w http.ResponseWriter, r *http.Request, maxSize int64) error {
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return err
+		}
+		r.Body = &gzipBody{Reader: zr, body: r.Body}
+		r.Header.Del("Content-Encoding")
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	return nil
+}
+
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// Errors from readJSONBody.
+var (
+	errBodyRequired = errors.New("request body is required")
+	errBodyNotJSON  = errors.New("request body is not valid JSON")
+)
+
+// readJSONBody reads a body that is forwarded as is, so a missing or
+// malformed one gets a clear 400 here instead of a confusing error from the
+// downstream service. An empty body is accepted unless required.
+func readJSONBody(r *http.Request, required bool) ([]byte, error) {
+	var body []byte
+	if r.Body != nil {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if required {
+			return nil, errBodyRequired
+		}
+		return nil, nil
+	}
+	if !json.Valid(body) {
+		return nil, errBodyNotJSON
+	}
+	return body, nil
+}
+
+// writeBodyError responds 400 for a body readJSONBody refused.
+func writeBodyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errBodyRequired) || errors.Is(err, errBodyNotJSON) {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Failed to read request body", http.StatusBadRequest)
+}
+
+// errJSONTooDeep is returned by limitJSONDepth for bodies nested deeper than
+// allowed.
+var errJSONTooDeep = errors.New("json: nesting too deep")
+
+// limitJSONDepth reads the request body and rejects it when its objects and
+// arrays nest deeper than maxDepth, before it is decoded into Go values.
+// The body is replaced so it can still be decoded afterwards.
+func limitJSONDepth(r *http.Request, maxDepth int) error {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// Leave syntax errors for the real decode to report
+			return nil
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			if depth++; depth > maxDepth {
+				return errJSONTooDeep
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+// decodeJSON decodes the request body into v. In strict mode unknown fields
+// are rejected so client typos surface instead of being silently ignored.
+// Strict mode comes from config and can be overridden per request with an
+// X-JSON-Decode header of "strict" or "lenient".
+func (g *Gateway) decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+
+	strict := g.config().StrictJSON
+	switch strings.ToLower(r.Header.Get("X-JSON-Decode")) {
+	case "strict":
+		strict = true
+	case "lenient":
+		strict = false
+	}
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(v)
+}
+
+// writeDecodeError responds 400 to a body that failed to decode, naming the
+// unexpected field when strict decoding rejected one or saying the body
+// nests too deeply. Bodies over the size limit get a 413.
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if errors.Is(err, errJSONTooDeep) {
+		http.Error(w, "bad request: JSON nesting too deep", http.StatusBadRequest)
+		return
+	}
+
+	const prefix = "json: unknown field "
+	if err != nil && strings.HasPrefix(err.Error(), prefix) {
+		http.Error(w, "bad request: unknown field "+strings.TrimPrefix(err.Error(), prefix), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "bad request", http.StatusBadRequest)
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// typoFrame is a valid frame that also carries a misspelt field.
+const typoFrame = `{"image_base64":"aGVsbG8=","cameraId":"front"}`
+
+func TestStrictJSONByDefault(t *testing.T) {
+	if !LoadConfig().StrictJSON {
+		t.Error("StrictJSON off without STRICT_JSON set, want it on")
+	}
+	t.Setenv("STRICT_JSON", "false")
+	if LoadConfig().StrictJSON {
+		t.Error("StrictJSON on with STRICT_JSON=false")
+	}
+}
+
+func TestUnknownFieldAllowedWhenLenient(t *testing.T) {
+	g, srv := newTestGateway(t, Config{StrictJSON: false})
+	stubPipeline(t, g, defaultPipeline())
+
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", typoFrame); resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d for an unknown field in lenient mode, want 200: %s", resp.StatusCode, body)
+	}
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", typoFrame, "X-JSON-Decode", "strict")
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, `"cameraId"`) {
+		t.Errorf("status %d %q with X-JSON-Decode: strict, want a 400 naming cameraId", resp.StatusCode, body)
+	}
+}
+
+func TestUnknownFieldRejectedInStrictMode(t *testing.T) {
+	g, srv := newTestGateway(t, Config{StrictJSON: true})
+	calls := stubPipeline(t, g, defaultPipeline())
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", typoFrame)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, `"cameraId"`) {
+		t.Errorf("status %d %q in strict mode, want a 400 naming cameraId", resp.StatusCode, body)
+	}
+	if clip := calls.get("/infer/clip"); len(clip) != 0 {
+		t.Errorf("rejected frame still reached the ML service")
+	}
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", typoFrame, "X-JSON-Decode", "lenient"); resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d with X-JSON-Decode: lenient, want 200: %s", resp.StatusCode, body)
+	}
+}
+
+// gzipped compresses s.
+func gzipped(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestGzipFrameDecodesLikePlainFrame(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	calls := stubPipeline(t, g, defaultPipeline())
+	const frame = `{"image_base64":"aGVsbG8=","camera_id":"front"}`
+
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", frame); resp.StatusCode != http.StatusOK {
+		t.Fatalf("plain frame: status %d, want 200: %s", resp.StatusCode, body)
+	}
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", gzipped(t, frame), "Content-Encoding", "gzip"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("gzip frame: status %d, want 200: %s", resp.StatusCode, body)
+	}
+
+	clip := calls.get("/infer/clip")
+	if len(clip) != 2 || clip[0] != clip[1] {
+		t.Errorf("ML service got %q, want the same request for both frames", clip)
+	}
+	observations := recordedEvents(t, g, "vision.observation")
+	if len(observations) != 2 || observations[0]["camera_id"] != observations[1]["camera_id"] {
+		t.Errorf("observations %v, want two alike", observations)
+	}
+}
+
+func TestGzipBombIsRejected(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	calls := stubPipeline(t, g, defaultPipeline())
+	bomb := gzipped(t, `{"image_base64":"`+strings.Repeat("A", maxFrameBytes+1)+`"}`)
+	if len(bomb) >= maxFrameBytes/100 {
+		t.Fatalf("bomb is %d bytes compressed, want it far under the limit", len(bomb))
+	}
+
+	resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", bomb, "Content-Encoding", "gzip")
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d for a body that decompresses past the limit, want 413", resp.StatusCode)
+	}
+	if clip := calls.get("/infer/clip"); len(clip) != 0 {
+		t.Error("decompression bomb reached the ML service")
+	}
+
+	resp, _ = doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", "not gzip", "Content-Encoding", "gzip")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status %d for a body that is not gzip, want 400", resp.StatusCode)
+	}
+}
+
+func TestProxiedPostsValidateBody(t *testing.T) {
+	tests := []struct {
+		path     string
+		body     string
+		want     int
+		reaching bool
+	}{
+		{"/api/ego/reflect", "", http.StatusBadRequest, false},
+		{"/api/ego/reflect", "  \n", http.StatusBadRequest, false},
+		{"/api/ego/reflect", `{"thought":`, http.StatusBadRequest, false},
+		{"/api/ego/reflect", `{"prompt":"hi"}`, http.StatusOK, true},
+		{"/api/ego/clear-ltm", "", http.StatusBadRequest, false},
+		{"/api/ego/clear-ltm", "not json", http.StatusBadRequest, false},
+		{"/api/ego/clear-ltm", `{"confirm":true}`, http.StatusOK, true},
+		{"/api/embeddings/add", "", http.StatusBadRequest, false},
+		{"/api/embeddings/add", `{"id":"e1",`, http.StatusBadRequest, false},
+		// Consolidation takes no parameters, so its body may be empty
+		{"/api/ego/consolidate", "", http.StatusOK, true},
+		{"/api/ego/consolidate", "{oops", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+strconv.Quote(tt.body), func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			var calls atomic.Int64
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"ok":true}`))
+			}
+			stubService(t, g, serviceEgo, handler)
+			stubService(t, g, serviceEmbeddings, handler)
+
+			resp, body := doRequest(t, http.MethodPost, srv.URL+tt.path, tt.body)
+			if resp.StatusCode != tt.want {
+				t.Errorf("status %d %s, want %d", resp.StatusCode, body, tt.want)
+			}
+			if reached := calls.Load() > 0; reached != tt.reaching {
+				t.Errorf("downstream reached %t, want %t", reached, tt.reaching)
+			}
+			if tt.want == http.StatusBadRequest && !strings.HasPrefix(body, "bad request: ") {
+				t.Errorf("body %q, want a clean bad request message", body)
+			}
+		})
+	}
+}
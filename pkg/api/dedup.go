@@ -0,0 +1,68 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"time"
+)
+
+// lastFrame remembers the most recently processed vision frame so identical
+// frames arriving within the dedup window can reuse its observation.
+type lastFrame struct {
+	hash        [sha256.Size]byte
+	cameraID    string
+	processedAt time.Time
+	topK        []scoredLabel
+}
+
+// frameHash hashes the decoded image bytes of a frame. Data URL prefixes
+// are ignored, and a frame that is not valid base64 is hashed as sent.
+func frameHash(imageBase64 string) [sha256.Size]byte {
+	data := imageBase64
+	if i := strings.Index(data, ";base64,"); i >= 0 && strings.HasPrefix(data, "data:") {
+		data = data[i+len(";base64,"):]
+	}
+	if raw, err := base64.StdEncoding.DecodeString(data); err == nil {
+		return sha256.Sum256(raw)
+	}
+	return sha256.Sum256([]byte(imageBase64))
+}
+
+// cachedObservation returns the labels of the last processed frame when it
+// had the same hash, came from the same camera and was processed within the
+// dedup window.
+func (g *Gateway) cachedObservation(hash [sha256.Size]byte, cameraID string) ([]scoredLabel, bool) {
+	g.frameMu.Lock()
+	defer g.frameMu.Unlock()
+	if g.lastFrame.hash != hash || g.lastFrame.cameraID != cameraID || time.Since(g.lastFrame.processedAt) > g.config().VisionDedupWindow {
+		return nil, false
+	}
+	return g.lastFrame.topK, true
+}
+
+// rememberFrame records a frame that went through the full pipeline.
+func (g *Gateway) rememberFrame(hash [sha256.Size]byte, cameraID string, topK []scoredLabel) {
+	g.frameMu.Lock()
+	defer g.frameMu.Unlock()
+	g.lastFrame = lastFrame{hash: hash, cameraID: cameraID, processedAt: time.Now(), topK: topK}
+}
+
+// forgetExpiredFrame drops the remembered frame once it was processed more
+// than window ago, when it can no longer be reused.
+func (g *Gateway) forgetExpiredFrame(window time.Duration) {
+	g.frameMu.Lock()
+	defer g.frameMu.Unlock()
+	if !g.lastFrame.processedAt.IsZero() && time.Since(g.lastFrame.processedAt) > window {
+		g.lastFrame = lastFrame{}
+	}
+}
+
+// forgetFrame drops the remembered frame, reporting whether there was one.
+func (g *Gateway) forgetFrame() bool {
+	g.frameMu.Lock()
+	defer g.frameMu.Unlock()
+	had := !g.lastFrame.processedAt.IsZero()
+	g.lastFrame = lastFrame{}
+	return had
+}
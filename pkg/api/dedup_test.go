@@ -0,0 +1,55 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDuplicateFrameSkipsPipeline(t *testing.T) {
+	g, srv := newTestGateway(t, Config{VisionDedupWindow: time.Minute})
+	calls := stubPipeline(t, g, defaultPipeline())
+
+	frames := []string{
+		`{"image_base64":"aGVsbG8="}`,
+		// The same image as a data URL
+		`{"image_base64":"data:image/jpeg;base64,aGVsbG8="}`,
+		// The same image from another camera goes through the pipeline
+		`{"image_base64":"aGVsbG8=","camera_id":"back"}`,
+	}
+	for _, frame := range frames {
+		if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", frame); resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+		}
+	}
+
+	if clip := calls.get("/infer/clip"); len(clip) != 2 {
+		t.Errorf("ML service called %d times, want 2", len(clip))
+	}
+	if runs := calls.get("/run"); len(runs) != 2 {
+		t.Errorf("sentience run called %d times, want 2", len(runs))
+	}
+	observations := recordedEvents(t, g, "vision.observation")
+	if len(observations) != 3 {
+		t.Fatalf("got %d observations, want 3", len(observations))
+	}
+	if observations[0]["cached"] != nil || observations[1]["cached"] != true || observations[2]["cached"] != nil {
+		t.Errorf("observations %v, want only the second marked cached", observations)
+	}
+	if first, second := observations[0]["clip_topk"], observations[1]["clip_topk"]; first == nil || fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Errorf("cached labels %v differ from the original %v", second, first)
+	}
+}
+
+func TestFrameDedupOffByDefault(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	calls := stubPipeline(t, g, defaultPipeline())
+
+	for range 2 {
+		doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", `{"image_base64":"aGVsbG8="}`)
+	}
+	if clip := calls.get("/infer/clip"); len(clip) != 2 {
+		t.Errorf("ML service called %d times without dedup, want 2", len(clip))
+	}
+}
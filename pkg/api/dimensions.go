@@ -0,0 +1,275 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dimensionStats summarizes the embedding dimensions present in a set of
+// embeddings.
+type dimensionStats struct {
+	Count      int   `json:"count"`
+	Dimensions []int `json:"dimensions"`
+	Consistent bool  `json:"consistent"`
+}
+
+// dimensionsOf summarizes a list of embedding lengths.
+func dimensionsOf(lengths []int) dimensionStats {
+	dims := []int{}
+	for _, n := range lengths {
+		if !slices.Contains(dims, n) {
+			dims = append(dims, n)
+		}
+	}
+	slices.Sort(dims)
+	return dimensionStats{Count: len(lengths), Dimensions: dims, Consistent: len(dims) <= 1}
+}
+
+// getEmbeddingsStats reports the distinct embedding dimensions stored in
+// the embeddings service, overall and per source, and flags mixed sets that
+// would break dimensionality reduction and plotting.
+func (g *Gateway) getEmbeddingsStats(w http.ResponseWriter, r *http.Request) {
+	resp, err := g.get(r.Context(), serviceEmbeddings, g.embeddingsURL(r.Context(), "/embeddings"), 10*time.Second)
+	if err != nil {
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		relay(w, resp)
+		return
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeStageError(w, "", serviceEmbeddings, err, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	var out struct {
+		Embeddings []struct {
+			Source    string    `json:"source"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"embeddings"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		g.countFailure(serviceEmbeddings, outcomeParseError)
+		writeStageError(w, "", serviceEmbeddings, nil, "embeddings parse error", http.StatusBadGateway)
+		return
+	}
+
+	var all []int
+	perSource := map[string][]int{}
+	for _, e := range out.Embeddings {
+		all = append(all, len(e.Embedding))
+		perSource[e.Source] = append(perSource[e.Source], len(e.Embedding))
+	}
+	bySource := map[string]dimensionStats{}
+	for source, lengths := range perSource {
+		bySource[source] = dimensionsOf(lengths)
+	}
+
+	stats := dimensionsOf(all)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"count":      stats.Count,
+		"dimensions": stats.Dimensions,
+		"consistent": stats.Consistent,
+		"by_source":  bySource,
+	})
+}
+
+// embeddingCount returns how many embeddings a reduce-dimensions request
+// carries.
+func embeddingCount(body []byte) int {
+	var in struct {
+		Embeddings []json.RawMessage `json:"embeddings"`
+	}
+	json.Unmarshal(body, &in)
+	return len(in.Embeddings)
+}
+
+// checkUniformDimensions rejects a reduce-dimensions request whose
+// embeddings differ in length. Bodies it cannot parse are left for the ML
+// service to reject.
+func checkUniformDimensions(body []byte) *ValidationError {
+	var in struct {
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	if json.Unmarshal(body, &in) != nil {
+		return nil
+	}
+
+	lengths := make([]int, len(in.Embeddings))
+	for i, e := range in.Embeddings {
+		lengths[i] = len(e)
+	}
+	stats := dimensionsOf(lengths)
+	if stats.Consistent {
+		return nil
+	}
+
+	dims := make([]string, len(stats.Dimensions))
+	for i, d := range stats.Dimensions {
+		dims[i] = strconv.Itoa(d)
+	}
+	var verr ValidationError
+	verr.Add("embeddings", "all embeddings must have the same dimension, got "+strings.Join(dims, ", "))
+	return &verr
+}
+
+// maxReductionComponents is the most dimensions a reduction may produce;
+// the frontend plots in two or three, and t-SNE cannot go past three.
+const maxReductionComponents = 3
+
+// checkReductionParams validates the parameters of a reduce-dimensions
+// request before it reaches the ML service, whose errors for them are hard
+// to read: method must be one of ReductionMethods and is set to
+// ReductionDefaultMethod when absent, n_components must be a whole number
+// from 1 to maxReductionComponents, and perplexity must be positive and
+// below the number of embeddings, as t-SNE requires. It returns the body to
+// forward. Bodies it cannot parse are left for the ML service to reject.
+func (g *Gateway) checkReductionParams(body []byte) ([]byte, *ValidationError) {
+	var in map[string]json.RawMessage
+	if json.Unmarshal(body, &in) != nil || in == nil {
+		return body, nil
+	}
+	cfg := g.config()
+	var verr ValidationError
+
+	_, hasMethod := in["method"]
+	if raw, ok := in["method"]; ok {
+		var method string
+		if json.Unmarshal(raw, &method) != nil || !slices.Contains(cfg.ReductionMethods, method) {
+			verr.Add("method", "must be one of "+strings.Join(cfg.ReductionMethods, ", "))
+		}
+	} else {
+		in["method"], _ = json.Marshal(cfg.ReductionDefaultMethod)
+	}
+
+	if raw, ok := in["n_components"]; ok {
+		var n float64
+		if json.Unmarshal(raw, &n) != nil || n != math.Trunc(n) || n < 1 || n > maxReductionComponents {
+			verr.Add("n_components", fmt.Sprintf("must be a whole number from 1 to %d", maxReductionComponents))
+		}
+	}
+
+	if raw, ok := in["perplexity"]; ok {
+		var perplexity float64
+		points := embeddingCount(body)
+		if json.Unmarshal(raw, &perplexity) != nil || !(perplexity > 0) || perplexity >= float64(points) {
+			verr.Add("perplexity", fmt.Sprintf("must be positive and less than the number of embeddings (%d)", points))
+		}
+	}
+
+	if verr.Err() != nil {
+		return nil, &verr
+	}
+	if !hasMethod {
+		body, _ = json.Marshal(in)
+	}
+	return body, nil
+}
+
+// checkReduction verifies a reduce-dimensions result has one point per
+// input embedding, each with n_components finite coordinates, so a broken
+// reduction is reported instead of silently breaking the frontend plot.
+func checkReduction(body []byte, points int) error {
+	var out struct {
+		Reduced     [][]*float64 `json:"reduced_embeddings"`
+		NComponents int          `json:"n_components"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		// Python's JSON encoder writes NaN and Infinity as bare tokens,
+		// which are not JSON at all
+		if bytes.Contains(body, []byte("NaN")) || bytes.Contains(body, []byte("Infinity")) {
+			return errors.New("coordinates are not finite")
+		}
+		return fmt.Errorf("unreadable result: %v", err)
+	}
+	if len(out.Reduced) != points {
+		return fmt.Errorf("got %d points for %d embeddings", len(out.Reduced), points)
+	}
+	for i, point := range out.Reduced {
+		if out.NComponents > 0 && len(point) != out.NComponents {
+			return fmt.Errorf("point %d has %d coordinates, want %d", i, len(point), out.NComponents)
+		}
+		for _, c := range point {
+			if c == nil || math.IsNaN(*c) || math.IsInf(*c, 0) {
+				return fmt.Errorf("point %d has a missing or non-finite coordinate", i)
+			}
+		}
+	}
+	return nil
+}
+
+// embeddingMissing reports whether an embedding carries no information:
+// it is empty or every component is zero.
+func embeddingMissing(embedding []float64) bool {
+	for _, v := range embedding {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeEmbedding scales embedding to unit L2 length in place, so cosine
+// similarity in the store reduces to a dot product. An empty or all-zero
+// embedding has no direction and is left unchanged.
+func normalizeEmbedding(embedding []float64) bool {
+	if embeddingMissing(embedding) {
+		return false
+	}
+	var sum float64
+	for _, v := range embedding {
+		sum += v * v
+	}
+	norm := math.Sqrt(sum)
+	for i := range embedding {
+		embedding[i] /= norm
+	}
+	return true
+}
+
+// normalizeEmbeddingBody L2-normalizes the embedding field of an add
+// request, keeping its other fields. Bodies it cannot parse are returned
+// unchanged for the embeddings service to reject; skipped reports an empty
+// or all-zero embedding that was left as is.
+func normalizeEmbeddingBody(body []byte) (out []byte, skipped bool) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return body, false
+	}
+	var embedding []float64
+	if json.Unmarshal(fields["embedding"], &embedding) != nil {
+		return body, false
+	}
+	if !normalizeEmbedding(embedding) {
+		return body, true
+	}
+	fields["embedding"], _ = json.Marshal(embedding)
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return body, false
+	}
+	return out, false
+}
+
+// normalizeEmbeddings reports whether embeddings added by r are normalized
+// before they are stored: ?normalize= when given, NormalizeEmbeddings
+// otherwise.
+func (g *Gateway) normalizeEmbeddings(r *http.Request) bool {
+	if normalize, err := strconv.ParseBool(r.URL.Query().Get("normalize")); err == nil {
+		return normalize
+	}
+	return g.config().NormalizeEmbeddings
+}
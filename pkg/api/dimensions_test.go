@@ -0,0 +1,273 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stubEmbeddingsList stubs the embeddings service's list endpoint with
+// list.
+func stubEmbeddingsList(t *testing.T, g *Gateway, list string) {
+	stubService(t, g, serviceEmbeddings, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(list))
+	})
+}
+
+func TestEmbeddingsStatsReportsDimensions(t *testing.T) {
+	tests := []struct {
+		name       string
+		list       string
+		dimensions []int
+		consistent bool
+		bySource   map[string][]int
+	}{
+		{
+			name:       "uniform",
+			list:       `{"embeddings":[{"source":"vision","embedding":[1,2,3]},{"source":"speech","embedding":[4,5,6]}]}`,
+			dimensions: []int{3},
+			consistent: true,
+			bySource:   map[string][]int{"vision": {3}, "speech": {3}},
+		},
+		{
+			name:       "mixed",
+			list:       `{"embeddings":[{"source":"vision","embedding":[1,2,3]},{"source":"vision","embedding":[1,2]},{"source":"speech","embedding":[4,5]}]}`,
+			dimensions: []int{2, 3},
+			consistent: false,
+			bySource:   map[string][]int{"vision": {2, 3}, "speech": {2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			stubEmbeddingsList(t, g, tt.list)
+
+			resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/embeddings/stats", "")
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+			}
+			var stats struct {
+				Dimensions []int                     `json:"dimensions"`
+				Consistent bool                      `json:"consistent"`
+				BySource   map[string]dimensionStats `json:"by_source"`
+			}
+			if err := json.Unmarshal([]byte(body), &stats); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(stats.Dimensions, tt.dimensions) || stats.Consistent != tt.consistent {
+				t.Errorf("dimensions %v consistent %v, want %v %v", stats.Dimensions, stats.Consistent, tt.dimensions, tt.consistent)
+			}
+			for source, dims := range tt.bySource {
+				if got := stats.BySource[source]; !reflect.DeepEqual(got.Dimensions, dims) || got.Consistent != (len(dims) == 1) {
+					t.Errorf("%s: %+v, want dimensions %v", source, got, dims)
+				}
+			}
+		})
+	}
+}
+
+// reduction is a valid reduce-dimensions result for n points.
+func reduction(n int) string {
+	points := make([]string, n)
+	for i := range points {
+		points[i] = "[0.1,0.2]"
+	}
+	return `{"reduced_embeddings":[` + strings.Join(points, ",") + `],"n_components":2}`
+}
+
+func TestReduceDimensionsRequiresUniformDimensions(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	calls := stubPipeline(t, g, map[string]string{"/reduce-dimensions": reduction(2)})
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/embeddings/reduce-dimensions", `{"embeddings":[[1,2,3],[1,2]],"n_components":2}`)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, `"path":"embeddings"`) || !strings.Contains(body, "2, 3") {
+		t.Errorf("mixed dimensions: status %d %s, want a 400 listing dimensions 2 and 3", resp.StatusCode, body)
+	}
+	if reduce := calls.get("/reduce-dimensions"); len(reduce) != 0 {
+		t.Fatal("mixed embeddings reached the ML service")
+	}
+
+	resp, body = doRequest(t, http.MethodPost, srv.URL+"/api/embeddings/reduce-dimensions", `{"embeddings":[[1,2,3],[4,5,6]],"n_components":2}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("uniform dimensions: status %d, want 200: %s", resp.StatusCode, body)
+	}
+	if reduce := calls.get("/reduce-dimensions"); len(reduce) != 1 {
+		t.Errorf("ML service called %d times for uniform embeddings, want 1", len(reduce))
+	}
+}
+
+func TestReduceDimensionsValidatesResult(t *testing.T) {
+	for _, tc := range []struct {
+		name, result string
+		status       int
+		reason       string
+	}{
+		{"valid", reduction(3), http.StatusOK, ""},
+		{"NaN coordinate", `{"reduced_embeddings":[[0.1,NaN],[0.1,0.2],[0.1,0.2]],"n_components":2}`, http.StatusBadGateway, "not finite"},
+		{"null coordinate", `{"reduced_embeddings":[[0.1,null],[0.1,0.2],[0.1,0.2]],"n_components":2}`, http.StatusBadGateway, "point 0 has a missing or non-finite coordinate"},
+		{"too few points", reduction(2), http.StatusBadGateway, "got 2 points for 3 embeddings"},
+		{"too many points", reduction(4), http.StatusBadGateway, "got 4 points for 3 embeddings"},
+		{"wrong components", `{"reduced_embeddings":[[0.1],[0.1,0.2],[0.1,0.2]],"n_components":2}`, http.StatusBadGateway, "point 0 has 1 coordinates, want 2"},
+		{"not JSON", `reduced!`, http.StatusBadGateway, "unreadable result"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			stubPipeline(t, g, map[string]string{"/reduce-dimensions": tc.result})
+
+			resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/embeddings/reduce-dimensions", `{"embeddings":[[1,2,3],[4,5,6],[7,8,9]],"n_components":2}`)
+			if resp.StatusCode != tc.status {
+				t.Fatalf("status %d %s, want %d", resp.StatusCode, body, tc.status)
+			}
+			if tc.status == http.StatusOK && body != tc.result {
+				t.Errorf("body %s, want the reduction relayed as is", body)
+			}
+			if tc.reason != "" && !strings.Contains(body, tc.reason) {
+				t.Errorf("body %s, want it to say %q", body, tc.reason)
+			}
+		})
+	}
+}
+
+func TestReduceDimensionsValidatesParams(t *testing.T) {
+	const points = `"embeddings":[[1,2],[3,4],[5,6],[7,8]]`
+	tests := []struct {
+		name   string
+		params string
+		method string // forwarded to the ML service, or "" when rejected
+		bad    []string
+	}{
+		{name: "supported method", params: `"method":"tsne","perplexity":3,"n_components":3`, method: "tsne"},
+		{name: "default method", params: `"n_components":2`, method: "pca"},
+		{name: "unsupported method", params: `"method":"lda"`, bad: []string{"method"}},
+		{name: "method not a string", params: `"method":5`, bad: []string{"method"}},
+		{name: "too many components", params: `"n_components":4`, bad: []string{"n_components"}},
+		{name: "no components", params: `"n_components":0`, bad: []string{"n_components"}},
+		{name: "fractional components", params: `"n_components":2.5`, bad: []string{"n_components"}},
+		{name: "perplexity not positive", params: `"method":"tsne","perplexity":0`, bad: []string{"perplexity"}},
+		{name: "perplexity at the point count", params: `"method":"tsne","perplexity":4`, bad: []string{"perplexity"}},
+		{name: "every bad field reported", params: `"method":"lda","n_components":9,"perplexity":-1`, bad: []string{"method", "n_components", "perplexity"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			calls := stubPipeline(t, g, map[string]string{"/reduce-dimensions": reduction(4)})
+
+			resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/embeddings/reduce-dimensions", "{"+points+","+tt.params+"}")
+			forwarded := calls.get("/reduce-dimensions")
+			if tt.bad != nil {
+				var verr struct {
+					Error struct {
+						Fields []FieldError `json:"fields"`
+					} `json:"error"`
+				}
+				json.Unmarshal([]byte(body), &verr)
+				var paths []string
+				for _, f := range verr.Error.Fields {
+					paths = append(paths, f.Path)
+				}
+				if resp.StatusCode != http.StatusBadRequest || !slices.Equal(paths, tt.bad) {
+					t.Errorf("status %d, fields %v, want a 400 for %v: %s", resp.StatusCode, paths, tt.bad, body)
+				}
+				if len(forwarded) != 0 {
+					t.Error("invalid parameters reached the ML service")
+				}
+				return
+			}
+
+			if resp.StatusCode != http.StatusOK || len(forwarded) != 1 {
+				t.Fatalf("status %d with %d ML calls, want 200 and one call: %s", resp.StatusCode, len(forwarded), body)
+			}
+			var sent map[string]any
+			json.Unmarshal([]byte(forwarded[0]), &sent)
+			if sent["method"] != tt.method || len(sent["embeddings"].([]any)) != 4 {
+				t.Errorf("forwarded %v, want method %s and the embeddings", sent, tt.method)
+			}
+		})
+	}
+}
+
+func TestReductionMethodsFromEnv(t *testing.T) {
+	t.Setenv("REDUCTION_METHODS", "umap,pca")
+	t.Setenv("REDUCTION_DEFAULT_METHOD", "umap")
+	loaded := LoadConfig()
+	if !slices.Equal(loaded.ReductionMethods, []string{"umap", "pca"}) || loaded.ReductionDefaultMethod != "umap" {
+		t.Fatalf("ReductionMethods %v, ReductionDefaultMethod %q, want umap and pca defaulting to umap", loaded.ReductionMethods, loaded.ReductionDefaultMethod)
+	}
+	g, srv := newTestGateway(t, Config{ReductionMethods: loaded.ReductionMethods, ReductionDefaultMethod: loaded.ReductionDefaultMethod})
+	calls := stubPipeline(t, g, map[string]string{"/reduce-dimensions": reduction(2)})
+
+	if resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/embeddings/reduce-dimensions", `{"embeddings":[[1,2],[3,4]],"method":"tsne"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("tsne left off REDUCTION_METHODS: status %d, want 400", resp.StatusCode)
+	}
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/embeddings/reduce-dimensions", `{"embeddings":[[1,2],[3,4]]}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	if forwarded := calls.get("/reduce-dimensions"); len(forwarded) != 1 || !strings.Contains(forwarded[0], `"method":"umap"`) {
+		t.Errorf("forwarded %v, want the configured default method", forwarded)
+	}
+}
+
+func TestAddEmbeddingNormalization(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize bool
+		query     string
+		embedding string
+		want      []float64
+		warned    bool
+	}{
+		// 0.6, 0.8 is 3, 4 scaled to unit length
+		{"config on", true, "", "[3,4]", []float64{0.6, 0.8}, false},
+		{"config off", false, "", "[3,4]", []float64{3, 4}, false},
+		{"param on", false, "?normalize=true", "[3,4]", []float64{0.6, 0.8}, false},
+		{"param off", true, "?normalize=false", "[3,4]", []float64{3, 4}, false},
+		{"zero vector", true, "", "[0,0,0]", []float64{0, 0, 0}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{NormalizeEmbeddings: tt.normalize})
+			var mu sync.Mutex
+			var forwarded map[string]any
+			stubService(t, g, serviceEmbeddings, func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				json.Unmarshal(b, &forwarded)
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"ok":true}`))
+			})
+
+			body := `{"id":"e1","source":"vision","embedding":` + tt.embedding + `}`
+			resp, out := doRequest(t, http.MethodPost, srv.URL+"/api/embeddings/add"+tt.query, body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", resp.StatusCode, out)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if forwarded["id"] != "e1" || forwarded["source"] != "vision" {
+				t.Errorf("forwarded %v, want the other fields kept", forwarded)
+			}
+			got, _ := forwarded["embedding"].([]any)
+			if len(got) != len(tt.want) {
+				t.Fatalf("forwarded embedding %v, want %v", got, tt.want)
+			}
+			for i, v := range got {
+				if math.Abs(v.(float64)-tt.want[i]) > 1e-9 {
+					t.Errorf("forwarded embedding %v, want %v", got, tt.want)
+					break
+				}
+			}
+			if warned := len(recordedEvents(t, g, "pipeline.warning")) > 0; warned != tt.warned {
+				t.Errorf("warning broadcast %v, want %v", warned, tt.warned)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Outcomes a failed downstream call is counted under in /metrics.
+const (
+	// outcomeTimeout is a call that ran out of time before a response
+	outcomeTimeout = "timeout"
+	// outcomeDialError is a call that got no response because the
+	// connection could not be made or was dropped
+	outcomeDialError = "dial_error"
+	// outcomeUpstream5xx and outcomeUpstream4xx are error responses
+	outcomeUpstream5xx = "upstream_5xx"
+	outcomeUpstream4xx = "upstream_4xx"
+	// outcomeParseError is a successful response whose body the gateway
+	// could not read as what the service should have sent
+	outcomeParseError = "parse_error"
+)
+
+type downstreamKey struct {
+	service, outcome string
+}
+
+// downstreamFailures counts failed downstream calls by service and
+// outcome.
+type downstreamFailures struct {
+	mu     sync.Mutex
+	counts map[downstreamKey]uint64
+}
+
+func (d *downstreamFailures) add(service, outcome string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.counts == nil {
+		d.counts = make(map[downstreamKey]uint64)
+	}
+	d.counts[downstreamKey{service, outcome}]++
+}
+
+// reset zeroes the counts, returning how many failures they held.
+func (d *downstreamFailures) reset() (total uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, n := range d.counts {
+		total += n
+	}
+	d.counts = nil
+	return total
+}
+
+// snapshot returns the counts sorted by service, then outcome.
+func (d *downstreamFailures) snapshot() ([]downstreamKey, map[downstreamKey]uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	keys := make([]downstreamKey, 0, len(d.counts))
+	counts := make(map[downstreamKey]uint64, len(d.counts))
+	for key, n := range d.counts {
+		keys = append(keys, key)
+		counts[key] = n
+	}
+	slices.SortFunc(keys, func(a, b downstreamKey) int {
+		return strings.Compare(a.service+"\x00"+a.outcome, b.service+"\x00"+b.outcome)
+	})
+	return keys, counts
+}
+
+// countFailure counts a call to service that failed with outcome.
+func (g *Gateway) countFailure(service, outcome string) {
+	g.failures.add(service, outcome)
+}
+
+// countSendError classifies the error of a downstream call that got no
+// response. Calls skipped as offline, or cancelled because the client went
+// away, are not the backend's doing and are not counted.
+func (g *Gateway) countSendError(service string, err error) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errServiceOffline), errors.Is(err, context.Canceled):
+		return
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		g.countFailure(service, outcomeTimeout)
+	default:
+		g.countFailure(service, outcomeDialError)
+	}
+}
+
+// countResponse counts a downstream response with an error status.
+func (g *Gateway) countResponse(service string, status int) {
+	switch {
+	case status >= 500:
+		g.countFailure(service, outcomeUpstream5xx)
+	case status >= 400:
+		g.countFailure(service, outcomeUpstream4xx)
+	}
+}
+
+// getMetrics serves the downstream failure counters in the Prometheus text
+// format.
+func (g *Gateway) getMetrics(w http.ResponseWriter, r *http.Request) {
+	keys, counts := g.failures.snapshot()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprintln(w, "# HELP gateway_downstream_failures_total Failed downstream calls by service and outcome.")
+	fmt.Fprintln(w, "# TYPE gateway_downstream_failures_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "gateway_downstream_failures_total{service=%q,outcome=%q} %d\n", key.service, key.outcome, counts[key])
+	}
+}
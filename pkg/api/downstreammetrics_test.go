@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// failureCounts returns the gateway_downstream_failures_total samples
+// served on /metrics, keyed by their labels.
+func failureCounts(t *testing.T, url string) map[string]string {
+	t.Helper()
+	resp, body := doRequest(t, http.MethodGet, url+"/metrics", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/metrics: status %d", resp.StatusCode)
+	}
+	counts := make(map[string]string)
+	for _, line := range strings.Split(body, "\n") {
+		labels, value, ok := strings.Cut(strings.TrimPrefix(line, "gateway_downstream_failures_total"), " ")
+		if ok && line != labels && !strings.HasPrefix(line, "#") {
+			counts[labels] = value
+		}
+	}
+	return counts
+}
+
+func TestDownstreamFailuresClassified(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		header  []string
+		outcome string
+	}{
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				<-r.Context().Done()
+			},
+			header:  []string{"X-Deadline-Ms", "100"},
+			outcome: outcomeTimeout,
+		},
+		{
+			name:    "dial error",
+			outcome: outcomeDialError,
+		},
+		{
+			name: "upstream 5xx",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "model crashed", http.StatusInternalServerError)
+			},
+			outcome: outcomeUpstream5xx,
+		},
+		{
+			name: "upstream 4xx",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "unsupported image", http.StatusUnprocessableEntity)
+			},
+			outcome: outcomeUpstream4xx,
+		},
+		{
+			name: "parse error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"topk":`))
+			},
+			outcome: outcomeParseError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			stubPipeline(t, g, defaultPipeline())
+			if tt.handler != nil {
+				stubService(t, g, serviceML, tt.handler)
+			} else {
+				// A server that has gone away refuses the connection
+				dead := serve(t, http.NotFoundHandler())
+				g.SetServiceURL(serviceML, dead.URL)
+				dead.Close()
+			}
+
+			if resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame, tt.header...); resp.StatusCode < http.StatusBadRequest {
+				t.Fatalf("status %d, want the frame to fail", resp.StatusCode)
+			}
+			want := map[string]string{fmt.Sprintf("{service=%q,outcome=%q}", serviceML, tt.outcome): "1"}
+			if got := failureCounts(t, srv.URL); !maps.Equal(got, want) {
+				t.Errorf("failure counters %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDownstreamFailuresSkipOfflineServices(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	stubPipeline(t, g, defaultPipeline())
+	g.setServiceStatus(serviceML, "offline")
+
+	if resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503 with ML offline", resp.StatusCode)
+	}
+	if got := failureCounts(t, srv.URL); len(got) != 0 {
+		t.Errorf("failure counters %v, want none for a call skipped as offline", got)
+	}
+}
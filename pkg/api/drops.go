@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// dropLogInterval is the minimum time between drop logs for one client.
+const dropLogInterval = 10 * time.Second
+
+// clientDrops counts the broadcasts a client missed because its buffer was
+// full, and when they were last logged.
+type clientDrops struct {
+	total   atomic.Uint64
+	logged  atomic.Uint64
+	lastLog atomic.Int64
+}
+
+// noteDrop counts a dropped broadcast for c and logs it as a JSON line with
+// the client's identity and filters, aggregated so a slow consumer is
+// reported at most once per dropLogInterval with its cumulative count.
+func noteDrop(c sseClient) {
+	total := c.drops.total.Add(1)
+
+	now := time.Now().UnixNano()
+	last := c.drops.lastLog.Load()
+	if now-last < int64(dropLogInterval) || !c.drops.lastLog.CompareAndSwap(last, now) {
+		return
+	}
+	since := total - c.drops.logged.Swap(total)
+
+	line, _ := json.Marshal(map[string]any{
+		"msg":     "sse client dropping events",
+		"client":  c.meta.ID,
+		"session": c.meta.Session,
+		"fields":  c.meta.Fields,
+		"cameras": c.meta.Cameras,
+		"dropped": since,
+		"total":   total,
+	})
+	log.Print(string(line))
+}
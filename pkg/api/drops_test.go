@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// dropLogs returns the drop lines logged to logs, decoded.
+func dropLogs(t *testing.T, logs *syncBuffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(logs.String(), "\n") {
+		start := strings.Index(line, "{")
+		if start < 0 || !strings.Contains(line, "sse client dropping events") {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line[start:]), &entry); err != nil {
+			t.Fatalf("drop log %q is not JSON: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestDropsAreLoggedPerClient(t *testing.T) {
+	logs := captureLog(t)
+	hub := NewSSEHub()
+	hub.bufferSize = 1
+	slowID, _, _, _, _, _ := hub.register(ClientMeta{Session: "kiosk", Fields: "type,seq"}, nil, 0)
+	defer hub.unregister(slowID, checkpoint{})
+
+	// The first broadcast fills the buffer and the next three are dropped,
+	// logged once for the first drop and aggregated after that
+	for range 4 {
+		hub.Broadcast(`{"type":"tick"}`)
+	}
+	lines := dropLogs(t, logs)
+	if len(lines) != 1 {
+		t.Fatalf("logged %d drop lines within the interval, want 1: %s", len(lines), logs)
+	}
+	want := map[string]any{"client": slowID, "session": "kiosk", "fields": "type,seq", "cameras": "", "dropped": 1.0, "total": 1.0}
+	for key, value := range want {
+		if lines[0][key] != value {
+			t.Errorf("%s is %v, want %v", key, lines[0][key], value)
+		}
+	}
+
+	// Once the interval has passed the next drop reports the ones in between
+	hub.mu.Lock()
+	hub.clients[slowID].drops.lastLog.Store(0)
+	hub.mu.Unlock()
+	hub.Broadcast(`{"type":"tick"}`)
+	lines = dropLogs(t, logs)
+	if len(lines) != 2 || lines[1]["dropped"] != 3.0 || lines[1]["total"] != 4.0 {
+		t.Errorf("logged %v, want a second line with 3 dropped of 4", lines)
+	}
+}
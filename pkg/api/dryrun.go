@@ -0,0 +1,116 @@
+package api
+
+import (
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Vocabularies the dry-run observations are drawn from.
+var (
+	dryRunLabels = []string{"person", "laptop", "coffee mug", "book", "potted plant", "chair", "window", "cat", "keyboard", "lamp"}
+	dryRunColors = []string{"red", "orange", "yellow", "green", "blue", "purple", "brown", "gray", "white", "black"}
+)
+
+// isDryRun reports whether r asks for a synthetic response with ?dry_run or
+// an X-Dry-Run header, either set to a true value.
+func isDryRun(r *http.Request) bool {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		v = r.Header.Get("X-Dry-Run")
+	}
+	dry, _ := strconv.ParseBool(v)
+	return dry
+}
+
+// dryRunSeed returns the seed from ?seed=, or one derived from the frame so
+// the same frame always produces the same synthetic events.
+func dryRunSeed(r *http.Request, imageBase64 string) (uint64, error) {
+	if v := r.URL.Query().Get("seed"); v != "" {
+		return strconv.ParseUint(v, 10, 64)
+	}
+	hash := frameHash(imageBase64)
+	return binary.BigEndian.Uint64(hash[:8]), nil
+}
+
+// dryRunEvents builds a vision.observation and the sentience.token it would
+// lead to for a frame from seed alone. Apart from the token's timestamps,
+// taken from now, the events are the same for the same seed, hops and
+// camera.
+func dryRunEvents(seed uint64, in frameIn, now time.Time) (observation, token map[string]any) {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	round := func(f float64) float64 { return math.Round(f*1000) / 1000 }
+
+	// Scores sum to less than one and are sorted, like a softmax top-k
+	perm := rng.Perm(len(dryRunLabels))
+	topK := make([]scoredLabel, 5)
+	remaining := 1.0
+	for i := range topK {
+		score := remaining * (0.3 + 0.5*rng.Float64())
+		remaining -= score
+		topK[i] = scoredLabel{Label: dryRunLabels[perm[i]], Score: round(score)}
+	}
+	slices.SortStableFunc(topK, func(a, b scoredLabel) int { return cmp.Compare(b.Score, a.Score) })
+	color := dryRunColors[rng.IntN(len(dryRunColors))]
+	valence := round(rng.Float64())
+	arousal := round(rng.Float64())
+
+	embeddingID := visionEmbeddingID(in.CameraID, fmt.Sprintf("%016x", seed))
+	observation = map[string]any{
+		"type":         "vision.observation",
+		"clip_topk":    topK,
+		"embedding_id": embeddingID,
+		"camera_id":    in.CameraID,
+		"hops":         in.Hops + 1,
+		"dry_run":      true,
+	}
+	token = map[string]any{
+		"type":         "sentience.token",
+		"ts":           now.Unix(), // seconds, as the sentience service sends it
+		"embedding_id": embeddingID,
+		"camera_id":    in.CameraID,
+		"facets": map[string]any{
+			"vision.object":  topK[0].Label,
+			"color.dominant": color,
+			"affect.valence": valence,
+			"affect.arousal": arousal,
+		},
+		"timestamp": now.UnixMilli(),
+		"dry_run":   true,
+	}
+	return observation, token
+}
+
+// writeDryRunFrame answers a vision frame with synthetic events instead of
+// calling the ML and sentience services, broadcasting them like real ones so
+// the frontend can be developed without the ML stack.
+func (g *Gateway) writeDryRunFrame(w http.ResponseWriter, r *http.Request, in frameIn) {
+	seed, err := dryRunSeed(r, in.ImageBase64)
+	if err != nil {
+		http.Error(w, "bad request: invalid seed", http.StatusBadRequest)
+		return
+	}
+
+	observation, token := dryRunEvents(seed, in, g.now())
+	ctx := withCorrelation(r.Context(), observation["embedding_id"].(string))
+	for _, ev := range []map[string]any{observation, token} {
+		evBytes, _ := json.Marshal(ev)
+		g.broadcastFrom(ctx, string(evBytes))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"ok":           true,
+		"embedding_id": observation["embedding_id"],
+		"dry_run":      true,
+		"seed":         strconv.FormatUint(seed, 10),
+		"events":       []map[string]any{observation, token},
+	})
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// dryRunGateway returns a gateway at a fixed time whose downstream calls
+// go to a fake client answering with a CLIP result.
+func dryRunGateway(t *testing.T) (*Gateway, string, *fakeClient) {
+	t.Helper()
+	fake := &fakeClient{respond: func(*http.Request) (*http.Response, error) {
+		return jsonResponse(http.StatusOK, clipResponse), nil
+	}}
+	g, srv := newTestGatewayWith(t, Config{}, func(g *Gateway) {
+		g.SetClient(fake)
+		g.SetClock(fixedClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)))
+	})
+	return g, srv.URL, fake
+}
+
+func TestDryRunFrameEmitsSyntheticEvents(t *testing.T) {
+	g, url, fake := dryRunGateway(t)
+
+	resp, body := doRequest(t, http.MethodPost, url+"/api/vision/frame?dry_run=true&seed=42", `{"image_base64":"aGVsbG8=","camera_id":"front"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("dry run made %d downstream calls, want none", len(fake.requests))
+	}
+
+	observations := recordedEvents(t, g, "vision.observation")
+	tokens := recordedEvents(t, g, "sentience.token")
+	if len(observations) != 1 || len(tokens) != 1 {
+		t.Fatalf("broadcast %d observations and %d tokens, want one of each", len(observations), len(tokens))
+	}
+	obs, token := observations[0], tokens[0]
+	if obs["dry_run"] != true || token["dry_run"] != true || obs["camera_id"] != "front" {
+		t.Errorf("events %v and %v, want both marked dry_run from camera front", obs, token)
+	}
+	if obs["embedding_id"] == nil || obs["embedding_id"] != token["embedding_id"] {
+		t.Errorf("observation %v and token %v do not share an embedding ID", obs["embedding_id"], token["embedding_id"])
+	}
+
+	var topK []scoredLabel
+	b, _ := json.Marshal(obs["clip_topk"])
+	json.Unmarshal(b, &topK)
+	var sum float64
+	for i, label := range topK {
+		sum += label.Score
+		if label.Label == "" || label.Score <= 0 || (i > 0 && label.Score > topK[i-1].Score) {
+			t.Errorf("top-k %v, want labelled positive scores in descending order", topK)
+			break
+		}
+	}
+	if len(topK) != 5 || sum >= 1 {
+		t.Errorf("top-k %v sums to %v, want 5 labels summing below 1", topK, sum)
+	}
+	facets, _ := token["facets"].(map[string]any)
+	if len(topK) > 0 && facets["vision.object"] != topK[0].Label {
+		t.Errorf("token facets %v, want the top label as vision.object", facets)
+	}
+}
+
+func TestDryRunFrameIsDeterministic(t *testing.T) {
+	_, url, fake := dryRunGateway(t)
+	frame := func(query, image string, header ...string) string {
+		t.Helper()
+		resp, body := doRequest(t, http.MethodPost, url+"/api/vision/frame"+query, `{"image_base64":"`+image+`"}`, header...)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d, want 200: %s", query, resp.StatusCode, body)
+		}
+		return body
+	}
+
+	if first, again := frame("?dry_run=true&seed=42", "aGVsbG8="), frame("?dry_run=1&seed=42", "d29ybGQ="); first != again {
+		t.Errorf("same seed gave different results:\n%s\n%s", first, again)
+	}
+	if a, b := frame("?dry_run=true&seed=42", "aGVsbG8="), frame("?dry_run=true&seed=43", "aGVsbG8="); a == b {
+		t.Error("different seeds gave the same result")
+	}
+	// Without a seed, the frame decides
+	if a, b := frame("", "aGVsbG8=", "X-Dry-Run", "true"), frame("", "aGVsbG8=", "X-Dry-Run", "true"); a != b {
+		t.Errorf("same frame gave different results:\n%s\n%s", a, b)
+	}
+	if a, b := frame("", "aGVsbG8=", "X-Dry-Run", "true"), frame("", "d29ybGQ=", "X-Dry-Run", "true"); a == b {
+		t.Error("different frames gave the same result")
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("dry runs made %d downstream calls, want none", len(fake.requests))
+	}
+
+	if resp, _ := doRequest(t, http.MethodPost, url+"/api/vision/frame?dry_run=true&seed=soon", testFrame); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid seed: status %d, want 400", resp.StatusCode)
+	}
+	doRequest(t, http.MethodPost, url+"/api/vision/frame?dry_run=false", testFrame)
+	if len(fake.requests) == 0 {
+		t.Error("dry_run=false did not reach the ML service")
+	}
+}
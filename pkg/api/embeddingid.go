@@ -0,0 +1,30 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// visionEmbeddingID returns the embedding ID for a frame from camera. The
+// camera is kept in the ID so observations from different cameras are
+// plotted apart, and suffix tells the frames of one camera apart.
+func visionEmbeddingID(camera, suffix string) string {
+	return "emb-" + camera + "-" + suffix
+}
+
+// speechEmbeddingID returns a new embedding ID for a transcript.
+func speechEmbeddingID() string {
+	return "speech-" + newClientID()
+}
+
+// writePipelineOK answers a vision frame or speech transcript with the
+// embedding ID its events and sentience run used, so the caller can match
+// its upload to them.
+func writePipelineOK(w http.ResponseWriter, embeddingID string, cached bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		OK          bool   `json:"ok"`
+		EmbeddingID string `json:"embedding_id"`
+		Cached      bool   `json:"cached,omitempty"`
+	}{true, embeddingID, cached})
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPipelineReturnsAssignedEmbeddingID(t *testing.T) {
+	tests := []struct {
+		name, path, body, event, prefix string
+	}{
+		{"vision", "/api/vision/frame", testFrame, "vision.observation", visionEmbeddingID(defaultCameraID, "")},
+		{"speech", "/api/speech/transcript", speechRequest, "speech.transcript", "speech-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			calls := stubPipeline(t, g, defaultPipeline())
+
+			resp, body := doRequest(t, http.MethodPost, srv.URL+tt.path, tt.body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+			}
+			var out struct {
+				OK          bool   `json:"ok"`
+				EmbeddingID string `json:"embedding_id"`
+			}
+			if err := json.Unmarshal([]byte(body), &out); err != nil {
+				t.Fatalf("decoding %s: %v", body, err)
+			}
+			if !out.OK || !strings.HasPrefix(out.EmbeddingID, tt.prefix) || out.EmbeddingID == tt.prefix {
+				t.Fatalf("response %s, want ok with an embedding_id starting %q", body, tt.prefix)
+			}
+
+			events := recordedEvents(t, g, tt.event)
+			if len(events) != 1 || events[0]["embedding_id"] != out.EmbeddingID {
+				t.Errorf("%s events %v, want one with embedding_id %s", tt.event, events, out.EmbeddingID)
+			}
+			runs := calls.get("/run")
+			if len(runs) != 1 {
+				t.Fatalf("made %d sentience runs, want 1", len(runs))
+			}
+			var run map[string]any
+			json.Unmarshal([]byte(runs[0]), &run)
+			if run["embedding_id"] != out.EmbeddingID {
+				t.Errorf("sentience run used embedding_id %v, want %s", run["embedding_id"], out.EmbeddingID)
+			}
+		})
+	}
+}
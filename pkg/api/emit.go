@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type emitIn struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// postEmitEvent broadcasts an event supplied by the caller, such as a marker
+// annotating a live session or a fixture for frontend work. The event is
+// stamped like the gateway's own and flagged as manual.
+func (g *Gateway) postEmitEvent(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxEmitBytes)
+
+	var in emitIn
+	if err := g.decodeJSON(r, &in); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	var verr ValidationError
+	if strings.TrimSpace(in.Type) == "" {
+		verr.Add("type", "is required")
+	}
+	if verr.Err() != nil {
+		writeValidationError(w, &verr)
+		return
+	}
+
+	ev := map[string]any{
+		"type":      in.Type,
+		"manual":    true,
+		"timestamp": g.timestamp(),
+	}
+	if len(in.Payload) > 0 {
+		ev["payload"] = in.Payload
+	}
+	evBytes, _ := json.Marshal(ev)
+	g.broadcastFrom(r.Context(), string(evBytes))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "event": ev})
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEmitBroadcastsManualEvent(t *testing.T) {
+	g, srv := newTestGateway(t, Config{APIKey: testAPIKey})
+	stream := openSSE(t, srv.URL+"/events", nil)
+	stream.expect("connection")
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/events/emit", `{"type":"session.marker","payload":{"label":"take 2"}}`, "X-API-Key", testAPIKey)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"ok":true`) {
+		t.Fatalf("status %d %s, want 200", resp.StatusCode, body)
+	}
+	ev := stream.expect("session.marker")
+	payload, _ := ev["payload"].(map[string]any)
+	if payload["label"] != "take 2" || ev["manual"] != true {
+		t.Errorf("broadcast %v, want the payload flagged manual", ev)
+	}
+	if _, ok := ev["timestamp"].(float64); !ok {
+		t.Errorf("broadcast %v without a timestamp", ev)
+	}
+	if seq, ok := ev["seq"].(float64); !ok || seq < 1 {
+		t.Errorf("broadcast %v without a seq", ev)
+	}
+	if events := recordedEvents(t, g, "session.marker"); len(events) != 1 {
+		t.Errorf("recorded %d markers, want 1", len(events))
+	}
+}
+
+func TestEmitRejectsInvalidEvents(t *testing.T) {
+	g, srv := newTestGateway(t, Config{APIKey: testAPIKey})
+	for _, tc := range []struct {
+		name, body string
+		header     []string
+		status     int
+		invalid    string
+	}{
+		{"no type", `{"payload":{"label":"x"}}`, []string{"X-API-Key", testAPIKey}, http.StatusBadRequest, "type"},
+		{"blank type", `{"type":"  "}`, []string{"X-API-Key", testAPIKey}, http.StatusBadRequest, "type"},
+		{"not JSON", `marker`, []string{"X-API-Key", testAPIKey}, http.StatusBadRequest, ""},
+		{"no key", `{"type":"marker"}`, nil, http.StatusUnauthorized, ""},
+		{"wrong key", `{"type":"marker"}`, []string{"Authorization", "Bearer nope"}, http.StatusUnauthorized, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/events/emit", tc.body, tc.header...)
+			if resp.StatusCode != tc.status {
+				t.Errorf("status %d %s, want %d", resp.StatusCode, body, tc.status)
+			}
+			if tc.invalid != "" && !strings.Contains(body, `"path":"`+tc.invalid+`"`) {
+				t.Errorf("body %s, want a validation error on %s", body, tc.invalid)
+			}
+		})
+	}
+	if events := recordedEvents(t, g, ""); len(events) != 0 {
+		t.Errorf("rejected events were broadcast: %v", events)
+	}
+}
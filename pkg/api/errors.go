@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// errorBody is the JSON error envelope, sent as {"error":{...}}. Failed
+// downstream calls also name the backend responsible and, in handlers that
+// make several calls, the pipeline stage that failed.
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Service string `json:"service,omitempty"`
+	Stage   string `json:"stage,omitempty"`
+}
+
+// writeJSONError responds with status and body wrapped in the error
+// envelope.
+func writeJSONError(w http.ResponseWriter, status int, body errorBody) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]errorBody{"error": body})
+}
+
+// serviceError is a failed call to a downstream service, so the error
+// envelope can name the service whatever handler reports it.
+type serviceError struct {
+	service string
+	err     error
+}
+
+func (e *serviceError) Error() string { return e.err.Error() }
+func (e *serviceError) Unwrap() error { return e.err }
+
+// failedService returns the downstream service err came from, or "" when
+// it did not come from one.
+func failedService(err error) string {
+	var se *serviceError
+	if errors.As(err, &se) {
+		return se.service
+	}
+	return ""
+}
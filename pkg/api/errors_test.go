@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestErrorEnvelopeNamesServiceAndStage(t *testing.T) {
+	const tokenize = `{"embedding_id":"e1","clip_topk":[{"label":"cat","score":0.9}]}`
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		responses map[string]string
+		offline   string
+		status    int
+		code      string
+		service   string
+		stage     string
+	}{
+		{"vision ml error", "/api/vision/frame", testFrame, map[string]string{}, "",
+			http.StatusBadGateway, "downstream_error", serviceML, "ml.clip"},
+		{"vision ml parse error", "/api/vision/frame", testFrame, map[string]string{"/infer/clip": `not json`}, "",
+			http.StatusBadGateway, "downstream_error", serviceML, "ml.clip"},
+		// Refused before the pipeline starts, so no stage is named
+		{"vision ml offline", "/api/vision/frame", testFrame, defaultPipeline(), serviceML,
+			http.StatusServiceUnavailable, "service_unavailable", serviceML, ""},
+		{"memory sentience offline", "/api/memory", "", defaultPipeline(), serviceSentience,
+			http.StatusServiceUnavailable, "service_unavailable", serviceSentience, ""},
+		{"speech whisper error", "/api/speech/transcript", speechRequest, map[string]string{}, "",
+			http.StatusBadGateway, "downstream_error", serviceML, "ml.whisper"},
+		{"tokenize sentience error", "/api/sentience/tokenize", tokenize, map[string]string{}, "",
+			http.StatusBadGateway, "downstream_error", serviceSentience, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			stubPipeline(t, g, tt.responses)
+			if tt.offline != "" {
+				g.setServiceStatus(tt.offline, "offline")
+			}
+
+			method := http.MethodPost
+			if tt.body == "" {
+				method = http.MethodGet
+			}
+			resp, body := doRequest(t, method, srv.URL+tt.path, tt.body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			var envelope struct {
+				Error errorBody `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+				t.Fatalf("decoding %s: %v", body, err)
+			}
+			got := envelope.Error
+			if got.Code != tt.code || got.Service != tt.service || got.Stage != tt.stage || got.Message == "" {
+				t.Errorf("error %+v, want code %s, service %q and stage %q with a message", got, tt.code, tt.service, tt.stage)
+			}
+		})
+	}
+}
+
+func TestOversizedResponseUsesErrorEnvelope(t *testing.T) {
+	oversized := strings.Repeat("x", 64<<10)
+	tests := []struct {
+		name    string
+		path    string
+		accept  string
+		service string
+	}{
+		{"memory", "/api/memory", "", serviceSentience},
+		{"memory stream", "/api/memory?stream=true", "", serviceSentience},
+		{"memory filtered", "/api/memory?source=vision", "", serviceSentience},
+		{"embeddings", "/api/embeddings", "", serviceEmbeddings},
+		{"embeddings msgpack", "/api/embeddings", msgpackContentType, serviceEmbeddings},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{MaxResponseBytes: map[string]int64{"default": 100}})
+			stubService(t, g, tt.service, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(oversized))
+			})
+
+			var header []string
+			if tt.accept != "" {
+				header = []string{"Accept", tt.accept}
+			}
+			resp, body := doRequest(t, http.MethodGet, srv.URL+tt.path, "", header...)
+			if resp.StatusCode != http.StatusBadGateway {
+				t.Errorf("status %d, want 502", resp.StatusCode)
+			}
+			var envelope struct {
+				Error errorBody `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+				t.Fatalf("decoding %s: %v", body, err)
+			}
+			got := envelope.Error
+			if got.Code != "downstream_error" || got.Service != tt.service || got.Message != errResponseTooLarge.Error() {
+				t.Errorf("error %+v, want a downstream_error from %s saying %q", got, tt.service, errResponseTooLarge)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// bodyETag returns a weak ETag for body. variant tells apart different
+// encodings of the same downstream content, such as msgpack.
+func bodyETag(body []byte, variant string) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:8]) + variant + `"`
+}
+
+// writeNotModified sets the ETag header and, when the request's
+// If-None-Match names it, answers 304 Not Modified and reports true.
+// Comparison is weak, as If-None-Match requires.
+func writeNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// relayWithETag relays a successful downstream response with an ETag over
+// its body, so clients polling for unchanged data get a 304 instead of the
+// full body again. Other responses are relayed as they are.
+func relayWithETag(w http.ResponseWriter, r *http.Request, resp *http.Response) {
+	if resp.StatusCode != http.StatusOK {
+		relay(w, resp)
+		return
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
+		return
+	}
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	if writeNotModified(w, r, bodyETag(body, "")) {
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
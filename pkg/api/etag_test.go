@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConditionalRequestsGetNotModified(t *testing.T) {
+	for _, tc := range []struct{ path, service string }{
+		{"/api/embeddings", serviceEmbeddings},
+		{"/api/memory", serviceSentience},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			var content atomic.Value
+			content.Store(`[{"id":"a"}]`)
+			stubService(t, g, tc.service, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(content.Load().(string)))
+			})
+
+			resp, _ := doRequest(t, http.MethodGet, srv.URL+tc.path, "")
+			etag := resp.Header.Get("ETag")
+			if resp.StatusCode != http.StatusOK || len(etag) < 4 || etag[:2] != "W/" {
+				t.Fatalf("status %d, ETag %q, want 200 with a weak ETag", resp.StatusCode, etag)
+			}
+
+			resp, body := doRequest(t, http.MethodGet, srv.URL+tc.path, "", "If-None-Match", etag)
+			if resp.StatusCode != http.StatusNotModified || body != "" {
+				t.Errorf("unchanged: status %d %q, want an empty 304", resp.StatusCode, body)
+			}
+			// A strong form of the same tag and a list containing it match too
+			resp, _ = doRequest(t, http.MethodGet, srv.URL+tc.path, "", "If-None-Match", `"other", `+etag[2:])
+			if resp.StatusCode != http.StatusNotModified {
+				t.Errorf("tag in a list: status %d, want 304", resp.StatusCode)
+			}
+
+			content.Store(`[{"id":"a"},{"id":"b"}]`)
+			resp, body = doRequest(t, http.MethodGet, srv.URL+tc.path, "", "If-None-Match", etag)
+			if resp.StatusCode != http.StatusOK || body != `[{"id":"a"},{"id":"b"}]` || resp.Header.Get("ETag") == etag {
+				t.Errorf("changed: status %d, ETag %q, want 200 with the new body and a new ETag", resp.StatusCode, resp.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestMsgpackETagDiffersFromJSON(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	stubEmbeddingsList(t, g, `[{"id":"a"}]`)
+
+	jsonResp, _ := doRequest(t, http.MethodGet, srv.URL+"/api/embeddings", "")
+	packed, _ := doRequest(t, http.MethodGet, srv.URL+"/api/embeddings", "", "Accept", msgpackContentType)
+	if jsonResp.Header.Get("ETag") == packed.Header.Get("ETag") {
+		t.Fatal("JSON and msgpack responses share an ETag")
+	}
+	resp, _ := doRequest(t, http.MethodGet, srv.URL+"/api/embeddings", "", "Accept", msgpackContentType, "If-None-Match", jsonResp.Header.Get("ETag"))
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("msgpack request with the JSON ETag: status %d, want 200", resp.StatusCode)
+	}
+}
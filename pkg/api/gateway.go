@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Gateway holds the state shared by the API handlers: the SSE hub, the
+// loaded configuration, and the client used for downstream calls. Separate
+// Gateways are fully independent.
+type Gateway struct {
+	hub    *SSEHub
+	client Client
+	clock  Clock
+
+	// The settings in effect; Reload swaps in a copy with new values for
+	// the settings it can apply while running
+	cfg atomic.Pointer[Config]
+
+	// Pauses status monitoring of the LLM during AI generation
+	isAIGenerating atomic.Bool
+
+	// Stops the service status monitor, its in-flight checks and the
+	// upstream event consumers
+	monitorCtx  context.Context
+	stopMonitor context.CancelFunc
+
+	// Last known LLM status, preserved during generation
+	lastKnownLLMStatus atomic.Value
+
+	// Set while the gateway is drained ahead of a shutdown: new SSE
+	// connections and ingestion are refused while in-flight requests finish
+	draining atomic.Bool
+
+	// Unset until the startup check has seen the critical services answer,
+	// which are listed in startupWaiting until then
+	ready          atomic.Bool
+	startupMu      sync.Mutex
+	startupWaiting []string
+
+	// Latest status per service as seen by the status monitor
+	statusMu      sync.RWMutex
+	serviceStatus map[string]string
+
+	// Last processed vision frame, used for frame deduplication
+	frameMu   sync.Mutex
+	lastFrame lastFrame
+
+	// Cancel functions of in-flight thought generations by request ID
+	genMu       sync.Mutex
+	generations map[string]context.CancelFunc
+
+	// Recent per-frame affect, smoothed into affect.trend events
+	affect *affectWindow
+
+	// Slots for ML calls, nil when MLConcurrency is unset
+	mlSlots *fairLimiter
+
+	// Event stream connections per IP, counted against SSEReconnectLimit
+	reconnects *reconnectLimiter
+
+	// Sheds ingestion while too many requests fail across the pipeline
+	pipeline pipelineCircuit
+
+	// Failed downstream calls by service and outcome, for /metrics
+	failures downstreamFailures
+
+	// Requests being served, counted against MaxInFlight
+	inFlight atomic.Int64
+
+	// Base URL overrides per service, set with SetServiceURL
+	urlMu       sync.RWMutex
+	serviceURLs map[string]string
+}
+
+// NewGateway returns a Gateway using cfg and http.DefaultClient. Settings
+// left at zero that have no meaning at zero, such as timeouts and buffer
+// sizes, take their DefaultConfig values.
+func NewGateway(cfg Config) *Gateway {
+	cfg = cfg.withDefaults()
+	g := &Gateway{
+		hub:    NewSSEHub(),
+		client: http.DefaultClient,
+		clock:  systemClock{},
+
+		serviceStatus: make(map[string]string),
+		serviceURLs:   make(map[string]string),
+		generations:   make(map[string]context.CancelFunc),
+		affect:        newAffectWindow(cfg.AffectWindow, cfg.AffectTrendInterval),
+		mlSlots:       newFairLimiter(cfg.MLConcurrency, cfg.MLQueueDepth),
+		reconnects:    newReconnectLimiter(),
+	}
+	g.cfg.Store(&cfg)
+	g.hub.writeTimeout = cfg.SSEWriteTimeout
+	g.hub.maxLifetime = cfg.SSEMaxLifetime
+	g.hub.bufferSize = cfg.SSEClientBuffer
+	g.hub.broadcastWorkers = cfg.SSEBroadcastWorkers
+	g.hub.wsCompression = cfg.WSCompression
+	g.hub.wsBinaryThreshold = cfg.WSBinaryThreshold
+	g.hub.history = newEventHistory(cfg.SSEHistorySize)
+	g.hub.historyExclude = make(map[string]bool)
+	for _, eventType := range cfg.SSEHistoryExclude {
+		g.hub.historyExclude[eventType] = true
+	}
+	if cfg.SSEBroadcastQueue > 0 {
+		g.hub.startQueue(cfg.SSEBroadcastQueue)
+	}
+	if cfg.EventLogPath != "" {
+		g.hub.recorder = newEventRecorder("event log", &fileSink{path: cfg.EventLogPath, compress: cfg.EventLogCompress}, cfg.EventLogQueue, cfg.EventLogFlushInterval)
+	}
+	for _, hook := range cfg.Webhooks {
+		g.hub.webhooks = append(g.hub.webhooks, newWebhook(hook, cfg.WebhookQueue))
+	}
+	g.monitorCtx, g.stopMonitor = context.WithCancel(context.Background())
+	g.lastKnownLLMStatus.Store("unknown")
+	g.ready.Store(!cfg.StartupCheck)
+	return g
+}
+
+// config returns the settings in effect. Callers must not modify them.
+func (g *Gateway) config() *Config {
+	return g.cfg.Load()
+}
+
+// Config returns a copy of the settings in effect.
+func (g *Gateway) Config() Config {
+	return *g.config()
+}
+
+// Hub returns the gateway's SSE hub.
+func (g *Gateway) Hub() *SSEHub {
+	return g.hub
+}
+
+// Close stops the service status monitor, canceling any health checks
+// still in flight, disconnects from upstream event streams and flushes the
+// broadcast, event log and webhook queues until ctx is done.
+func (g *Gateway) Close(ctx context.Context) error {
+	g.stopMonitor()
+	var errs []error
+	errs = append(errs, g.hub.stopQueue(ctx))
+	if g.hub.recorder != nil {
+		errs = append(errs, g.hub.recorder.close(ctx))
+	}
+	for _, wh := range g.hub.webhooks {
+		errs = append(errs, wh.rec.close(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// SetClient replaces the client used for downstream calls.
+func (g *Gateway) SetClient(c Client) {
+	g.client = c
+}
+
+// SetServiceURL routes calls for service (such as "ml" or "sentience") to
+// baseURL instead of its default localhost port, e.g. an httptest.Server URL.
+// An empty baseURL removes the override.
+func (g *Gateway) SetServiceURL(service, baseURL string) {
+	g.urlMu.Lock()
+	defer g.urlMu.Unlock()
+	if baseURL == "" {
+		delete(g.serviceURLs, service)
+		return
+	}
+	g.serviceURLs[service] = strings.TrimSuffix(baseURL, "/")
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestGateway returns a gateway built from cfg with its routes served by
+// a test server. The status monitor and other background loops are stopped
+// before they start, since the monitor would probe the backends' default
+// ports; tests stub the backends they need with stubService instead.
+func newTestGateway(t *testing.T, cfg Config) (*Gateway, *httptest.Server) {
+	t.Helper()
+	return newTestGatewayWith(t, cfg, nil)
+}
+
+// newTestGatewayWith is newTestGateway with setup run on the gateway before
+// its routes are registered, for setters such as SetClient and SetClock
+// that must not race with the background loops.
+func newTestGatewayWith(t *testing.T, cfg Config, setup func(*Gateway)) (*Gateway, *httptest.Server) {
+	t.Helper()
+	g := NewGateway(cfg)
+	if setup != nil {
+		setup(g)
+	}
+	g.stopMonitor()
+	mux := http.NewServeMux()
+	g.RegisterRoutes(mux)
+	srv := serve(t, mux)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		g.Close(ctx)
+	})
+	return g, srv
+}
+
+// stubService routes g's calls to service to a test server running h.
+func stubService(t *testing.T, g *Gateway, service string, h http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := serve(t, h)
+	g.SetServiceURL(service, srv.URL)
+	return srv
+}
+
+// doRequest sends a request with an optional body and headers given as
+// key, value pairs, returning the response with its body read.
+func doRequest(t *testing.T, method, url, body string, header ...string) (*http.Response, string) {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+// fixedClock is a Clock stopped at one instant.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// Canned backend responses for the vision and speech pipelines.
+const (
+	clipResponse    = `{"topk":[{"label":"person","score":0.91},{"label":"dog","score":0.05}],"embedding":[0.1,0.2,0.3],"dominant_color":"red","affect_valence":0.6,"affect_arousal":0.4}`
+	whisperResponse = `{"transcript":"hello there","confidence":0.93,"language":"en"}`
+	textResponse    = `{"embedding":[0.4,0.5,0.6]}`
+	runResponse     = `{"type":"sentience.token","embedding_id":"e1","facets":{"vision.object":"person"}}`
+)
+
+// backendCalls records the request bodies a stubbed backend received, by
+// path.
+type backendCalls struct {
+	mu     sync.Mutex
+	bodies map[string][]string
+}
+
+func (c *backendCalls) add(path, body string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bodies[path] = append(c.bodies[path], body)
+}
+
+// get returns the bodies received on path, oldest first.
+func (c *backendCalls) get(path string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.bodies[path]...)
+}
+
+// stubPipeline stubs the ML and sentience services with responses by path,
+// such as "/infer/clip" or "/run". Paths without a response answer 500.
+func stubPipeline(t *testing.T, g *Gateway, responses map[string]string) *backendCalls {
+	t.Helper()
+	calls := &backendCalls{bodies: make(map[string][]string)}
+	h := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls.add(r.URL.Path, string(body))
+		resp, ok := responses[r.URL.Path]
+		if !ok {
+			http.Error(w, "no stub for "+r.URL.Path, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(resp))
+	}
+	stubService(t, g, serviceML, h)
+	stubService(t, g, serviceSentience, h)
+	return calls
+}
+
+// defaultPipeline is the responses of a healthy vision and speech pipeline.
+func defaultPipeline() map[string]string {
+	return map[string]string{
+		"/infer/clip":    clipResponse,
+		"/infer/whisper": whisperResponse,
+		"/infer/text":    textResponse,
+		"/run":           runResponse,
+	}
+}
+
+// recordedEvents returns the events of type typ in g's event history, or
+// every recorded event when typ is empty.
+func recordedEvents(t *testing.T, g *Gateway, typ string) []map[string]any {
+	t.Helper()
+	g.hub.mu.Lock()
+	history := g.hub.history.since(0)
+	g.hub.mu.Unlock()
+	var events []map[string]any
+	for _, ev := range history {
+		decoded := decodeEvent(t, ev.data)
+		if typ == "" || decoded["type"] == typ {
+			events = append(events, decoded)
+		}
+	}
+	return events
+}
+
+func TestGatewaysHaveIsolatedHubs(t *testing.T) {
+	first, firstSrv := newTestGateway(t, Config{})
+	second, secondSrv := newTestGateway(t, Config{})
+	if first.Hub() == second.Hub() {
+		t.Fatal("two gateways share a hub")
+	}
+
+	firstStream := openSSE(t, firstSrv.URL+"/events", nil)
+	secondStream := openSSE(t, secondSrv.URL+"/events", nil)
+	firstStream.expect("connection")
+	secondStream.expect("connection")
+
+	first.Hub().Broadcast(`{"type":"first.only"}`)
+	second.Hub().Broadcast(`{"type":"second.only"}`)
+	firstStream.expect("first.only")
+	secondStream.expect("second.only")
+
+	if events := recordedEvents(t, first, "second.only"); len(events) != 0 {
+		t.Errorf("first gateway recorded the second's event: %v", events)
+	}
+	if events := recordedEvents(t, second, "first.only"); len(events) != 0 {
+		t.Errorf("second gateway recorded the first's event: %v", events)
+	}
+}
+
+func TestZeroConfigGatewayUsesDefaults(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	def := DefaultConfig()
+	cfg := g.Config()
+	if cfg.SSEWriteTimeout != def.SSEWriteTimeout || cfg.SSEClientBuffer != def.SSEClientBuffer || cfg.EmbeddingsBatchConcurrency != def.EmbeddingsBatchConcurrency {
+		t.Errorf("zero-valued config kept zero settings: %+v", cfg)
+	}
+	if g.hub.writeTimeout <= 0 || g.hub.bufferSize <= 0 {
+		t.Errorf("hub write timeout %s and buffer size %d, want the defaults", g.hub.writeTimeout, g.hub.bufferSize)
+	}
+
+	// A client must still receive events rather than time out every write
+	stream := openSSE(t, srv.URL+"/events", nil)
+	stream.expect("connection")
+	g.Hub().Broadcast(`{"type":"marker"}`)
+	stream.expect("marker")
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// streamPatterns are the routes whose response never ends, so HEAD makes no
+// sense for them.
+var streamPatterns = []string{"/events", "/ws"}
+
+// headWriter swallows the body of a HEAD response, counting its length so
+// Content-Length still tells the client what a GET would return. The
+// status is held back until the handler is done, when the length is known.
+type headWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (hw *headWriter) WriteHeader(status int) {
+	if hw.status == 0 {
+		hw.status = status
+	}
+}
+
+func (hw *headWriter) Write(p []byte) (int, error) {
+	hw.n += int64(len(p))
+	return len(p), nil
+}
+
+// Flush is a no-op so streaming handlers do not send the headers early.
+func (hw *headWriter) Flush() {}
+
+// finish sends the headers, adding a Content-Length unless the handler set
+// one itself.
+func (hw *headWriter) finish() {
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+	if hw.Header().Get("Content-Length") == "" && hw.n > 0 {
+		hw.Header().Set("Content-Length", strconv.FormatInt(hw.n, 10))
+	}
+	hw.ResponseWriter.WriteHeader(hw.status)
+}
+
+// isHead reports whether w belongs to a HEAD request, so a handler can skip
+// producing a body it knows the length of.
+func isHead(w http.ResponseWriter) bool {
+	_, ok := w.(*headWriter)
+	return ok
+}
+
+// WithHead serves HEAD requests with h as if they were GET requests,
+// without writing the body.
+func WithHead(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			h(w, r)
+			return
+		}
+		r = r.WithContext(r.Context())
+		r.Method = http.MethodGet
+		hw := &headWriter{ResponseWriter: w}
+		h(hw, r)
+		hw.finish()
+	}
+}
+
+// headMethods adds HEAD to the methods of a route that accepts GET and is
+// not a stream.
+func headMethods(pattern string, methods []string) []string {
+	if !slices.Contains(methods, http.MethodGet) || slices.Contains(methods, http.MethodHead) || slices.Contains(streamPatterns, pattern) {
+		return methods
+	}
+	return append(methods, http.MethodHead)
+}
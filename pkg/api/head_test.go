@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// serveRecorded runs srv's handler for method and path directly, so a body
+// written for HEAD shows up instead of being dropped by the server.
+func serveRecorded(srv *httptest.Server, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	srv.Config.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestHeadMatchesGetWithoutBody(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	calls := &backendCalls{bodies: map[string][]string{}}
+	stubService(t, g, serviceEmbeddings, func(w http.ResponseWriter, r *http.Request) {
+		calls.add(r.URL.Path, r.Method)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"id":"e1","embedding":[0.1,0.2]}]`))
+	})
+
+	for _, path := range []string{"/api/embeddings", "/api/config", "/readyz"} {
+		t.Run(path, func(t *testing.T) {
+			get := serveRecorded(srv, http.MethodGet, path)
+			head := serveRecorded(srv, http.MethodHead, path)
+
+			if head.Code != get.Code {
+				t.Errorf("HEAD status %d, GET %d", head.Code, get.Code)
+			}
+			if head.Body.Len() != 0 {
+				t.Errorf("HEAD wrote a %d byte body", head.Body.Len())
+			}
+			if want := strconv.Itoa(get.Body.Len()); head.Header().Get("Content-Length") != want {
+				t.Errorf("HEAD Content-Length %q, want the GET body's %s", head.Header().Get("Content-Length"), want)
+			}
+			if got, want := head.Header().Get("Content-Type"), get.Header().Get("Content-Type"); got != want {
+				t.Errorf("HEAD Content-Type %q, want %q", got, want)
+			}
+		})
+	}
+	for _, method := range calls.get("/embeddings") {
+		if method != http.MethodGet {
+			t.Errorf("HEAD forwarded downstream as %s, want GET", method)
+		}
+	}
+}
+
+func TestHeadNotAllowedOnStreams(t *testing.T) {
+	_, srv := newTestGateway(t, Config{})
+	for _, path := range streamPatterns {
+		resp, _ := doRequest(t, http.MethodHead, srv.URL+path, "")
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("HEAD %s: status %d, want 405", path, resp.StatusCode)
+		}
+	}
+}
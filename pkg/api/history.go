@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// EventSchemaVersion is the version of the event shapes, sent as
+// "schema_version" on every broadcast event. It is bumped whenever the
+// fields of an event change, so clients can tell which shape they parse.
+const EventSchemaVersion = 1
+
+// sseEvent is a message queued for an SSE client. Broadcast events carry an
+// id, their sequence number within the hub's epoch; targeted sends have none.
+// Broadcasts of a type excluded from the history have none either, and are
+// marked live instead.
+type sseEvent struct {
+	id   uint64
+	data string
+	live bool
+}
+
+// broadcast reports whether ev was broadcast, as opposed to a control event
+// such as a ping sent to one client.
+func (ev sseEvent) broadcast() bool {
+	return ev.id > 0 || ev.live
+}
+
+// eventHistory is a fixed-size ring of the most recent broadcast events,
+// kept so reconnecting clients can catch up. The event with sequence number
+// n lives at index (n-1) % len(events).
+type eventHistory struct {
+	events []sseEvent
+	last   uint64
+}
+
+func newEventHistory(size int) eventHistory {
+	return eventHistory{events: make([]sseEvent, size)}
+}
+
+// add assigns data the next sequence number and stores it. JSON objects
+// also get the number as a "seq" field, so clients can spot gaps without
+// tracking SSE ids.
+func (hs *eventHistory) add(data string) sseEvent {
+	hs.last++
+	ev := sseEvent{id: hs.last, data: withSeq(data, hs.last)}
+	if len(hs.events) > 0 {
+		hs.events[(ev.id-1)%uint64(len(hs.events))] = ev
+	}
+	return ev
+}
+
+// withSeq inserts a "seq" field at the start of a JSON object. Anything
+// else is returned unchanged.
+func withSeq(data string, seq uint64) string {
+	return prependField(data, fmt.Sprintf(`"seq":%d`, seq))
+}
+
+// withSchemaVersion inserts a "schema_version" field at the start of a JSON
+// object that does not have one yet. Anything else is returned unchanged.
+func withSchemaVersion(data string) string {
+	var event struct {
+		SchemaVersion json.RawMessage `json:"schema_version"`
+	}
+	if json.Unmarshal([]byte(data), &event) != nil || event.SchemaVersion != nil {
+		return data
+	}
+	return prependField(data, `"schema_version":`+strconv.Itoa(EventSchemaVersion))
+}
+
+// prependField inserts field, a "name":value pair, at the start of a JSON
+// object. Anything else is returned unchanged.
+func prependField(data, field string) string {
+	trimmed := strings.TrimSpace(data)
+	if !strings.HasPrefix(trimmed, "{") || !json.Valid([]byte(trimmed)) {
+		return data
+	}
+	rest := strings.TrimSpace(trimmed[1:])
+	if rest == "}" {
+		return "{" + field + "}"
+	}
+	return "{" + field + "," + rest
+}
+
+// oldest returns the sequence number of the oldest retained event, or
+// last+1 when nothing is retained.
+func (hs *eventHistory) oldest() uint64 {
+	retained := min(hs.last, uint64(len(hs.events)))
+	return hs.last - retained + 1
+}
+
+// since returns the retained events after seq, oldest first.
+func (hs *eventHistory) since(seq uint64) []sseEvent {
+	var events []sseEvent
+	for n := max(seq+1, hs.oldest()); n <= hs.last; n++ {
+		events = append(events, hs.events[(n-1)%uint64(len(hs.events))])
+	}
+	return events
+}
+
+// checkpoint is the point in a hub's event stream a client has seen up to.
+// The epoch identifies the hub instance, so checkpoints from before a
+// restart are recognized as stale.
+type checkpoint struct {
+	epoch string
+	seq   uint64
+}
+
+// resumeToken encodes cp as the opaque token clients store and send back
+// with ?resume= when reconnecting.
+func resumeToken(cp checkpoint) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "v1.%s.%d", cp.epoch, cp.seq))
+}
+
+var errInvalidResumeToken = errors.New("invalid resume token")
+
+func parseResumeToken(token string) (checkpoint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return checkpoint{}, errInvalidResumeToken
+	}
+	parts := strings.Split(string(raw), ".")
+	if len(parts) != 3 || parts[0] != "v1" || parts[1] == "" {
+		return checkpoint{}, errInvalidResumeToken
+	}
+	seq, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return checkpoint{}, errInvalidResumeToken
+	}
+	return checkpoint{epoch: parts[1], seq: seq}, nil
+}
+
+// requestCheckpoint returns where a reconnecting client left off: the
+// ?resume= token if present, otherwise a numeric Last-Event-ID, which is
+// taken to belong to the current epoch. It returns nil for a fresh client.
+func (h *SSEHub) requestCheckpoint(r *http.Request) (*checkpoint, error) {
+	if token := r.URL.Query().Get("resume"); token != "" {
+		cp, err := parseResumeToken(token)
+		if err != nil {
+			return nil, err
+		}
+		return &cp, nil
+	}
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Last-Event-ID %q", v)
+		}
+		return &checkpoint{epoch: h.epoch, seq: seq}, nil
+	}
+	return nil, nil
+}
+
+// parseCatchup returns how many past events a new client asked to be
+// replayed with ?catchup=, or 0 when it did not ask or asked for a number
+// that is not positive.
+func parseCatchup(r *http.Request) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("catchup"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// resumeFrom decides how a client at cp catches up. It returns the events
+// to replay, or a non-empty reason when the gap cannot be covered and the
+// client has to resync from scratch. h.mu must be held.
+func (h *SSEHub) resumeFrom(cp checkpoint) ([]sseEvent, string) {
+	visible := h.visible()
+	switch {
+	case cp.epoch != h.epoch:
+		return nil, "server restarted"
+	case cp.seq > visible:
+		return nil, "unknown checkpoint"
+	case cp.seq+1 < h.history.oldest():
+		return nil, "gap exceeds event history"
+	}
+
+	// Events held back by a pause are sent when broadcasting resumes
+	replay := h.history.since(cp.seq)
+	for len(replay) > 0 && replay[len(replay)-1].id > visible {
+		replay = replay[:len(replay)-1]
+	}
+	return replay, ""
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// connectToken opens a stream on srvURL and returns the resume token its
+// connection event carries.
+func connectToken(t *testing.T, srvURL string) string {
+	t.Helper()
+	conn := openSSE(t, srvURL, nil)
+	token, _ := conn.expect("connection")["resume_token"].(string)
+	if token == "" {
+		t.Fatal("connection event without a resume token")
+	}
+	return token
+}
+
+func TestResumeTokenReplaysShortGap(t *testing.T) {
+	hub := NewSSEHub()
+	hub.history = newEventHistory(4)
+	srv := serve(t, hub)
+	token := connectToken(t, srv.URL)
+
+	hub.Broadcast(`{"type":"missed","n":1}`)
+	hub.Broadcast(`{"type":"missed","n":2}`)
+
+	resumed := openSSE(t, srv.URL+"?resume="+url.QueryEscape(token), nil)
+	resumed.expect("connection")
+	for n := 1.0; n <= 2; n++ {
+		if ev := resumed.expect("missed"); ev["n"] != n {
+			t.Errorf("replayed %v, want missed event %v", ev, n)
+		}
+	}
+	hub.Broadcast(`{"type":"live"}`)
+	resumed.expect("live")
+}
+
+func TestResumeTokenPastHistoryRequiresResync(t *testing.T) {
+	hub := NewSSEHub()
+	hub.history = newEventHistory(4)
+	srv := serve(t, hub)
+	token := connectToken(t, srv.URL)
+
+	for n := range 10 {
+		hub.Broadcast(fmt.Sprintf(`{"type":"missed","n":%d}`, n))
+	}
+
+	for name, tc := range map[string]struct{ token, reason string }{
+		"long gap":     {token, "gap exceeds event history"},
+		"other epoch":  {resumeToken(checkpoint{epoch: "restarted", seq: 1}), "server restarted"},
+		"future point": {resumeToken(checkpoint{epoch: hub.epoch, seq: 99}), "unknown checkpoint"},
+		"garbage":      {"not-a-token", "invalid resume token"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			stream := openSSE(t, srv.URL+"?resume="+url.QueryEscape(tc.token), nil)
+			stream.expect("connection")
+			ev := stream.expect("resync_required")
+			if ev["reason"] != tc.reason || ev["resume_token"] == "" {
+				t.Errorf("resync event %v, want reason %q and a fresh token", ev, tc.reason)
+			}
+			// Nothing from the gap is replayed after the resync
+			hub.Broadcast(`{"type":"live"}`)
+			stream.expect("live")
+		})
+	}
+}
+
+func TestBroadcastSeqIncrementsByOne(t *testing.T) {
+	hub := NewSSEHub()
+	srv := serve(t, hub)
+	stream := openSSE(t, srv.URL, nil)
+	if ev := stream.expect("connection"); ev["seq"] != nil {
+		t.Errorf("connection event carries seq %v, want none on targeted sends", ev["seq"])
+	}
+
+	for range 5 {
+		hub.Broadcast(`{"type":"tick"}`)
+	}
+	for want := 1; want <= 5; want++ {
+		m := stream.nextMessage()
+		if ev := decodeEvent(t, m.Data); ev["seq"] != float64(want) || m.ID != fmt.Sprint(want) {
+			t.Errorf("event id %s seq %v, want both %d", m.ID, ev["seq"], want)
+		}
+	}
+}
+
+func TestEventHistorySeqAcrossRingWrap(t *testing.T) {
+	history := newEventHistory(3)
+	for n := 1; n <= 7; n++ {
+		if ev := history.add(`{"type":"tick"}`); ev.data != fmt.Sprintf(`{"seq":%d,"type":"tick"}`, n) {
+			t.Fatalf("event %d stored as %s", n, ev.data)
+		}
+	}
+	if got := history.oldest(); got != 5 {
+		t.Errorf("oldest retained seq %d, want 5", got)
+	}
+	retained := history.since(0)
+	if len(retained) != 3 {
+		t.Fatalf("retained %d events, want 3", len(retained))
+	}
+	for i, ev := range retained {
+		if want := uint64(5 + i); ev.id != want || ev.data != fmt.Sprintf(`{"seq":%d,"type":"tick"}`, want) {
+			t.Errorf("retained %d: id %d %s, want seq %d", i, ev.id, ev.data, want)
+		}
+	}
+	if got := history.since(6); len(got) != 1 || got[0].id != 7 {
+		t.Errorf("since 6 returned %v, want only event 7", got)
+	}
+}
+
+func TestWithSeq(t *testing.T) {
+	for data, want := range map[string]string{
+		`{"type":"tick"}`: `{"seq":4,"type":"tick"}`,
+		` { } `:           `{"seq":4}`,
+		`not json`:        `not json`,
+		`[1,2]`:           `[1,2]`,
+		`{"broken":`:      `{"broken":`,
+	} {
+		if got := withSeq(data, 4); got != want {
+			t.Errorf("withSeq(%q) = %q, want %q", data, got, want)
+		}
+	}
+}
+
+func TestWithSchemaVersion(t *testing.T) {
+	for data, want := range map[string]string{
+		`{"type":"tick"}`:                   `{"schema_version":1,"type":"tick"}`,
+		`{}`:                                `{"schema_version":1}`,
+		`{"schema_version":0,"type":"old"}`: `{"schema_version":0,"type":"old"}`,
+		`not json`:                          `not json`,
+		`[1,2]`:                             `[1,2]`,
+	} {
+		if got := withSchemaVersion(data); got != want {
+			t.Errorf("withSchemaVersion(%q) = %q, want %q", data, got, want)
+		}
+	}
+}
+
+func TestEventsCarrySchemaVersion(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	stubPipeline(t, g, defaultPipeline())
+	stream := openSSE(t, srv.URL+"/events", nil)
+
+	events := []map[string]any{stream.expect("connection")}
+	g.hub.Broadcast(`{"type":"marker"}`)
+	events = append(events, stream.expect("marker"))
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame); resp.StatusCode != http.StatusOK {
+		t.Fatalf("vision frame: status %d %s", resp.StatusCode, body)
+	}
+	// Every pipeline event up to the observation
+	for events[len(events)-1]["type"] != "vision.observation" {
+		events = append(events, stream.next())
+	}
+	for _, ev := range events {
+		if ev["schema_version"] != float64(EventSchemaVersion) {
+			t.Errorf("%v event has schema_version %v, want %d", ev["type"], ev["schema_version"], EventSchemaVersion)
+		}
+	}
+
+	_, body := doRequest(t, http.MethodGet, srv.URL+"/api/config", "")
+	var cfg struct {
+		EventSchemaVersion *int `json:"event_schema_version"`
+	}
+	if err := json.Unmarshal([]byte(body), &cfg); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	if cfg.EventSchemaVersion == nil || *cfg.EventSchemaVersion != EventSchemaVersion {
+		t.Errorf("/api/config event_schema_version %v, want %d", cfg.EventSchemaVersion, EventSchemaVersion)
+	}
+}
+
+func TestExcludedEventsAreLiveOnly(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	g, srv := newTestGateway(t, Config{
+		SSEHistoryExclude:     []string{"ping", "service.status", "noise"},
+		EventLogPath:          logPath,
+		EventLogFlushInterval: 10 * time.Millisecond,
+	})
+	stream := openSSE(t, srv.URL+"/events", nil)
+	stream.expect("connection")
+
+	broadcast := []string{"ping", "noise", "marker", "service.status", "kept"}
+	for _, typ := range broadcast {
+		g.hub.Broadcast(fmt.Sprintf(`{"type":%q}`, typ))
+	}
+	// Excluded events still reach connected clients
+	for _, typ := range broadcast {
+		stream.expect(typ)
+	}
+
+	var recorded []any
+	for _, ev := range recordedEvents(t, g, "") {
+		recorded = append(recorded, ev["type"], ev["seq"])
+	}
+	if want := []any{"marker", 1.0, "kept", 2.0}; !reflect.DeepEqual(recorded, want) {
+		t.Errorf("history %v, want %v", recorded, want)
+	}
+
+	var logged []string
+	deadline := time.Now().Add(2 * time.Second)
+	for !slices.Contains(logged, "kept") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		data, _ := os.ReadFile(logPath)
+		logged = nil
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var entry struct {
+				Event struct {
+					Type string `json:"type"`
+				} `json:"event"`
+			}
+			if json.Unmarshal([]byte(line), &entry) == nil {
+				logged = append(logged, entry.Event.Type)
+			}
+		}
+	}
+	if want := []string{"marker", "kept"}; !slices.Equal(logged, want) {
+		t.Errorf("event log has %v, want %v", logged, want)
+	}
+
+	// A resuming client is replayed only the recorded events
+	resumed := openSSE(t, srv.URL+"/events?catchup=10", nil)
+	resumed.expect("connection")
+	resumed.expect("marker")
+	resumed.expect("kept")
+	resumed.quiet(50 * time.Millisecond)
+}
+
+func TestHistoryExcludeDefaults(t *testing.T) {
+	t.Setenv("SSE_HISTORY_EXCLUDE", "")
+	if got := LoadConfig().SSEHistoryExclude; !slices.Equal(got, []string{"ping", "service.status"}) {
+		t.Errorf("SSEHistoryExclude %v, want ping and service.status", got)
+	}
+}
+
+func TestCatchupReplaysLastEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		history int
+		query   string
+		want    []string
+	}{
+		{name: "last five", query: "?catchup=5", want: []string{"e4", "e5", "e6", "e7", "e8"}},
+		{name: "clamped to the history", history: 3, query: "?catchup=100", want: []string{"e6", "e7", "e8"}},
+		{name: "zero", query: "?catchup=0"},
+		{name: "negative", query: "?catchup=-3"},
+		{name: "not a number", query: "?catchup=all"},
+		{name: "not asked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{SSEHistorySize: tt.history})
+			for i := 1; i <= 8; i++ {
+				g.hub.Broadcast(fmt.Sprintf(`{"type":"e%d"}`, i))
+			}
+
+			stream := openSSE(t, srv.URL+"/events"+tt.query, nil)
+			stream.expect("connection")
+			for _, typ := range tt.want {
+				stream.expect(typ)
+			}
+			// Live events follow the replay
+			g.hub.Broadcast(`{"type":"live"}`)
+			stream.expect("live")
+		})
+	}
+}
+
+func TestResumeTakesPrecedenceOverCatchup(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	watcher := openSSE(t, srv.URL+"/events", nil)
+	watcher.expect("connection")
+	var ids []string
+	for i := 1; i <= 8; i++ {
+		g.hub.Broadcast(fmt.Sprintf(`{"type":"e%d"}`, i))
+		ids = append(ids, watcher.nextMessage().ID)
+	}
+
+	stream := openSSE(t, srv.URL+"/events?catchup=5", http.Header{"Last-Event-ID": {ids[5]}})
+	stream.expect("connection")
+	stream.expect("e7")
+	stream.expect("e8")
+	stream.quiet(50 * time.Millisecond)
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// dropAtMaxHops refuses an ingested event that has already been relayed
+// MaxEventHops times, so a client feeding the gateway's own broadcasts back
+// into it cannot start an endless event storm. It broadcasts a warning,
+// answers 422 and reports true when the event was dropped.
+func (g *Gateway) dropAtMaxHops(w http.ResponseWriter, r *http.Request, stage string, hops int) bool {
+	if hops < g.config().MaxEventHops {
+		return false
+	}
+
+	g.broadcastWarning(r.Context(), stage, fmt.Sprintf("event dropped after %d hops (max %d)", hops, g.config().MaxEventHops))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.Write([]byte(`{"ok":false,"error":"max event hops exceeded"}`))
+	return true
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEventAtMaxHopsIsDropped(t *testing.T) {
+	g, srv := newTestGateway(t, Config{MaxEventHops: 3})
+	calls := stubPipeline(t, g, defaultPipeline())
+
+	for _, req := range []struct{ path, body, stage string }{
+		{"/api/vision/frame", `{"image_base64":"aGVsbG8=","hops":3}`, "vision"},
+		{"/api/speech/transcript", `{"audio_base64":"UklGRgAAAABXQVZF","hops":3}`, "speech"},
+	} {
+		resp, body := doRequest(t, http.MethodPost, srv.URL+req.path, req.body)
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s at max hops: status %d, want 422: %s", req.path, resp.StatusCode, body)
+		}
+		warnings := recordedEvents(t, g, "pipeline.warning")
+		if len(warnings) == 0 || warnings[len(warnings)-1]["stage"] != req.stage {
+			t.Errorf("%s at max hops: warnings %v, want one from the %s stage", req.path, warnings, req.stage)
+		}
+	}
+	if clip, whisper := calls.get("/infer/clip"), calls.get("/infer/whisper"); len(clip)+len(whisper) != 0 {
+		t.Error("dropped events reached the ML service")
+	}
+}
+
+func TestEventBelowMaxHopsIsRelayedWithOneMoreHop(t *testing.T) {
+	g, srv := newTestGateway(t, Config{MaxEventHops: 3})
+	stubPipeline(t, g, defaultPipeline())
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", `{"image_base64":"aGVsbG8=","hops":2}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	observations := recordedEvents(t, g, "vision.observation")
+	if len(observations) != 1 || observations[0]["hops"] != 3.0 {
+		t.Errorf("observations %v, want one at 3 hops", observations)
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+)
+
+// overloadRetryAfter is the Retry-After sent when the gateway sheds a
+// request for being at its in-flight limit. Requests finish quickly, so a
+// retry soon after is likely to get through.
+const overloadRetryAfter = "1"
+
+// inFlightExempt are the paths that do not count against MaxInFlight: the
+// event streams, which stay open for as long as a client is connected, and
+// the probes and metrics, which have to answer even while the gateway is
+// overloaded.
+var inFlightExempt = append([]string{"/healthz", "/readyz", "/ping", "/metrics"}, streamPatterns...)
+
+// LimitInFlight wraps the gateway's handler with a global backstop: once
+// MaxInFlight requests are being served, further ones get a 503 with
+// Retry-After until some finish. Preflights and the paths in
+// inFlightExempt are never shed, and without MaxInFlight nothing is.
+func (g *Gateway) LimitInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := g.config().MaxInFlight
+		if limit <= 0 || r.Method == http.MethodOptions || slices.Contains(inFlightExempt, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if g.inFlight.Add(1) > int64(limit) {
+			g.inFlight.Add(-1)
+			w.Header().Set("Retry-After", overloadRetryAfter)
+			http.Error(w, "gateway is overloaded, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		defer g.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestInFlightLimitShedsExcessButNotHealth(t *testing.T) {
+	g, srv := newTestGateway(t, Config{MaxInFlight: 2})
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[]`)
+	})
+	releaseOnce := func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}
+	t.Cleanup(releaseOnce)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", srv.Config.Handler)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+	limited := serve(t, g.LimitInFlight(mux))
+
+	held := make(chan int, 2)
+	for range 2 {
+		go func() {
+			resp, err := http.Get(limited.URL + "/api/memory")
+			if err != nil {
+				held <- 0
+				return
+			}
+			resp.Body.Close()
+			held <- resp.StatusCode
+		}()
+		<-entered
+	}
+
+	for _, path := range []string{"/api/memory", "/api/config"} {
+		resp, _ := doRequest(t, http.MethodGet, limited.URL+path, "")
+		if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != overloadRetryAfter {
+			t.Errorf("%s at the limit: status %d, Retry-After %q, want 503 with Retry-After", path, resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+	}
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		if resp, _ := doRequest(t, http.MethodGet, limited.URL+path, ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("%s at the limit: status %d, want 200", path, resp.StatusCode)
+		}
+	}
+	if resp, _ := doRequest(t, http.MethodOptions, limited.URL+"/api/config", ""); resp.StatusCode == http.StatusServiceUnavailable {
+		t.Error("preflight shed at the limit")
+	}
+	openSSE(t, limited.URL+"/events", nil).expect("connection")
+
+	releaseOnce()
+	for range 2 {
+		if status := <-held; status != http.StatusOK {
+			t.Errorf("held request: status %d, want 200", status)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for g.inFlight.Load() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := g.inFlight.Load(); n != 0 {
+		t.Errorf("%d requests counted in flight after all finished", n)
+	}
+	if resp, _ := doRequest(t, http.MethodGet, limited.URL+"/api/config", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("/api/config below the limit: status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestInFlightLimitOffByDefault(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	limited := serve(t, g.LimitInFlight(srv.Config.Handler))
+	g.inFlight.Store(1 << 20)
+	if resp, _ := doRequest(t, http.MethodGet, limited.URL+"/api/config", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d without MaxInFlight, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// runJanitor evicts stale cache entries every JanitorInterval until ctx is
+// done. The caches mostly clean up after themselves when they are next
+// used; the janitor bounds what a quiet gateway keeps holding between uses.
+func (g *Gateway) runJanitor(ctx context.Context) {
+	ticker := time.NewTicker(g.config().JanitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.sweep()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sweep evicts the remembered vision frame once it is past the dedup
+// window, the SSE sessions not seen within SSESessionTTL and the reconnect
+// counts of IPs that have not connected within SSEReconnectWindow.
+func (g *Gateway) sweep() {
+	cfg := g.config()
+	g.forgetExpiredFrame(cfg.VisionDedupWindow)
+	if cfg.SSESessionTTL > 0 {
+		g.hub.forgetStaleSessions(cfg.SSESessionTTL)
+	}
+	g.reconnects.sweep(g.now(), cfg.SSEReconnectWindow)
+}
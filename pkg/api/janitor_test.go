@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJanitorEvictsStaleEntries(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	g, _ := newTestGatewayWith(t, Config{
+		JanitorInterval:    20 * time.Millisecond,
+		SSESessionTTL:      time.Hour,
+		SSEReconnectWindow: 10 * time.Second,
+		VisionDedupWindow:  time.Minute,
+	}, func(g *Gateway) { g.SetClock(fixedClock(now)) })
+
+	g.frameMu.Lock()
+	g.lastFrame = lastFrame{cameraID: "stale", processedAt: time.Now().Add(-2 * time.Minute)}
+	g.frameMu.Unlock()
+	g.hub.mu.Lock()
+	g.hub.sessions["stale"] = sessionMark{seq: 1, seenAt: now.Add(-2 * time.Hour)}
+	g.hub.sessions["fresh"] = sessionMark{seq: 2, seenAt: now.Add(-time.Minute)}
+	g.hub.mu.Unlock()
+	g.reconnects.mu.Lock()
+	g.reconnects.hits["10.0.0.1"] = []time.Time{now.Add(-time.Minute)}
+	g.reconnects.hits["10.0.0.2"] = []time.Time{now.Add(-time.Second)}
+	// A sweep just ran, so connecting would not sweep on its own
+	g.reconnects.lastSweep = now
+	g.reconnects.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.runJanitor(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	swept := func() bool {
+		g.frameMu.Lock()
+		frame := g.lastFrame.cameraID
+		g.frameMu.Unlock()
+		g.hub.mu.Lock()
+		_, session := g.hub.sessions["stale"]
+		g.hub.mu.Unlock()
+		g.reconnects.mu.Lock()
+		_, ip := g.reconnects.hits["10.0.0.1"]
+		g.reconnects.mu.Unlock()
+		return frame == "" && !session && !ip
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !swept() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !swept() {
+		t.Fatal("stale entries still held after the janitor ran")
+	}
+
+	g.hub.mu.Lock()
+	_, session := g.hub.sessions["fresh"]
+	g.hub.mu.Unlock()
+	g.reconnects.mu.Lock()
+	_, ip := g.reconnects.hits["10.0.0.2"]
+	g.reconnects.mu.Unlock()
+	if !session || !ip {
+		t.Errorf("fresh session kept %v, recent IP kept %v, want both kept", session, ip)
+	}
+}
+
+func TestSweepKeepsSessionsWithoutTTL(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	g, _ := newTestGatewayWith(t, Config{}, func(g *Gateway) { g.SetClock(fixedClock(now)) })
+	g.hub.mu.Lock()
+	g.hub.sessions["old"] = sessionMark{seq: 1, seenAt: now.Add(-24 * time.Hour)}
+	g.hub.mu.Unlock()
+
+	g.sweep()
+
+	g.hub.mu.Lock()
+	defer g.hub.mu.Unlock()
+	if _, ok := g.hub.sessions["old"]; !ok {
+		t.Error("session forgotten with SSESessionTTL unset")
+	}
+}
+
+func TestJanitorSettingsFromEnv(t *testing.T) {
+	tests := []struct {
+		interval, ttl         string
+		wantInterval, wantTTL time.Duration
+	}{
+		{"", "", time.Minute, time.Hour},
+		{"0", "0", 0, 0},
+		{"30s", "10m", 30 * time.Second, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Setenv("JANITOR_INTERVAL", tt.interval)
+		t.Setenv("SSE_SESSION_TTL", tt.ttl)
+		cfg := LoadConfig()
+		if cfg.JanitorInterval != tt.wantInterval || cfg.SSESessionTTL != tt.wantTTL {
+			t.Errorf("JANITOR_INTERVAL=%q SSE_SESSION_TTL=%q gives %v and %v, want %v and %v",
+				tt.interval, tt.ttl, cfg.JanitorInterval, cfg.SSESessionTTL, tt.wantInterval, tt.wantTTL)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// memoryFilter holds the memory filters the sentience service cannot apply
+// itself, so the gateway applies them to the full memory set instead.
+type memoryFilter struct {
+	before     *float64
+	minValence *float64
+	source     string
+	limit      int
+}
+
+func (f memoryFilter) active() bool {
+	return f.before != nil || f.minValence != nil || f.source != ""
+}
+
+// parseMemoryFilter takes the gateway-side filters out of query, leaving the
+// parameters to forward. after is forwarded as the service's own since_ts.
+// While a gateway-side filter is active, limit is applied after filtering
+// rather than forwarded, so it counts matching events.
+func parseMemoryFilter(query url.Values) (memoryFilter, *ValidationError) {
+	var f memoryFilter
+	var verr ValidationError
+
+	parseFloat := func(name string) *float64 {
+		if !query.Has(name) {
+			return nil
+		}
+		v, err := strconv.ParseFloat(query.Get(name), 64)
+		query.Del(name)
+		if err != nil {
+			verr.Add(name, "must be a number")
+			return nil
+		}
+		return &v
+	}
+
+	if after := parseFloat("after"); after != nil && !query.Has("since_ts") {
+		query.Set("since_ts", strconv.FormatFloat(*after, 'f', -1, 64))
+	}
+	f.before = parseFloat("before")
+	f.minValence = parseFloat("min_valence")
+	f.source = query.Get("source")
+	query.Del("source")
+
+	if f.active() && query.Has("limit") {
+		n, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || n < 0 {
+			verr.Add("limit", "must be a non-negative integer")
+		}
+		f.limit = n
+		query.Del("limit")
+	}
+
+	if verr.Err() != nil {
+		return f, &verr
+	}
+	return f, nil
+}
+
+// matches reports whether a memory event passes the filter. Valence is read
+// from the event's affect.valence facet.
+func (f memoryFilter) matches(event map[string]any) bool {
+	if f.source != "" && event["source"] != f.source {
+		return false
+	}
+	if f.before != nil {
+		ts, ok := event["ts"].(float64)
+		if !ok || ts >= *f.before {
+			return false
+		}
+	}
+	if f.minValence != nil {
+		facets, _ := event["facets"].(map[string]any)
+		valence, ok := facets["affect.valence"].(float64)
+		if !ok || valence < *f.minValence {
+			return false
+		}
+	}
+	return true
+}
+
+// relayFiltered relays the memory events in a successful response that
+// pass f, keeping the service's newest-first order.
+func (g *Gateway) relayFiltered(w http.ResponseWriter, r *http.Request, resp *http.Response, f memoryFilter) {
+	if resp.StatusCode != http.StatusOK {
+		relay(w, resp)
+		return
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeStageError(w, "", serviceSentience, err, err.Error(), http.StatusBadGateway)
+		return
+	}
+	var events []map[string]any
+	if err := json.Unmarshal(b, &events); err != nil {
+		g.countFailure(serviceSentience, outcomeParseError)
+		writeStageError(w, "", serviceSentience, nil, "memory parse error", http.StatusBadGateway)
+		return
+	}
+
+	filtered := []map[string]any{}
+	for _, event := range events {
+		if f.limit > 0 && len(filtered) == f.limit {
+			break
+		}
+		if f.matches(event) {
+			filtered = append(filtered, event)
+		}
+	}
+
+	out, _ := json.Marshal(filtered)
+	w.Header().Set("Content-Type", "application/json")
+	if writeNotModified(w, r, bodyETag(out, "")) {
+		return
+	}
+	w.Write(out)
+}
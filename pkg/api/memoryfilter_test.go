@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// memorySet is a stubbed sentience memory, newest first.
+const memorySet = `[
+	{"embedding_id":"e4","ts":400,"source":"vision","facets":{"affect.valence":0.9}},
+	{"embedding_id":"e3","ts":300,"source":"speech","facets":{"affect.valence":0.2}},
+	{"embedding_id":"e2","ts":200,"source":"vision","facets":{"affect.valence":0.7}},
+	{"embedding_id":"e1","ts":100,"source":"speech"}
+]`
+
+func TestMemoryFiltersOnGateway(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	var mu sync.Mutex
+	var forwarded url.Values
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		forwarded = r.URL.Query()
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(memorySet))
+	})
+
+	for _, tc := range []struct {
+		query, forward string
+		want           []string
+	}{
+		{"before=300", "", []string{"e2", "e1"}},
+		{"min_valence=0.5", "", []string{"e4", "e2"}},
+		{"source=speech", "", []string{"e3", "e1"}},
+		{"before=400&min_valence=0.1", "", []string{"e3", "e2"}},
+		{"min_valence=0.1&limit=1", "", []string{"e4"}},
+		// after is forwarded as the service's own since_ts
+		{"after=150&source=vision", "since_ts=150", []string{"e4", "e2"}},
+		{"min_valence=2", "", []string{}},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/memory?"+tc.query, "")
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+			}
+			var events []struct {
+				EmbeddingID string `json:"embedding_id"`
+			}
+			if err := json.Unmarshal([]byte(body), &events); err != nil {
+				t.Fatalf("body %q is not a JSON array: %v", body, err)
+			}
+			got := []string{}
+			for _, ev := range events {
+				got = append(got, ev.EmbeddingID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if got := forwarded.Encode(); got != tc.forward {
+				t.Errorf("forwarded query %q, want %q", got, tc.forward)
+			}
+		})
+	}
+}
+
+func TestMemoryForwardsUnfilteredQuery(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	var mu sync.Mutex
+	var forwarded string
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		forwarded = r.URL.RawQuery
+		mu.Unlock()
+		w.Write([]byte(memorySet))
+	})
+
+	// Without a gateway-side filter, limit is the service's to apply
+	resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/memory?limit=1", "")
+	if resp.StatusCode != http.StatusOK || body != memorySet {
+		t.Errorf("status %d, want the service's memory set relayed untouched", resp.StatusCode)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if forwarded != "limit=1" {
+		t.Errorf("forwarded query %q, want limit=1", forwarded)
+	}
+}
+
+func TestMemoryRejectsInvalidFilters(t *testing.T) {
+	_, srv := newTestGateway(t, Config{})
+	for _, query := range []string{"before=soon", "min_valence=high", "after=x", "source=vision&limit=-1"} {
+		if resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/memory?"+query, ""); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d %s, want 400", query, resp.StatusCode, body)
+		}
+	}
+}
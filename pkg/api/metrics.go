@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"time"
+)
+
+// metricChange is how one consciousness metric moved since it was last
+// reported.
+type metricChange struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Delta float64 `json:"delta"`
+}
+
+// fetchMetrics returns the newest consciousness metrics snapshot from the
+// LLM service, keeping only its numeric fields. It returns nil when the
+// service has no metrics yet.
+func (g *Gateway) fetchMetrics(ctx context.Context) (map[string]float64, error) {
+	resp, err := g.get(ctx, serviceLLM, g.serviceURL(serviceLLM, "/consciousness-metrics?limit=1"), 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("llm service error: status %d", resp.StatusCode)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		Metrics []map[string]any `json:"metrics"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		g.countFailure(serviceLLM, outcomeParseError)
+		return nil, errors.New("llm parse error")
+	}
+	if len(out.Metrics) == 0 {
+		return nil, nil
+	}
+	snapshot := make(map[string]float64)
+	for name, value := range out.Metrics[len(out.Metrics)-1] {
+		if f, ok := value.(float64); ok {
+			snapshot[name] = f
+		}
+	}
+	return snapshot, nil
+}
+
+// metricsDelta compares a snapshot with the values last reported and
+// returns the metrics that moved at least their threshold. Metrics missing
+// from either side are not compared.
+func metricsDelta(reported, snapshot, thresholds map[string]float64) map[string]metricChange {
+	changes := make(map[string]metricChange)
+	for name, to := range snapshot {
+		from, ok := reported[name]
+		if !ok {
+			continue
+		}
+		threshold, ok := thresholds[name]
+		if !ok {
+			threshold = thresholds["default"]
+		}
+		if delta := to - from; math.Abs(delta) >= threshold && delta != 0 {
+			changes[name] = metricChange{From: from, To: to, Delta: delta}
+		}
+	}
+	return changes
+}
+
+// pollMetrics fetches the consciousness metrics every MetricsPollInterval
+// and broadcasts a consciousness.delta event when any moved past its
+// threshold, so clients no longer need to poll. Each metric is compared
+// with the value last reported rather than the previous poll, so a slow
+// drift is reported once it adds up. The first snapshot only sets the
+// baseline.
+func (g *Gateway) pollMetrics(ctx context.Context) {
+	ticker := time.NewTicker(g.config().MetricsPollInterval)
+	defer ticker.Stop()
+
+	var reported map[string]float64
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		snapshot, err := g.fetchMetrics(ctx)
+		if err != nil {
+			// The status monitor already reports the LLM service offline
+			if !errors.Is(err, errServiceOffline) && ctx.Err() == nil {
+				log.Printf("consciousness metrics poll failed: %v", err)
+			}
+			continue
+		}
+		if snapshot == nil {
+			continue
+		}
+		if reported == nil {
+			reported = snapshot
+			continue
+		}
+
+		changes := metricsDelta(reported, snapshot, g.config().MetricsThresholds)
+		for name := range snapshot {
+			if _, ok := reported[name]; !ok {
+				reported[name] = snapshot[name]
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		for name, change := range changes {
+			reported[name] = change.To
+		}
+		evBytes, _ := json.Marshal(map[string]any{
+			"type":      "consciousness.delta",
+			"changes":   changes,
+			"metrics":   snapshot,
+			"timestamp": g.timestamp(),
+		})
+		g.hub.Broadcast(string(evBytes))
+	}
+}
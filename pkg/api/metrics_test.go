@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetricsDelta(t *testing.T) {
+	thresholds := map[string]float64{"default": 0.1, "coherence": 0.3}
+	reported := map[string]float64{"awareness": 0.5, "coherence": 0.5}
+
+	tests := []struct {
+		name     string
+		snapshot map[string]float64
+		want     map[string]metricChange
+	}{
+		{"unchanged", map[string]float64{"awareness": 0.5, "coherence": 0.5}, map[string]metricChange{}},
+		{"below thresholds", map[string]float64{"awareness": 0.55, "coherence": 0.7}, map[string]metricChange{}},
+		{"default threshold", map[string]float64{"awareness": 0.25, "coherence": 0.5}, map[string]metricChange{
+			"awareness": {From: 0.5, To: 0.25, Delta: -0.25},
+		}},
+		{"own threshold", map[string]float64{"awareness": 0.5, "coherence": 0.9}, map[string]metricChange{
+			"coherence": {From: 0.5, To: 0.9, Delta: 0.9 - 0.5},
+		}},
+		{"new metric", map[string]float64{"focus": 0.9}, map[string]metricChange{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metricsDelta(reported, tt.snapshot, thresholds); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("metricsDelta = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPollMetricsBroadcastsSignificantChanges(t *testing.T) {
+	snapshots := []string{
+		`{"awareness":0.5,"coherence":0.5,"label":"baseline"}`,
+		`{"awareness":0.55,"coherence":0.6}`,
+		// awareness has drifted 0.15 from its last reported value
+		`{"awareness":0.65,"coherence":0.6}`,
+		`{"awareness":0.7,"coherence":0.85,"label":"focused"}`,
+		`{"awareness":0.7,"coherence":0.85}`,
+	}
+	g, _ := newTestGateway(t, Config{
+		MetricsPollInterval: 10 * time.Millisecond,
+		MetricsThresholds:   map[string]float64{"default": 0.1, "coherence": 0.3},
+	})
+	var polls atomic.Int64
+	stubService(t, g, serviceLLM, func(w http.ResponseWriter, r *http.Request) {
+		n := min(int(polls.Add(1))-1, len(snapshots)-1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"metrics":[%s]}`, snapshots[n])
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		g.pollMetrics(ctx)
+		close(done)
+	}()
+	deadline := time.After(2 * time.Second)
+	for polls.Load() < int64(len(snapshots)+2) {
+		select {
+		case <-deadline:
+			t.Fatalf("polled %d times, want at least %d", polls.Load(), len(snapshots)+2)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+
+	events := recordedEvents(t, g, "consciousness.delta")
+	if len(events) != 2 {
+		t.Fatalf("broadcast %d deltas, want 2: %v", len(events), events)
+	}
+	changed := func(ev map[string]any) []string {
+		var names []string
+		for name := range ev["changes"].(map[string]any) {
+			names = append(names, name)
+		}
+		return names
+	}
+	if got := changed(events[0]); !reflect.DeepEqual(got, []string{"awareness"}) {
+		t.Errorf("first delta changed %v, want [awareness]", got)
+	}
+	if got := events[0]["changes"].(map[string]any)["awareness"].(map[string]any)["from"]; got != 0.5 {
+		t.Errorf("awareness reported from %v, want the baseline 0.5", got)
+	}
+	if got := changed(events[1]); !reflect.DeepEqual(got, []string{"coherence"}) {
+		t.Errorf("second delta changed %v, want [coherence]", got)
+	}
+	if _, ok := events[1]["metrics"].(map[string]any)["label"]; ok {
+		t.Error("non-numeric metric included in the snapshot")
+	}
+}
+
+func TestMetricsThresholdsRejectNaN(t *testing.T) {
+	logs := captureLog(t)
+	t.Setenv("METRICS_DELTA_THRESHOLD", "NaN")
+	t.Setenv("METRICS_DELTA_THRESHOLDS", "coherence=NaN,awareness=0.2")
+
+	got := LoadConfig().MetricsThresholds
+	want := map[string]float64{"default": 0.05, "awareness": 0.2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MetricsThresholds %v, want %v", got, want)
+	}
+	for _, key := range []string{"METRICS_DELTA_THRESHOLD=", "METRICS_DELTA_THRESHOLDS entry coherence="} {
+		if !strings.Contains(logs.String(), "invalid "+key) {
+			t.Errorf("no fallback logged for %s in %q", key, logs.String())
+		}
+	}
+}
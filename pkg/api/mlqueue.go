@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errMLBusy is returned when an ML call cannot get a slot, because the
+// queue in front of the ML service is full or the wait timed out.
+var errMLBusy = errors.New("ml service is busy")
+
+// fairLimiter caps concurrent calls and queues the excess in arrival
+// order, so a burst of one kind of request cannot starve another. A nil
+// limiter lets every call through.
+type fairLimiter struct {
+	limit int
+	depth int
+
+	mu      sync.Mutex
+	active  int
+	waiters []*limiterWaiter
+}
+
+type limiterWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// newFairLimiter allows limit concurrent calls with up to depth waiting. It
+// returns nil when limit is not positive.
+func newFairLimiter(limit, depth int) *fairLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &fairLimiter{limit: limit, depth: depth}
+}
+
+// acquire takes a slot, waiting in line for at most wait. It fails at once
+// when the queue is full.
+func (l *fairLimiter) acquire(ctx context.Context, wait time.Duration) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	if l.active < l.limit && len(l.waiters) == 0 {
+		l.active++
+		l.mu.Unlock()
+		return nil
+	}
+	if len(l.waiters) >= l.depth {
+		l.mu.Unlock()
+		return fmt.Errorf("%w: queue full", errMLBusy)
+	}
+	waiter := &limiterWaiter{ready: make(chan struct{})}
+	l.waiters = append(l.waiters, waiter)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-timer.C:
+		err = fmt.Errorf("%w: timed out waiting in queue", errMLBusy)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if waiter.granted {
+		// The slot was handed over just as the wait timed out, so take it,
+		// unless the caller is gone and it has to be passed on
+		if ctx.Err() == nil {
+			return nil
+		}
+		l.releaseLocked()
+		return err
+	}
+	for i, w := range l.waiters {
+		if w == waiter {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			break
+		}
+	}
+	return err
+}
+
+// release frees a slot, handing it to the longest waiting call if any.
+func (l *fairLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.releaseLocked()
+	l.mu.Unlock()
+}
+
+func (l *fairLimiter) releaseLocked() {
+	if len(l.waiters) == 0 {
+		l.active--
+		return
+	}
+	next := l.waiters[0]
+	l.waiters = l.waiters[1:]
+	next.granted = true
+	close(next.ready)
+}
+
+// holdUntilClosed keeps a slot taken with acquire until resp's body is read
+// to the end or closed, whichever comes first, or releases it right away
+// when there is no response. Releasing at the end of the body keeps a
+// handler that defers Close from holding the slot through later stages.
+func (l *fairLimiter) holdUntilClosed(resp *http.Response) *http.Response {
+	if l == nil {
+		return resp
+	}
+	if resp == nil {
+		l.release()
+		return nil
+	}
+	resp.Body = &releasingBody{onClose: onClose{ReadCloser: resp.Body, fn: l.release}}
+	return resp
+}
+
+// releasingBody runs its onClose function at EOF as well as on Close.
+type releasingBody struct {
+	onClose
+}
+
+func (b *releasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.fn)
+	}
+	return n, err
+}
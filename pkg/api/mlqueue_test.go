@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// queued reports how many calls are waiting in l.
+func (l *fairLimiter) queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.waiters)
+}
+
+// waitQueued waits until n calls are waiting in l.
+func waitQueued(t *testing.T, l *fairLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for l.queued() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d calls queued, want %d", l.queued(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFairLimiterGrantsInArrivalOrder(t *testing.T) {
+	l := newFairLimiter(1, 3)
+	if err := l.acquire(context.Background(), time.Second); err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	granted := make(chan int, 3)
+	for i := range 3 {
+		go func() {
+			if err := l.acquire(context.Background(), 5*time.Second); err != nil {
+				granted <- -1
+				return
+			}
+			granted <- i
+		}()
+		// Queue each waiter before starting the next so arrival order is known
+		waitQueued(t, l, i+1)
+	}
+
+	if err := l.acquire(context.Background(), time.Second); !errors.Is(err, errMLBusy) {
+		t.Errorf("acquire with a full queue: %v, want %v", err, errMLBusy)
+	}
+
+	for want := range 3 {
+		l.release()
+		select {
+		case got := <-granted:
+			if got != want {
+				t.Fatalf("slot went to waiter %d, want %d", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("waiter %d never got the released slot", want)
+		}
+	}
+	l.release()
+	if l.active != 0 || l.queued() != 0 {
+		t.Errorf("%d active and %d queued after every release, want none", l.active, l.queued())
+	}
+}
+
+func TestFairLimiterWaitTimesOut(t *testing.T) {
+	l := newFairLimiter(1, 1)
+	if err := l.acquire(context.Background(), time.Second); err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	start := time.Now()
+	err := l.acquire(context.Background(), 50*time.Millisecond)
+	if !errors.Is(err, errMLBusy) {
+		t.Fatalf("acquire past its wait: %v, want %v", err, errMLBusy)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("wait gave up after %s, want about 50ms", elapsed)
+	}
+	if n := l.queued(); n != 0 {
+		t.Errorf("timed out call left %d waiters queued", n)
+	}
+
+	// The abandoned place in line does not swallow the next release
+	l.release()
+	if err := l.acquire(context.Background(), 50*time.Millisecond); err != nil {
+		t.Errorf("acquire after release: %v", err)
+	}
+}
+
+func TestNilFairLimiterAllowsEveryCall(t *testing.T) {
+	l := newFairLimiter(0, 10)
+	for range 100 {
+		if err := l.acquire(context.Background(), 0); err != nil {
+			t.Fatalf("unlimited acquire: %v", err)
+		}
+	}
+	l.release()
+}
+
+func TestSaturatedMLQueueAnswers503(t *testing.T) {
+	g, srv := newTestGateway(t, Config{MLConcurrency: 1, MLQueueDepth: 1, MLQueueTimeout: 100 * time.Millisecond})
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	stubService(t, g, serviceML, func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		entered <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		http.Error(w, "released", http.StatusInternalServerError)
+	})
+	t.Cleanup(func() { close(release) })
+
+	type result struct {
+		status int
+		body   string
+	}
+	frame := func(out chan<- result) {
+		resp, err := http.Post(srv.URL+"/api/vision/frame", "application/json", strings.NewReader(testFrame))
+		if err != nil {
+			out <- result{body: err.Error()}
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		out <- result{resp.StatusCode, string(b)}
+	}
+
+	holding, waiting := make(chan result, 1), make(chan result, 1)
+	go frame(holding)
+	<-entered
+	go frame(waiting)
+	waitQueued(t, g.mlSlots, 1)
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame)
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(body, "queue full") {
+		t.Errorf("request past the queue depth: status %d %s, want 503 queue full", resp.StatusCode, body)
+	}
+
+	got := <-waiting
+	if got.status != http.StatusServiceUnavailable || !strings.Contains(got.body, "timed out waiting in queue") {
+		t.Errorf("queued request: status %d %s, want 503 after its wait timed out", got.status, got.body)
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const msgpackContentType = "application/msgpack"
+
+// acceptsMsgpack reports whether the client listed msgpack in its Accept
+// header.
+func acceptsMsgpack(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && (mediaType == msgpackContentType || mediaType == "application/x-msgpack") {
+			return true
+		}
+	}
+	return false
+}
+
+// relayNegotiated relays a JSON response from a downstream service,
+// re-encoding a successful one as msgpack when the client accepts it.
+// Float-heavy payloads such as embeddings shrink considerably that way.
+// Successful responses carry an ETag and honor If-None-Match. A response
+// that cannot be read or re-encoded is reported as a failure of service.
+func relayNegotiated(w http.ResponseWriter, r *http.Request, service string, resp *http.Response) {
+	w.Header().Add("Vary", "Accept")
+	if !acceptsMsgpack(r) || resp.StatusCode != http.StatusOK {
+		relayWithETag(w, r, resp)
+		return
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeStageError(w, "", service, err, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if writeNotModified(w, r, bodyETag(b, "-msgpack")) {
+		return
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		writeStageError(w, "", service, nil, "invalid JSON from downstream service", http.StatusBadGateway)
+		return
+	}
+	packed, err := msgpack.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", msgpackContentType)
+	w.Write(packed)
+}
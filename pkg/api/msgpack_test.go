@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// testEmbeddings returns a JSON list of embeddings with full-precision
+// float components, like the embeddings service returns.
+func testEmbeddings(dim int) string {
+	vector := make([]float64, dim)
+	for i := range vector {
+		vector[i] = math.Sin(float64(i)) / 3
+	}
+	b, _ := json.Marshal([]map[string]any{
+		{"id": "a", "source": "vision", "embedding": vector},
+		{"id": "b", "source": "speech", "embedding": vector[:dim/2]},
+	})
+	return string(b)
+}
+
+func TestEmbeddingsNegotiateMsgpack(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	embeddingsList := testEmbeddings(512)
+	stubService(t, g, serviceEmbeddings, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(embeddingsList))
+	})
+	var want any
+	json.Unmarshal([]byte(embeddingsList), &want)
+
+	resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/embeddings", "", "Accept", "application/json;q=0.5, application/msgpack")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != msgpackContentType {
+		t.Fatalf("status %d, Content-Type %q, want 200 msgpack", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var got any
+	if err := msgpack.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("body is not msgpack: %v", err)
+	}
+	// msgpack keeps float64s as float64s, so the values compare exactly
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("msgpack decodes to %v, want %v", got, want)
+	}
+	if len(body) >= len(embeddingsList)*2/3 {
+		t.Errorf("msgpack body is %d bytes, not much smaller than the %d-byte JSON", len(body), len(embeddingsList))
+	}
+
+	resp, body = doRequest(t, http.MethodGet, srv.URL+"/api/embeddings", "")
+	if resp.Header.Get("Content-Type") != "application/json" || body != embeddingsList {
+		t.Errorf("default response %q %s, want the JSON as sent", resp.Header.Get("Content-Type"), body)
+	}
+	if vary := resp.Header.Values("Vary"); len(vary) == 0 {
+		t.Error("response does not vary on Accept")
+	}
+}
+
+func TestEmbeddingsErrorNotReencoded(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	stubService(t, g, serviceEmbeddings, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "index rebuilding", http.StatusServiceUnavailable)
+	})
+
+	resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/embeddings", "", "Accept", "application/msgpack")
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Content-Type") == msgpackContentType {
+		t.Errorf("status %d, Content-Type %q, want the 503 relayed as is: %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// NotFound responds with a JSON 404 for paths no route matches, so API
+// clients get a parseable error instead of a catch-all page.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]string{
+			"code":    "not_found",
+			"message": "no route for " + r.Method + " " + r.URL.Path,
+		},
+	})
+}
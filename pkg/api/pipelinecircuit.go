@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// pipelineCircuit tracks the outcomes of ingestion requests over a sliding
+// window, across every backend, and opens when too many of them fail. The
+// per-service offline checks only stop calls to a service known to be
+// down; this catches failures spread over several backends, or from ones
+// that pass their health checks, before they cascade. The window and
+// thresholds are passed on each call, so they can be reloaded.
+type pipelineCircuit struct {
+	mu       sync.Mutex
+	outcomes []pipelineOutcome
+	open     bool
+}
+
+type pipelineOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+// pipelineState is the circuit's view of the window when it opens or
+// closes.
+type pipelineState struct {
+	Requests  int
+	Failures  int
+	ErrorRate float64
+}
+
+// record adds the outcome of a request finished at now and reevaluates the
+// circuit.
+func (c *pipelineCircuit) record(now time.Time, failed bool, window time.Duration, threshold float64, minRequests int) (changed, open bool, state pipelineState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.outcomes = append(c.outcomes, pipelineOutcome{at: now, failed: failed})
+	return c.evaluate(now, window, threshold, minRequests)
+}
+
+// check reevaluates the circuit at now, which closes it once the failures
+// that opened it have left the window, and reports whether it is open.
+func (c *pipelineCircuit) check(now time.Time, window time.Duration, threshold float64, minRequests int) (changed, open bool, state pipelineState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.evaluate(now, window, threshold, minRequests)
+}
+
+// evaluate drops the outcomes older than window and opens the circuit when
+// at least minRequests remain and more than threshold of them failed,
+// closing it again when that no longer holds. A threshold that is not
+// positive keeps the circuit closed. c.mu must be held.
+func (c *pipelineCircuit) evaluate(now time.Time, window time.Duration, threshold float64, minRequests int) (changed, open bool, state pipelineState) {
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(c.outcomes) && !c.outcomes[i].at.After(cutoff) {
+		i++
+	}
+	c.outcomes = c.outcomes[i:]
+
+	state.Requests = len(c.outcomes)
+	for _, o := range c.outcomes {
+		if o.failed {
+			state.Failures++
+		}
+	}
+	if state.Requests > 0 {
+		state.ErrorRate = float64(state.Failures) / float64(state.Requests)
+	}
+
+	open = threshold > 0 && state.Requests >= max(minRequests, 1) && state.ErrorRate > threshold
+	changed = open != c.open
+	c.open = open
+	return changed, open, state
+}
+
+// reset forgets the recorded outcomes and closes the circuit, reporting
+// whether it was open.
+func (c *pipelineCircuit) reset() (wasOpen bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wasOpen = c.open
+	c.outcomes = nil
+	c.open = false
+	return wasOpen
+}
+
+// shedWhenDegraded guards an ingestion route with the pipeline circuit.
+// While the circuit is open new requests are refused with a 503 instead of
+// adding to the load on struggling backends; otherwise the request's
+// outcome is recorded, a 5xx counting as a failure. ?force and dry runs
+// skip the check, and dry runs are not recorded since they reach no
+// backend.
+func (g *Gateway) shedWhenDegraded(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := g.config()
+		if isDryRun(r) {
+			next(w, r)
+			return
+		}
+		if !isForced(r.Context()) {
+			changed, open, state := g.pipeline.check(g.now(), cfg.PipelineErrorWindow, cfg.PipelineErrorThreshold, cfg.PipelineMinRequests)
+			if changed {
+				g.broadcastPipelineState(open, state)
+			}
+			if open {
+				w.Header().Set("Retry-After", offlineRetryAfter)
+				http.Error(w, "pipeline is degraded, shedding ingestion", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		changed, open, state := g.pipeline.record(g.now(), rec.status >= http.StatusInternalServerError, cfg.PipelineErrorWindow, cfg.PipelineErrorThreshold, cfg.PipelineMinRequests)
+		if changed {
+			g.broadcastPipelineState(open, state)
+		}
+	}
+}
+
+// broadcastPipelineState announces the pipeline circuit opening, as a
+// "pipeline.degraded" event, or closing again, as "pipeline.recovered".
+func (g *Gateway) broadcastPipelineState(open bool, state pipelineState) {
+	eventType := "pipeline.recovered"
+	if open {
+		eventType = "pipeline.degraded"
+	}
+	log.Printf("%s: %d of %d ingestion requests failed in the last %s",
+		eventType, state.Failures, state.Requests, g.config().PipelineErrorWindow)
+	evBytes, _ := json.Marshal(map[string]any{
+		"type":       eventType,
+		"requests":   state.Requests,
+		"failures":   state.Failures,
+		"error_rate": state.ErrorRate,
+		"threshold":  g.config().PipelineErrorThreshold,
+		"timestamp":  g.timestamp(),
+	})
+	g.hub.Broadcast(string(evBytes))
+}
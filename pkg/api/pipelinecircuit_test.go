@@ -0,0 +1,124 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipelineCircuitShedsAndRecovers(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	g, srv := newTestGatewayWith(t, Config{
+		PipelineErrorThreshold: 0.5,
+		PipelineErrorWindow:    10 * time.Second,
+		PipelineMinRequests:    4,
+	}, func(g *Gateway) { g.SetClock(fixedClock(now)) })
+
+	var failing atomic.Bool
+	var clipCalls atomic.Int32
+	stubService(t, g, serviceML, func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		clipCalls.Add(1)
+		if failing.Load() {
+			http.Error(w, "model crashed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(clipResponse))
+	})
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(runResponse))
+	})
+
+	frame := func() (*http.Response, string) {
+		return doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame)
+	}
+
+	// One failure in four is below the threshold
+	for i := range 4 {
+		failing.Store(i == 0)
+		if resp, body := frame(); i > 0 && resp.StatusCode != http.StatusOK {
+			t.Fatalf("frame %d: status %d: %s", i, resp.StatusCode, body)
+		}
+	}
+	if events := recordedEvents(t, g, "pipeline.degraded"); len(events) != 0 {
+		t.Fatalf("degraded at a 25%% error rate: %v", events)
+	}
+
+	// Three more failures make four of seven, above the threshold
+	failing.Store(true)
+	for range 3 {
+		if resp, _ := frame(); resp.StatusCode < http.StatusInternalServerError {
+			t.Fatalf("failing frame: status %d, want a 5xx", resp.StatusCode)
+		}
+	}
+	degraded := recordedEvents(t, g, "pipeline.degraded")
+	if len(degraded) != 1 {
+		t.Fatalf("got %d pipeline.degraded events, want 1", len(degraded))
+	}
+	if ev := degraded[0]; ev["requests"] != 7.0 || ev["failures"] != 4.0 || ev["threshold"] != 0.5 {
+		t.Errorf("pipeline.degraded %v, want 4 of 7 requests failed against 0.5", ev)
+	}
+
+	// New ingestion is shed without reaching the backend
+	failing.Store(false)
+	before := clipCalls.Load()
+	resp, body := frame()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" || !strings.Contains(body, "pipeline is degraded") {
+		t.Errorf("shed frame: status %d, Retry-After %q, body %q, want a 503 with Retry-After", resp.StatusCode, resp.Header.Get("Retry-After"), body)
+	}
+	if resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/speech/transcript", speechRequest); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("shed speech: status %d, want 503", resp.StatusCode)
+	}
+	if got := clipCalls.Load(); got != before {
+		t.Errorf("shed requests made %d ML calls, want none", got-before)
+	}
+
+	// Once the failures leave the window the circuit closes
+	g.SetClock(fixedClock(now.Add(11 * time.Second)))
+	if resp, body := frame(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("frame after the window: status %d, want 200: %s", resp.StatusCode, body)
+	}
+	if got := len(recordedEvents(t, g, "pipeline.recovered")); got != 1 {
+		t.Errorf("got %d pipeline.recovered events, want 1", got)
+	}
+}
+
+func TestPipelineCircuitDisabledByDefault(t *testing.T) {
+	g, srv := newTestGateway(t, Config{PipelineMinRequests: 1})
+	stubPipeline(t, g, map[string]string{})
+
+	for range 5 {
+		if resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame); resp.StatusCode == http.StatusServiceUnavailable {
+			t.Fatalf("frame shed with no threshold configured")
+		}
+	}
+	if events := recordedEvents(t, g, "pipeline.degraded"); len(events) != 0 {
+		t.Errorf("got pipeline.degraded with no threshold configured: %v", events)
+	}
+}
+
+func TestPipelineErrorThresholdFromEnv(t *testing.T) {
+	tests := []struct {
+		env  string
+		want float64
+	}{
+		{"", 0},
+		{"0", 0},
+		{"0.25", 0.25},
+		{"-1", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("PIPELINE_ERROR_THRESHOLD", tt.env)
+			if got := LoadConfig().PipelineErrorThreshold; got != tt.want {
+				t.Errorf("PIPELINE_ERROR_THRESHOLD=%q gives %v, want %v", tt.env, got, tt.want)
+			}
+		})
+	}
+}
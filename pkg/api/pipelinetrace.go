@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// pipelineStage is one downstream step of an ingestion as reported in a
+// pipeline.trace event.
+type pipelineStage struct {
+	Name      string  `json:"name"`
+	Service   string  `json:"service,omitempty"`
+	OK        bool    `json:"ok"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// pipelineTrace collects how a single frame or transcript moved through the
+// pipeline, so it can be broadcast as one pipeline.trace event instead of
+// being pieced together from the separate events along the way.
+type pipelineTrace struct {
+	pipeline    string
+	embeddingID string
+	cameraID    string
+	synthetic   bool
+	start       time.Time
+	stages      []pipelineStage
+	token       map[string]any
+	correlation *correlation
+
+	// deadlineExceeded marks a run cut short by the pipeline's deadline
+	deadlineExceeded bool
+}
+
+func newPipelineTrace(pipeline, embeddingID string) *pipelineTrace {
+	return &pipelineTrace{pipeline: pipeline, embeddingID: embeddingID, start: time.Now()}
+}
+
+// record adds a stage that started at start and ended now, failed when err
+// is non-nil.
+func (t *pipelineTrace) record(name, service string, start time.Time, err error) {
+	stage := pipelineStage{
+		Name:      name,
+		Service:   service,
+		OK:        err == nil,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		stage.Error = err.Error()
+	}
+	t.stages = append(t.stages, stage)
+}
+
+// latency sums the time spent in stages handled by service.
+func (t *pipelineTrace) latency(service string) float64 {
+	var total float64
+	for _, stage := range t.stages {
+		if stage.Service == service {
+			total += stage.LatencyMs
+		}
+	}
+	return total
+}
+
+// broadcastTrace sends the pipeline.trace event for t. Handlers defer it
+// once the request has passed validation, so failed runs are traced too.
+func (g *Gateway) broadcastTrace(t *pipelineTrace) {
+	stages := t.stages
+	if stages == nil {
+		stages = []pipelineStage{}
+	}
+	ev := map[string]any{
+		"type":                 "pipeline.trace",
+		"pipeline":             t.pipeline,
+		"embedding_id":         t.embeddingID,
+		"ml_latency_ms":        t.latency(serviceML),
+		"sentience_latency_ms": t.latency(serviceSentience),
+		"total_ms":             float64(time.Since(t.start).Microseconds()) / 1000,
+		"stages":               stages,
+		"token":                t.token,
+		"timestamp":            g.timestamp(),
+	}
+	if t.cameraID != "" {
+		ev["camera_id"] = t.cameraID
+	}
+	if t.deadlineExceeded {
+		ev["deadline_exceeded"] = true
+	}
+	if t.synthetic {
+		ev["synthetic"] = true
+	}
+	evBytes, _ := json.Marshal(ev)
+	g.hub.Broadcast(t.correlation.tag(string(evBytes)))
+}
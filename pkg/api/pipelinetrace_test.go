@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+// traceStages returns whether each stage of a pipeline.trace event
+// succeeded, by stage name.
+func traceStages(t *testing.T, ev map[string]any) map[string]bool {
+	t.Helper()
+	stages, _ := ev["stages"].([]any)
+	got := make(map[string]bool, len(stages))
+	for _, s := range stages {
+		stage, _ := s.(map[string]any)
+		name, _ := stage["name"].(string)
+		ok, _ := stage["ok"].(bool)
+		got[name] = ok
+		if !ok && stage["error"] == nil {
+			t.Errorf("failed stage %s carries no error", name)
+		}
+	}
+	return got
+}
+
+func TestPipelineTraceReportsEveryStage(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	stubPipeline(t, g, defaultPipeline())
+
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/speech/transcript", speechRequest); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	traces := recordedEvents(t, g, "pipeline.trace")
+	if len(traces) != 1 {
+		t.Fatalf("recorded %d pipeline.trace events, want 1", len(traces))
+	}
+	ev := traces[0]
+	if ev["pipeline"] != "speech" || ev["embedding_id"] == "" || ev["embedding_id"] == nil {
+		t.Errorf("pipeline %v, embedding_id %v, want speech with an ID", ev["pipeline"], ev["embedding_id"])
+	}
+	stages := traceStages(t, ev)
+	for _, name := range []string{"ml.whisper", "ml.text", "sentience.run"} {
+		if ok, found := stages[name]; !found || !ok {
+			t.Errorf("stage %s: found %t ok %t, want a successful stage", name, found, ok)
+		}
+	}
+	for _, field := range []string{"ml_latency_ms", "sentience_latency_ms", "total_ms"} {
+		if v, ok := ev[field].(float64); !ok || v < 0 {
+			t.Errorf("%s is %v, want a latency", field, ev[field])
+		}
+	}
+	token, _ := ev["token"].(map[string]any)
+	if token["type"] != "sentience.token" || token["embedding_id"] != "e1" {
+		t.Errorf("token %v, want the broadcast sentience.token", ev["token"])
+	}
+}
+
+func TestPipelineTraceReportsFailedStage(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	responses := defaultPipeline()
+	delete(responses, "/run")
+	stubPipeline(t, g, responses)
+
+	doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame)
+	traces := recordedEvents(t, g, "pipeline.trace")
+	if len(traces) != 1 {
+		t.Fatalf("recorded %d pipeline.trace events, want 1", len(traces))
+	}
+	ev := traces[0]
+	if ev["pipeline"] != "vision" {
+		t.Errorf("pipeline %v, want vision", ev["pipeline"])
+	}
+	stages := traceStages(t, ev)
+	if ok, found := stages["ml.clip"]; !found || !ok {
+		t.Errorf("ml.clip: found %t ok %t, want a successful stage", found, ok)
+	}
+	if ok, found := stages["sentience.run"]; !found || ok {
+		t.Errorf("sentience.run: found %t ok %t, want a failed stage", found, ok)
+	}
+	if ev["token"] != nil {
+		t.Errorf("token %v after a failed run, want null", ev["token"])
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import "sync"
+
+// runLimited calls fn for each target concurrently, with at most limit calls
+// in flight, and returns once all of them have finished. A limit of zero, or
+// one at least as large as the target list, runs every call at once.
+func runLimited(targets []string, limit int, fn func(target string)) {
+	if limit <= 0 || limit > len(targets) {
+		limit = len(targets)
+	}
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range work {
+				fn(target)
+			}
+		}()
+	}
+	for _, target := range targets {
+		work <- target
+	}
+	close(work)
+	wg.Wait()
+}
+
+// serviceNames lists every service the gateway knows about, including
+// itself.
+func serviceNames() []string {
+	names := make([]string, 0, len(servicePorts))
+	for service := range servicePorts {
+		names = append(names, service)
+	}
+	return names
+}
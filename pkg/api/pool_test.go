@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunLimitedCapsCallsInFlight(t *testing.T) {
+	targets := make([]string, 100)
+	for i := range targets {
+		targets[i] = fmt.Sprintf("target-%d", i)
+	}
+	for _, tc := range []struct {
+		name       string
+		limit, max int
+	}{
+		{"limited", 4, 4},
+		{"limit of one", 1, 1},
+		{"unbounded", 0, len(targets)},
+		{"limit above targets", 500, len(targets)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var inFlight, peak atomic.Int32
+			var mu sync.Mutex
+			seen := make(map[string]int)
+			runLimited(targets, tc.limit, func(target string) {
+				n := inFlight.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				inFlight.Add(-1)
+				mu.Lock()
+				seen[target]++
+				mu.Unlock()
+			})
+
+			if got := int(peak.Load()); got > tc.max {
+				t.Errorf("%d calls in flight, want at most %d", got, tc.max)
+			}
+			if tc.limit == 0 && int(peak.Load()) <= 4 {
+				t.Errorf("unbounded run peaked at %d calls, want them all at once", peak.Load())
+			}
+			if len(seen) != len(targets) {
+				t.Errorf("called %d targets, want %d", len(seen), len(targets))
+			}
+			for target, n := range seen {
+				if n != 1 {
+					t.Errorf("%s called %d times, want once", target, n)
+				}
+			}
+		})
+	}
+}
+
+func TestRunLimitedWithNoTargets(t *testing.T) {
+	runLimited(nil, 4, func(string) { t.Error("called with no targets") })
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const maxProbeSamples = 10
+
+type latencyResult struct {
+	Success   bool    `json:"success"`
+	Samples   int     `json:"samples"`
+	Successes int     `json:"successes"`
+	LatencyMs float64 `json:"latency_ms"`
+	MinMs     float64 `json:"min_ms"`
+	AvgMs     float64 `json:"avg_ms"`
+	MaxMs     float64 `json:"max_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// getLatencyProbe pings every backend concurrently, up to
+// FanOutConcurrency at a time, and reports how long each
+// takes to answer its health endpoint. ?samples=N (1-10) repeats the ping
+// and reports min/avg/max over the successful samples.
+func (g *Gateway) getLatencyProbe(w http.ResponseWriter, r *http.Request) {
+	samples := 1
+	if v := r.URL.Query().Get("samples"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxProbeSamples {
+			http.Error(w, fmt.Sprintf("samples must be between 1 and %d", maxProbeSamples), http.StatusBadRequest)
+			return
+		}
+		samples = n
+	}
+
+	results := make(map[string]latencyResult)
+	var mu sync.Mutex
+	backends := slices.DeleteFunc(serviceNames(), func(service string) bool { return service == "gateway" })
+	runLimited(backends, g.config().FanOutConcurrency, func(service string) {
+		result := g.probeLatency(r.Context(), service, samples)
+
+		mu.Lock()
+		results[service] = result
+		mu.Unlock()
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"samples":   samples,
+		"services":  results,
+		"timestamp": g.timestamp(),
+	})
+}
+
+func (g *Gateway) probeLatency(ctx context.Context, service string, samples int) latencyResult {
+	result := latencyResult{Samples: samples, MinMs: math.Inf(1)}
+	url := g.serviceURL(service, healthEndpoint(service))
+
+	var total float64
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		resp, err := g.get(withForce(ctx), service, url, 2*time.Second)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				err = fmt.Errorf("status %d", resp.StatusCode)
+			}
+		}
+		elapsed := float64(time.Since(start).Microseconds()) / 1000
+
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		result.Successes++
+		total += elapsed
+		result.MinMs = math.Min(result.MinMs, elapsed)
+		result.MaxMs = math.Max(result.MaxMs, elapsed)
+	}
+
+	if result.Successes == 0 {
+		result.MinMs = 0
+		return result
+	}
+	result.Success = result.Successes == samples
+	result.AvgMs = total / float64(result.Successes)
+	result.LatencyMs = result.AvgMs
+	return result
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLatencyProbeReportsInjectedDelays(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	const slow = 150 * time.Millisecond
+	for _, service := range serviceNames() {
+		if service == "gateway" {
+			continue
+		}
+		stubService(t, g, service, func(w http.ResponseWriter, r *http.Request) {
+			switch service {
+			case serviceSentience:
+				time.Sleep(slow)
+			case serviceEgo:
+				http.Error(w, "down", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"status":"ok"}`))
+		})
+	}
+
+	resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/latency/probe?samples=3", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	var report struct {
+		Samples  int                      `json:"samples"`
+		Services map[string]latencyResult `json:"services"`
+	}
+	if err := json.Unmarshal([]byte(body), &report); err != nil {
+		t.Fatal(err)
+	}
+	backends := slices.DeleteFunc(serviceNames(), func(s string) bool { return s == "gateway" })
+	if report.Samples != 3 || len(report.Services) != len(backends) {
+		t.Fatalf("report %s, want 3 samples for each of %v", body, backends)
+	}
+
+	sentience := report.Services[serviceSentience]
+	slowMs := float64(slow.Milliseconds())
+	if !sentience.Success || sentience.MinMs < slowMs || sentience.MaxMs > 10*slowMs || sentience.AvgMs < sentience.MinMs || sentience.AvgMs > sentience.MaxMs {
+		t.Errorf("slow service %+v, want every sample near %vms", sentience, slowMs)
+	}
+	ml := report.Services[serviceML]
+	if !ml.Success || ml.Successes != 3 || ml.MaxMs >= slowMs {
+		t.Errorf("fast service %+v, want 3 successes under %vms", ml, slowMs)
+	}
+	if ego := report.Services[serviceEgo]; ego.Success || ego.Successes != 0 || ego.Error == "" {
+		t.Errorf("failing service %+v, want no successes and an error", ego)
+	}
+}
+
+func TestLatencyProbeRejectsBadSampleCount(t *testing.T) {
+	_, srv := newTestGateway(t, Config{})
+	for _, samples := range []string{"0", "11", "many"} {
+		if resp, _ := doRequest(t, http.MethodGet, srv.URL+"/api/latency/probe?samples="+samples, ""); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("samples=%s: status %d, want 400", samples, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// projection selects fields of an event by dotted path, such as
+// clip_topk.0.label, where numeric segments index into arrays.
+type projection [][]string
+
+// parseProjection parses a ?fields= spec: comma-separated dotted paths.
+// An empty spec selects nothing, meaning events are sent whole.
+func parseProjection(spec string) projection {
+	var p projection
+	for _, path := range strings.Split(spec, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			p = append(p, strings.Split(path, "."))
+		}
+	}
+	return p
+}
+
+// apply returns data reduced to the projected fields. Paths that do not
+// exist in the event are ignored, and data that is not a JSON object is
+// returned unchanged.
+func (p projection) apply(data string) string {
+	if len(p) == 0 {
+		return data
+	}
+	var ev map[string]any
+	if json.Unmarshal([]byte(data), &ev) != nil || ev == nil {
+		return data
+	}
+	out, ok := project(ev, p)
+	if !ok {
+		return "{}"
+	}
+	b, _ := json.Marshal(out)
+	return string(b)
+}
+
+// project keeps the parts of v selected by paths, which are relative to v.
+// It reports false when none of them exist.
+func project(v any, paths [][]string) (any, bool) {
+	children := make(map[string][][]string)
+	for _, path := range paths {
+		if len(path) == 0 {
+			return v, true
+		}
+		children[path[0]] = append(children[path[0]], path[1:])
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any)
+		for key, sub := range children {
+			if child, ok := v[key]; ok {
+				if projected, ok := project(child, sub); ok {
+					out[key] = projected
+				}
+			}
+		}
+		return out, len(out) > 0
+	case []any:
+		var indices []int
+		for key := range children {
+			if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(v) {
+				indices = append(indices, i)
+			}
+		}
+		sort.Ints(indices)
+		var out []any
+		for _, i := range indices {
+			if projected, ok := project(v[i], children[strconv.Itoa(i)]); ok {
+				out = append(out, projected)
+			}
+		}
+		return out, len(out) > 0
+	}
+	return nil, false
+}
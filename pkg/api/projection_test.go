@@ -0,0 +1,45 @@
+package api
+
+import "testing"
+
+const observation = `{"type":"vision.observation","ts":1700,"clip_topk":[{"label":"person","score":0.91},{"label":"dog","score":0.05}],"embedding":[0.1,0.2],"affect":{"valence":0.6,"arousal":0.4}}`
+
+func TestProjectionApply(t *testing.T) {
+	for _, tc := range []struct {
+		spec, data, want string
+	}{
+		{"", observation, observation},
+		{" , ", observation, observation},
+		{"type,clip_topk.0.label,ts", observation, `{"clip_topk":[{"label":"person"}],"ts":1700,"type":"vision.observation"}`},
+		{"clip_topk.1", observation, `{"clip_topk":[{"label":"dog","score":0.05}]}`},
+		{"clip_topk.1.score,clip_topk.0.label", observation, `{"clip_topk":[{"label":"person"},{"score":0.05}]}`},
+		{"affect.valence, type", observation, `{"affect":{"valence":0.6},"type":"vision.observation"}`},
+		// Unknown paths are ignored
+		{"type,missing,clip_topk.9.label,affect.valence.deeper", observation, `{"type":"vision.observation"}`},
+		{"missing", observation, `{}`},
+		{"type", `not json`, `not json`},
+		{"type", `[1,2]`, `[1,2]`},
+	} {
+		if got := parseProjection(tc.spec).apply(tc.data); got != tc.want {
+			t.Errorf("fields=%q: got %s, want %s", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestProjectedStreamDeliversOnlyRequestedFields(t *testing.T) {
+	hub := NewSSEHub()
+	srv := serve(t, hub)
+	lean := openSSE(t, srv.URL+"?fields=type,clip_topk.0.label,ts", nil)
+	full := openSSE(t, srv.URL, nil)
+	lean.nextMessage()
+	full.expect("connection")
+
+	hub.Broadcast(observation)
+	if got, want := lean.nextMessage().Data, `{"clip_topk":[{"label":"person"}],"ts":1700,"type":"vision.observation"}`; got != want {
+		t.Errorf("projected stream got %s, want %s", got, want)
+	}
+	ev := full.expect("vision.observation")
+	if ev["embedding"] == nil || ev["affect"] == nil {
+		t.Errorf("unprojected stream got %v, want the whole event", ev)
+	}
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Downstream service names, used to look up per-service settings.
+const (
+	serviceML         = "ml"
+	serviceSentience  = "sentience"
+	serviceLLM        = "llm"
+	serviceEgo        = "ego"
+	serviceEmbeddings = "embeddings"
+)
+
+// errServiceOffline is returned instead of calling a service the status
+// monitor last saw offline.
+var errServiceOffline = errors.New("downstream service is offline")
+
+// errResponseTooLarge is returned when reading a downstream body past the
+// service's configured maximum response size.
+var errResponseTooLarge = errors.New("downstream response too large")
+
+type forceKey struct{}
+
+// withForce marks ctx so downstream calls are attempted even when the target
+// service is cached as offline.
+func withForce(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceKey{}, true)
+}
+
+func isForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(forceKey{}).(bool)
+	return forced
+}
+
+// offlineRetryAfter is the Retry-After sent when a downstream service is
+// unavailable; it matches the status monitor's check interval.
+const offlineRetryAfter = "5"
+
+// maxClientDeadline caps the deadline a client can ask for with
+// X-Deadline-Ms. Clients can only shorten a request, never extend it past
+// the gateway's own per-call timeouts.
+const maxClientDeadline = 2 * time.Minute
+
+// withClientDeadline derives a context that expires after the number of
+// milliseconds in header, capped at maxClientDeadline.
+func withClientDeadline(ctx context.Context, header string) (context.Context, context.CancelFunc, error) {
+	ms, err := strconv.Atoi(header)
+	if err != nil || ms <= 0 {
+		return nil, nil, fmt.Errorf("invalid deadline %q", header)
+	}
+	timeout := min(time.Duration(ms)*time.Millisecond, maxClientDeadline)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+func (g *Gateway) setServiceStatus(service, status string) {
+	g.statusMu.Lock()
+	g.serviceStatus[service] = status
+	g.statusMu.Unlock()
+}
+
+// serviceOffline reports whether the status monitor last saw service
+// offline. Services that have not been checked yet are not considered
+// offline.
+func (g *Gateway) serviceOffline(service string) bool {
+	g.statusMu.RLock()
+	defer g.statusMu.RUnlock()
+	return g.serviceStatus[service] == "offline"
+}
+
+// serviceURL returns the URL for path on service: the base URL registered
+// with SetServiceURL if there is one, then the one in SERVICE_URLS, otherwise
+// the service's local port.
+func (g *Gateway) serviceURL(service, path string) string {
+	g.urlMu.RLock()
+	base, ok := g.serviceURLs[service]
+	g.urlMu.RUnlock()
+	if !ok {
+		base, ok = g.config().ServiceURLs[service]
+		base = strings.TrimSuffix(base, "/")
+	}
+	if !ok {
+		base = fmt.Sprintf("http://localhost:%d", servicePorts[service])
+	}
+	return base + path
+}
+
+// saturated reports whether service should not be sent new work right now.
+// The ML service never is while a fallback endpoint can take its work.
+func (g *Gateway) saturated(service string) bool {
+	if service == serviceML && g.config().MLFallbackURL != "" {
+		return false
+	}
+	return g.serviceOffline(service)
+}
+
+// resetServiceStatus forgets every status the monitor recorded, so no
+// service is fast-failed until it is checked again. It returns how many
+// entries were cleared.
+func (g *Gateway) resetServiceStatus() int {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+	n := len(g.serviceStatus)
+	clear(g.serviceStatus)
+	return n
+}
+
+// writeDownstreamError reports a failed downstream call in the error
+// envelope, naming the service the call went to. Calls skipped because the
+// service is known to be offline or could not get an ML slot get a 503,
+// and calls that ran out of time get a 504, instead of the handler's usual
+// message and status.
+func writeDownstreamError(w http.ResponseWriter, err error, message string, status int) {
+	writeStageError(w, "", failedService(err), err, message, status)
+}
+
+// writeStageError is writeDownstreamError for handlers that call several
+// services in turn: it also names the stage that failed, and takes the
+// service explicitly so a response that came back unusable is reported
+// like a failed call. err may be nil in that case.
+func writeStageError(w http.ResponseWriter, stage, service string, err error, message string, status int) {
+	body := errorBody{Code: "downstream_error", Message: message, Service: service, Stage: stage}
+	switch {
+	case errors.Is(err, errServiceOffline) || errors.Is(err, errMLBusy):
+		w.Header().Set("Retry-After", offlineRetryAfter)
+		body.Code, body.Message, status = "service_unavailable", err.Error(), http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		body.Code, body.Message, status = "deadline_exceeded", "downstream deadline exceeded", http.StatusGatewayTimeout
+	}
+	writeJSONError(w, status, body)
+}
+
+// limitBody caps resp.Body at the service's maximum response size. A body
+// whose Content-Length already exceeds the limit fails on the first read.
+// Reading the body fails with errors naming the service, so a relay that
+// cannot finish reports it like a failed call.
+func (g *Gateway) limitBody(service string, resp *http.Response) {
+	limit, ok := g.config().MaxResponseBytes[service]
+	if !ok {
+		limit = g.config().MaxResponseBytes["default"]
+	}
+
+	body := &limitedBody{ReadCloser: resp.Body, service: service, unlimited: limit <= 0, remaining: limit}
+	if !body.unlimited && resp.ContentLength > limit {
+		body.remaining = -1
+	}
+	resp.Body = body
+}
+
+// limitedBody is a downstream body of at most remaining more bytes, or of
+// any size when the service has no limit.
+type limitedBody struct {
+	io.ReadCloser
+	service   string
+	unlimited bool
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.read(p)
+	if err != nil && err != io.EOF {
+		err = &serviceError{service: b.service, err: err}
+	}
+	return n, err
+}
+
+func (b *limitedBody) read(p []byte) (int, error) {
+	if b.unlimited {
+		return b.ReadCloser.Read(p)
+	}
+	if b.remaining < 0 {
+		return 0, errResponseTooLarge
+	}
+	// Read one byte past the limit so an exactly-sized body is not rejected
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = -1
+		return n, errResponseTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// relay copies a downstream response's headers, status and body to w. A
+// body over the size limit becomes a 502 when detected before anything is
+// written, and aborts the response otherwise. For HEAD, a body whose length
+// the downstream service declared is not read at all.
+func relay(w http.ResponseWriter, resp *http.Response) {
+	if isHead(w) && resp.ContentLength >= 0 {
+		for key, values := range resp.Header {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+		w.WriteHeader(resp.StatusCode)
+		return
+	}
+
+	buf := make([]byte, 32<<10)
+	n, err := resp.Body.Read(buf)
+	if errors.Is(err, errResponseTooLarge) {
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(buf[:n])
+
+	if err == nil {
+		_, err = flushCopy(w, resp.Body)
+	}
+	if errors.Is(err, errResponseTooLarge) {
+		// The status is already sent, so abort rather than end the body
+		// cleanly and let the client mistake it for a complete response
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// flushCopy copies src to w, flushing after each chunk so large or slow
+// bodies reach the client as they arrive instead of sitting in buffers.
+func flushCopy(w http.ResponseWriter, src io.Reader) (int64, error) {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32<<10)
+
+	var written int64
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return written, werr
+			}
+			written += int64(n)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOfflineServiceFailsFastUnlessForced(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	var calls atomic.Int32
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	})
+	g.setServiceStatus(serviceSentience, "offline")
+
+	resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/memory", "")
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status %d for an offline service, want 503: %s", resp.StatusCode, body)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("called the offline service %d times", n)
+	}
+
+	resp, body = doRequest(t, http.MethodGet, srv.URL+"/api/memory?force", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d with ?force, want 200: %s", resp.StatusCode, body)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("called the service %d times with ?force, want 1", n)
+	}
+
+	g.setServiceStatus(serviceSentience, "online")
+	if resp, _ := doRequest(t, http.MethodGet, srv.URL+"/api/memory", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d once the service is back online, want 200", resp.StatusCode)
+	}
+}
+
+func TestServiceURLOverridesRouteVisionPipeline(t *testing.T) {
+	g, srv := newTestGateway(t, Config{ServiceURLs: map[string]string{serviceML: "http://ml.example:9000/"}})
+	var mlCalls, sentienceCalls atomic.Int32
+	ml := stubService(t, g, serviceML, func(w http.ResponseWriter, r *http.Request) {
+		mlCalls.Add(1)
+		switch r.URL.Path {
+		case "/infer/clip":
+			w.Write([]byte(clipResponse))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		sentienceCalls.Add(1)
+		w.Write([]byte(runResponse))
+	})
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", `{"image_base64":"aGVsbG8="}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	if mlCalls.Load() != 1 || sentienceCalls.Load() != 1 {
+		t.Errorf("ML got %d calls and sentience %d, want 1 each", mlCalls.Load(), sentienceCalls.Load())
+	}
+
+	// An override takes precedence over SERVICE_URLS, which applies again
+	// once the override is removed, and the local port after that
+	if got := g.serviceURL(serviceML, "/health"); got != ml.URL+"/health" {
+		t.Errorf("overridden ML URL %q, want the test server's", got)
+	}
+	g.SetServiceURL(serviceML, "")
+	if got := g.serviceURL(serviceML, "/health"); got != "http://ml.example:9000/health" {
+		t.Errorf("ML URL %q without the override, want the configured one", got)
+	}
+	g.SetServiceURL(serviceSentience, "")
+	if got := g.serviceURL(serviceSentience, "/run"); got != "http://localhost:8082/run" {
+		t.Errorf("sentience URL %q without the override, want its local port", got)
+	}
+}
+
+func TestDeadlineHeaderCutsSlowCallShort(t *testing.T) {
+	g, srv := newTestGateway(t, Config{MemoryTimeout: 5 * time.Second})
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+
+	start := time.Now()
+	resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/memory", "", "X-Deadline-Ms", "100")
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("status %d past the client's deadline, want 504: %s", resp.StatusCode, body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("answered after %s, want soon after the 100ms deadline", elapsed)
+	}
+}
+
+func TestDeadlineHeaderMustBePositive(t *testing.T) {
+	_, srv := newTestGateway(t, Config{})
+	for _, v := range []string{"0", "-5", "soon"} {
+		if resp, _ := doRequest(t, http.MethodGet, srv.URL+"/api/memory", "", "X-Deadline-Ms", v); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("X-Deadline-Ms %q: status %d, want 400", v, resp.StatusCode)
+		}
+	}
+}
+
+func TestClientDeadlineIsCapped(t *testing.T) {
+	ctx, cancel, err := withClientDeadline(context.Background(), "999999999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	if remaining := time.Until(deadline); remaining > maxClientDeadline {
+		t.Errorf("deadline %s away, want at most %s", remaining, maxClientDeadline)
+	}
+}
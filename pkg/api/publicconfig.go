@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// getPublicConfig reports the settings the frontend can adapt to: body size
+// limits, SSE behaviour and which optional features are enabled. Only
+// non-secret values belong here; API keys and downstream URLs are never
+// included.
+func (g *Gateway) getPublicConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"max_body_bytes": map[string]int64{
+			"/api/vision/frame":         maxFrameBytes,
+			"/api/speech/transcript":    maxSpeechBytes,
+			"/api/sentience/tokenize":   maxTokenizeBytes,
+			"/api/llm/generate-thought": maxThoughtBytes,
+			"/api/embeddings/batch":     maxBatchBytes,
+		},
+		"max_batch_items":      maxBatchItems,
+		"max_image_pixels":     g.config().VisionMaxPixels,
+		"max_event_hops":       g.config().MaxEventHops,
+		"event_schema_version": EventSchemaVersion,
+		"sse": map[string]any{
+			"heartbeat_interval_ms": sseHeartbeatInterval.Milliseconds(),
+			"client_buffer":         g.config().SSEClientBuffer,
+			"history_size":          g.config().SSEHistorySize,
+		},
+		"admin_enabled": g.config().AdminAddr == "" && g.config().APIKey != "",
+		"features": map[string]bool{
+			"websocket":         true,
+			"memory_streaming":  true,
+			"named_sse_events":  true,
+			"gzip_requests":     true,
+			"strict_json":       g.config().StrictJSON,
+			"degraded_thoughts": g.config().DegradedThoughts,
+			"vision_dedup":      g.config().VisionDedupWindow > 0,
+			"h2c":               g.config().H2C,
+			"ml_fallback":       g.config().MLFallbackURL != "",
+			"vision_embedding":  g.config().VisionEventEmbedding,
+		},
+	})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublicConfigReflectsSettingsWithoutSecrets(t *testing.T) {
+	cfg := Config{
+		APIKey:                 "api-key-secret",
+		AdminToken:             "admin-token-secret",
+		MLFallbackURL:          "http://ml-fallback.internal:9000",
+		SyntheticEmbeddingsURL: "http://synthetic.internal:9001",
+		ServiceURLs:            map[string]string{serviceLLM: "http://llm.internal:9002"},
+		SSEClientBuffer:        32,
+		StrictJSON:             true,
+		VisionDedupWindow:      time.Second,
+		VisionMaxPixels:        1 << 20,
+	}
+	_, srv := newTestGateway(t, cfg)
+
+	resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/config", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	for _, secret := range []string{"api-key-secret", "admin-token-secret", ".internal", "localhost"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("config exposes %q: %s", secret, body)
+		}
+	}
+
+	var out struct {
+		MaxBodyBytes   map[string]int64 `json:"max_body_bytes"`
+		MaxImagePixels int              `json:"max_image_pixels"`
+		AdminEnabled   bool             `json:"admin_enabled"`
+		SSE            struct {
+			HeartbeatMs  int64 `json:"heartbeat_interval_ms"`
+			ClientBuffer int   `json:"client_buffer"`
+		} `json:"sse"`
+		Features map[string]bool `json:"features"`
+	}
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.MaxBodyBytes["/api/vision/frame"] != maxFrameBytes || out.MaxImagePixels != 1<<20 {
+		t.Errorf("size limits %v and %d pixels, want the configured ones", out.MaxBodyBytes, out.MaxImagePixels)
+	}
+	if out.SSE.HeartbeatMs != sseHeartbeatInterval.Milliseconds() || out.SSE.ClientBuffer != 32 {
+		t.Errorf("sse settings %+v, want the configured ones", out.SSE)
+	}
+	if !out.AdminEnabled {
+		t.Error("admin_enabled false with an API key set")
+	}
+	for feature, want := range map[string]bool{"strict_json": true, "vision_dedup": true, "ml_fallback": true, "degraded_thoughts": false, "h2c": false, "websocket": true} {
+		if got, ok := out.Features[feature]; !ok || got != want {
+			t.Errorf("feature %s = %v, want %v", feature, got, want)
+		}
+	}
+}
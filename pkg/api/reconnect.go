@@ -0,0 +1,94 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// reconnectLimiter allows each IP at most a limited number of event stream
+// connections within a sliding window, so a client stuck in a reconnect
+// loop cannot keep the hub busy registering it and replaying history. The
+// limit and window are passed on each call, so they can be reloaded.
+type reconnectLimiter struct {
+	mu        sync.Mutex
+	hits      map[string][]time.Time
+	lastSweep time.Time
+}
+
+func newReconnectLimiter() *reconnectLimiter {
+	return &reconnectLimiter{hits: make(map[string][]time.Time)}
+}
+
+// allow records a connection from ip at now, or reports how long the
+// client has to wait when it already connected limit times within window.
+// Refused attempts do not count, so a client backing off as told gets in.
+// A limit that is not positive allows everything.
+func (l *reconnectLimiter) allow(ip string, now time.Time, limit int, window time.Duration) (bool, time.Duration) {
+	if limit <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-window)
+	if now.Sub(l.lastSweep) >= window {
+		l.sweepLocked(now, window)
+	}
+
+	hits := l.hits[ip]
+	for len(hits) > 0 && !hits[0].After(cutoff) {
+		hits = hits[1:]
+	}
+	if len(hits) >= limit {
+		l.hits[ip] = hits
+		return false, hits[0].Sub(cutoff)
+	}
+	l.hits[ip] = append(hits, now)
+	return true, 0
+}
+
+// sweep forgets the IPs that have not connected within window.
+func (l *reconnectLimiter) sweep(now time.Time, window time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweepLocked(now, window)
+}
+
+// sweepLocked is sweep with l.mu held.
+func (l *reconnectLimiter) sweepLocked(now time.Time, window time.Duration) {
+	cutoff := now.Add(-window)
+	for key, hits := range l.hits {
+		if !hits[len(hits)-1].After(cutoff) {
+			delete(l.hits, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// clientIP returns the host part of r's remote address. Forwarding headers
+// are ignored since any client can set them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limitReconnects refuses an event stream connection with a 429 when its
+// IP has connected SSEReconnectLimit times within SSEReconnectWindow.
+func (g *Gateway) limitReconnects(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := g.config()
+		if ok, wait := g.reconnects.allow(clientIP(r), g.now(), cfg.SSEReconnectLimit, cfg.SSEReconnectWindow); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many reconnects, retry later", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReconnectLimiterSlidingWindow(t *testing.T) {
+	l := newReconnectLimiter()
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	const limit, window = 3, 10 * time.Second
+
+	for i := range limit {
+		if ok, _ := l.allow("10.0.0.1", at(time.Duration(i)*time.Second), limit, window); !ok {
+			t.Fatalf("connection %d refused within the limit", i+1)
+		}
+	}
+	ok, wait := l.allow("10.0.0.1", at(3*time.Second), limit, window)
+	if ok || wait != 7*time.Second {
+		t.Errorf("connection past the limit: ok %t wait %s, want refused for 7s", ok, wait)
+	}
+	if ok, _ := l.allow("10.0.0.2", at(3*time.Second), limit, window); !ok {
+		t.Error("another IP throttled")
+	}
+	// The refused attempt does not count, so the first slot frees up when
+	// the first connection leaves the window
+	if ok, _ := l.allow("10.0.0.1", at(10*time.Second+time.Millisecond), limit, window); !ok {
+		t.Error("connection refused after the oldest one left the window")
+	}
+	if ok, _ := l.allow("10.0.0.1", at(10*time.Second+2*time.Millisecond), limit, window); ok {
+		t.Error("connection allowed with the window full again")
+	}
+
+	for range 100 {
+		if ok, _ := l.allow("10.0.0.1", at(11*time.Second), 0, window); !ok {
+			t.Fatal("limit 0 throttled a connection")
+		}
+	}
+
+	l.sweep(at(time.Minute), window)
+	if len(l.hits) != 0 {
+		t.Errorf("sweep kept %d idle IPs", len(l.hits))
+	}
+}
+
+func TestRapidReconnectsAreThrottled(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	g, srv := newTestGatewayWith(t, Config{SSEReconnectLimit: 3, SSEReconnectWindow: time.Minute}, func(g *Gateway) {
+		g.SetClock(fixedClock(now))
+	})
+
+	for range 3 {
+		openSSE(t, srv.URL+"/events", nil).expect("connection")
+	}
+	for _, path := range []string{"/events", "/ws"} {
+		resp, _ := doRequest(t, http.MethodGet, srv.URL+path, "")
+		if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "60" {
+			t.Errorf("%s after 3 connections: status %d, Retry-After %q, want 429 with Retry-After 60",
+				path, resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+	}
+
+	// Other endpoints are not limited
+	if resp, _ := doRequest(t, http.MethodGet, srv.URL+"/api/config", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("/api/config while throttled: status %d, want 200", resp.StatusCode)
+	}
+
+	g.SetClock(fixedClock(now.Add(time.Minute + time.Second)))
+	openSSE(t, srv.URL+"/events", nil).expect("connection")
+}
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	recorderMinBackoff   = 100 * time.Millisecond
+	recorderMaxBackoff   = 5 * time.Second
+	recorderWarnInterval = time.Minute
+)
+
+// eventRecorder writes broadcast events as JSON lines to a sink, such as
+// the event log file or a webhook. Events wait in a bounded queue; a write
+// that fails is retried with backoff, holding back the events behind it so
+// the log stays in order. Failures are logged at most once per
+// recorderWarnInterval.
+type eventRecorder struct {
+	// name identifies the recorder in warnings, such as "event log"
+	name  string
+	sink  io.Writer
+	queue chan []byte
+	done  chan struct{}
+	abort chan struct{}
+
+	// flushEvery is how often a sink that buffers, such as a compressed
+	// event log, is flushed; 0 leaves flushing to the sink
+	flushEvery time.Duration
+
+	// closed is set under mu once the queue is closed
+	mu     sync.RWMutex
+	closed bool
+
+	// unwritten counts the events abandoned by an aborted flush
+	unwritten int
+
+	warnMu     sync.Mutex
+	lastWarn   time.Time
+	suppressed int
+}
+
+func newEventRecorder(name string, sink io.Writer, queueSize int, flushEvery time.Duration) *eventRecorder {
+	rec := &eventRecorder{
+		name:       name,
+		sink:       sink,
+		queue:      make(chan []byte, queueSize),
+		done:       make(chan struct{}),
+		abort:      make(chan struct{}),
+		flushEvery: flushEvery,
+	}
+	go rec.run()
+	return rec
+}
+
+// record queues ev, stamped with the time it was broadcast at, for writing.
+// When the queue is full, or the recorder is closed, the event is dropped
+// rather than blocking the broadcast.
+func (rec *eventRecorder) record(ev sseEvent, at time.Time) {
+	var event any = ev.data
+	if json.Valid([]byte(ev.data)) {
+		event = json.RawMessage(ev.data)
+	}
+	line, _ := json.Marshal(map[string]any{
+		"id":    ev.id,
+		"time":  at.UTC().Format(time.RFC3339Nano),
+		"event": event,
+	})
+
+	rec.mu.RLock()
+	defer rec.mu.RUnlock()
+	if rec.closed {
+		return
+	}
+	select {
+	case rec.queue <- append(line, '\n'):
+	default:
+		rec.warn("%s queue full, dropping event %d", rec.name, ev.id)
+	}
+}
+
+// flusher is a sink that buffers writes until it is flushed.
+type flusher interface {
+	Flush() error
+}
+
+func (rec *eventRecorder) run() {
+	defer close(rec.done)
+	var tick <-chan time.Time
+	if _, ok := rec.sink.(flusher); ok && rec.flushEvery > 0 {
+		ticker := time.NewTicker(rec.flushEvery)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case line, ok := <-rec.queue:
+			if !ok {
+				return
+			}
+			if !rec.write(line) {
+				rec.unwritten = 1 + len(rec.queue)
+				return
+			}
+		case <-tick:
+			if err := rec.sink.(flusher).Flush(); err != nil {
+				rec.warn("%s flush failed: %v", rec.name, err)
+			}
+		}
+	}
+}
+
+// write retries line until it is written or the recorder is aborted. A
+// write that fails partway retries only the rest of the line, so the part
+// already written is not repeated.
+func (rec *eventRecorder) write(line []byte) bool {
+	backoff := recorderMinBackoff
+	for {
+		n, err := rec.sink.Write(line)
+		if err == nil {
+			return true
+		}
+		line = line[n:]
+		rec.warn("%s write failed, retrying: %v", rec.name, err)
+
+		select {
+		case <-time.After(backoff):
+			backoff = min(backoff*2, recorderMaxBackoff)
+		case <-rec.abort:
+			return false
+		}
+	}
+}
+
+// warn logs a failure unless one was logged recently, in which case it is
+// only counted and reported with the next warning.
+func (rec *eventRecorder) warn(format string, args ...any) {
+	rec.warnMu.Lock()
+	defer rec.warnMu.Unlock()
+	if time.Since(rec.lastWarn) < recorderWarnInterval {
+		rec.suppressed++
+		return
+	}
+	if rec.suppressed > 0 {
+		format += " (%d similar warnings suppressed)"
+		args = append(args, rec.suppressed)
+	}
+	log.Printf(format, args...)
+	rec.lastWarn = time.Now()
+	rec.suppressed = 0
+}
+
+// close stops accepting events and flushes the queue, giving up on whatever
+// is still unwritten when ctx is done.
+func (rec *eventRecorder) close(ctx context.Context) error {
+	rec.mu.Lock()
+	if rec.closed {
+		rec.mu.Unlock()
+		return nil
+	}
+	rec.closed = true
+	close(rec.queue)
+	rec.mu.Unlock()
+
+	var err error
+	select {
+	case <-rec.done:
+	case <-ctx.Done():
+		close(rec.abort)
+		<-rec.done
+		log.Printf("%s: %d events not written before shutdown", rec.name, rec.unwritten)
+		err = ctx.Err()
+	}
+	if c, ok := rec.sink.(io.Closer); ok {
+		c.Close()
+	}
+	return err
+}
+
+// fileSink appends to the file at path, reopening it after a failed write
+// so a transient error such as a full disk or a rotated file can recover.
+// With compress set each opening appends a new gzip member, which gzip
+// readers take as one stream; what was flushed before a crash stays
+// readable even though the member is never finished.
+type fileSink struct {
+	path     string
+	compress bool
+	f        *os.File
+	gz       *gzip.Writer
+}
+
+func (s *fileSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	var err error
+	if s.gz != nil {
+		err = s.gz.Close()
+	}
+	return errors.Join(err, s.f.Close())
+}
+
+// Flush writes out what the compressor holds, ending the file on a
+// boundary a reader can decode up to.
+func (s *fileSink) Flush() error {
+	if s.gz == nil {
+		return nil
+	}
+	if err := s.gz.Flush(); err != nil {
+		s.reset()
+		return err
+	}
+	return nil
+}
+
+func (s *fileSink) Write(p []byte) (int, error) {
+	if s.f == nil {
+		f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return 0, err
+		}
+		s.f = f
+		if s.compress {
+			s.gz = gzip.NewWriter(f)
+		}
+	}
+	var w io.Writer = s.f
+	if s.gz != nil {
+		w = s.gz
+	}
+	n, err := w.Write(p)
+	if err != nil {
+		// A compressed line cut short is lost with its unfinished member,
+		// which readers split from the next, so it is written again whole
+		if s.gz != nil {
+			n = 0
+		}
+		s.reset()
+	}
+	return n, err
+}
+
+// reset drops the open file after a failure, so the next write reopens it.
+func (s *fileSink) reset() {
+	s.f.Close()
+	s.f, s.gz = nil, nil
+}
@@ -0,0 +1,301 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakySink fails its first failures writes, each keeping the first
+// partial bytes of what it was sent, then keeps what it is sent.
+type flakySink struct {
+	mu       sync.Mutex
+	failures int
+	partial  int
+	attempts int
+	buf      bytes.Buffer
+}
+
+func (s *flakySink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.attempts <= s.failures {
+		n, _ := s.buf.Write(p[:min(s.partial, len(p))])
+		return n, errors.New("no space left on device")
+	}
+	return s.buf.Write(p)
+}
+
+func (s *flakySink) lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Split(strings.TrimSpace(s.buf.String()), "\n")
+}
+
+// captureLog sends the standard logger's output to a buffer until the test
+// ends.
+func captureLog(t *testing.T) *syncBuffer {
+	buf := &syncBuffer{}
+	log.SetOutput(buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return buf
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRecorderRetriesUntilWriteSucceeds(t *testing.T) {
+	logs := captureLog(t)
+	sink := &flakySink{failures: 3}
+	rec := newEventRecorder("event log", sink, 16, 0)
+	for id := uint64(1); id <= 3; id++ {
+		rec.record(sseEvent{id: id, data: `{"type":"x"}`}, time.Now())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rec.close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	lines := sink.lines()
+	if len(lines) != 3 {
+		t.Fatalf("persisted %d events, want 3: %q", len(lines), lines)
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, fmt.Sprintf(`"id":%d,`, i+1)) {
+			t.Errorf("line %d = %s, want event %d in order", i, line, i+1)
+		}
+	}
+	if n := strings.Count(logs.String(), "write failed"); n != 1 {
+		t.Errorf("logged %d write failures for 3 failed attempts, want 1:\n%s", n, logs)
+	}
+}
+
+func TestRecorderResumesPartialWrite(t *testing.T) {
+	captureLog(t)
+	sink := &flakySink{failures: 2, partial: 5}
+	rec := newEventRecorder("event log", sink, 16, 0)
+	rec.record(sseEvent{id: 1, data: `{"type":"cut"}`}, time.Now())
+	rec.record(sseEvent{id: 2, data: `{"type":"next"}`}, time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rec.close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	lines := sink.lines()
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), lines)
+	}
+	for i, line := range lines {
+		var entry struct {
+			ID uint64 `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.ID != uint64(i+1) {
+			t.Errorf("line %d %q (%v), want event %d intact", i, line, err, i+1)
+		}
+	}
+}
+
+func TestRecorderCloseGivesUpAtDeadline(t *testing.T) {
+	captureLog(t)
+	rec := newEventRecorder("event log", &flakySink{failures: 1 << 30}, 16, 0)
+	rec.record(sseEvent{id: 1, data: `{"type":"x"}`}, time.Now())
+	rec.record(sseEvent{id: 2, data: `{"type":"x"}`}, time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := rec.close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("close returned %v, want the deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("close took %s past a 50ms deadline", elapsed)
+	}
+	if rec.unwritten != 2 {
+		t.Errorf("counted %d unwritten events, want 2", rec.unwritten)
+	}
+}
+
+func TestFileSinkRecoversOnceFileCanBeOpened(t *testing.T) {
+	captureLog(t)
+	dir := filepath.Join(t.TempDir(), "logs")
+	path := filepath.Join(dir, "events.jsonl")
+	rec := newEventRecorder("event log", &fileSink{path: path}, 16, 0)
+	rec.record(sseEvent{id: 1, data: `{"type":"x"}`}, time.Now())
+
+	// The directory appears after the first attempts have failed
+	time.Sleep(150 * time.Millisecond)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rec.close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(b), `"id":1`) {
+		t.Errorf("event log %q (%v), want the event persisted", b, err)
+	}
+}
+
+// recordedIDs reads the event ids in the recording at path, skipping
+// lines that do not decode the way replay does.
+func recordedIDs(t *testing.T, path string) []uint64 {
+	t.Helper()
+	r, err := openRecording(path)
+	if err != nil {
+		t.Fatalf("opening %s: %v", path, err)
+	}
+	defer r.Close()
+	var ids []uint64
+	err = readRecording(r, func(line []byte) error {
+		var ev struct {
+			ID uint64 `json:"id"`
+		}
+		if json.Unmarshal(line, &ev) == nil {
+			ids = append(ids, ev.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	return ids
+}
+
+func TestCompressedEventLogReplays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl.gz")
+	g, srv := newTestGateway(t, Config{
+		APIKey:                testAPIKey,
+		EventLogPath:          path,
+		EventLogCompress:      true,
+		EventLogFlushInterval: 10 * time.Millisecond,
+	})
+	for _, typ := range []string{"first", "second", "third"} {
+		g.hub.Broadcast(fmt.Sprintf(`{"type":%q}`, typ))
+	}
+
+	// The events reach the file on the next flush, without the recorder closing
+	var lines []string
+	deadline := time.Now().Add(2 * time.Second)
+	for len(lines) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/admin/events/replay", "", "X-API-Key", testAPIKey); resp.StatusCode == http.StatusOK {
+			lines = strings.Fields(body)
+		}
+	}
+	var types []string
+	for _, line := range lines {
+		var entry struct {
+			Event struct {
+				Type string `json:"type"`
+			} `json:"event"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("replayed line %q: %v", line, err)
+		}
+		types = append(types, entry.Event.Type)
+	}
+	if want := []string{"first", "second", "third"}; !slices.Equal(types, want) {
+		t.Fatalf("replayed %v, want %v", types, want)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		t.Errorf("event log starts % x, want gzip", b[:min(len(b), 4)])
+	}
+
+	first := recordedIDs(t, path)[0]
+	resp, body := doRequest(t, http.MethodGet, fmt.Sprintf("%s/api/admin/events/replay?since=%d", srv.URL, first), "", "X-API-Key", testAPIKey)
+	if resp.StatusCode != http.StatusOK || len(strings.Fields(body)) != 2 {
+		t.Errorf("replay since %d: status %d, body %q, want the last two events", first, resp.StatusCode, body)
+	}
+}
+
+func TestCompressedEventLogSurvivesCrash(t *testing.T) {
+	tests := []struct {
+		name    string
+		restart bool
+		want    []uint64
+	}{
+		// What the compressor held at the crash is lost, what was flushed is not
+		{name: "crash", want: []uint64{1}},
+		// Events written after a restart follow the unfinished member
+		{name: "crash and restart", restart: true, want: []uint64{1, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "events.jsonl.gz")
+			s := &fileSink{path: path, compress: true}
+			s.Write([]byte(`{"id":1,"event":{"type":"flushed"}}` + "\n"))
+			if err := s.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			s.Write([]byte(`{"id":2,"event":{"type":"buffered"}}` + "\n"))
+			// Crash: the file is closed without finishing the gzip member
+			s.f.Close()
+
+			if tt.restart {
+				s := &fileSink{path: path, compress: true}
+				s.Write([]byte(`{"id":3,"event":{"type":"restarted"}}` + "\n"))
+				s.Write([]byte(`{"id":4,"event":{"type":"closed"}}` + "\n"))
+				if err := s.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := recordedIDs(t, path); !slices.Equal(got, tt.want) {
+				t.Errorf("recovered ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRecordingSkipsTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := os.WriteFile(path, []byte(`{"id":1}`+"\n"+`{"id":2}`+"\n"+`{"id":3,"ev`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := recordedIDs(t, path); !slices.Equal(got, []uint64{1, 2}) {
+		t.Errorf("read ids %v, want 1 and 2", got)
+	}
+}
+
+func TestEventLogCompressFromEnv(t *testing.T) {
+	t.Setenv("EVENT_LOG_COMPRESS", "true")
+	t.Setenv("EVENT_LOG_FLUSH_INTERVAL", "250ms")
+	cfg := LoadConfig()
+	if !cfg.EventLogCompress || cfg.EventLogFlushInterval != 250*time.Millisecond {
+		t.Errorf("EventLogCompress %v, EventLogFlushInterval %v, want true and 250ms", cfg.EventLogCompress, cfg.EventLogFlushInterval)
+	}
+}
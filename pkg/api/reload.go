@@ -0,0 +1,75 @@
+package api
+
+import (
+	"log"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// reloadable are the settings Reload applies to a running gateway, by the
+// environment variable they are read from. They are all read afresh for
+// each request, so changing them leaves open connections alone.
+var reloadable = []struct {
+	key   string
+	apply func(dst, src *Config)
+}{
+	{"MEMORY_TIMEOUT", func(dst, src *Config) { dst.MemoryTimeout = src.MemoryTimeout }},
+	{"SPEECH_TIMEOUT", func(dst, src *Config) { dst.SpeechTimeout = src.SpeechTimeout }},
+	{"TIMEOUT_MULTIPLIER", func(dst, src *Config) { dst.TimeoutMultiplier = src.TimeoutMultiplier }},
+	{"ML_QUEUE_TIMEOUT", func(dst, src *Config) { dst.MLQueueTimeout = src.MLQueueTimeout }},
+	{"CORS_ALLOWED_METHODS", func(dst, src *Config) { dst.CORSAllowedMethods = src.CORSAllowedMethods }},
+	{"CORS_ALLOWED_HEADERS", func(dst, src *Config) { dst.CORSAllowedHeaders = src.CORSAllowedHeaders }},
+	{"CORS_ALLOWED_ORIGINS", func(dst, src *Config) { dst.CORSAllowedOrigins = src.CORSAllowedOrigins }},
+	{"ALLOW_CREDENTIALS", func(dst, src *Config) { dst.AllowCredentials = src.AllowCredentials }},
+	{"SSE_RECONNECT_LIMIT", func(dst, src *Config) { dst.SSEReconnectLimit = src.SSEReconnectLimit }},
+	{"SSE_RECONNECT_WINDOW", func(dst, src *Config) { dst.SSEReconnectWindow = src.SSEReconnectWindow }},
+	{"SSE_SESSION_TTL", func(dst, src *Config) { dst.SSESessionTTL = src.SSESessionTTL }},
+	{"MAX_IN_FLIGHT", func(dst, src *Config) { dst.MaxInFlight = src.MaxInFlight }},
+	{"PIPELINE_ERROR_THRESHOLD", func(dst, src *Config) { dst.PipelineErrorThreshold = src.PipelineErrorThreshold }},
+	{"PIPELINE_ERROR_WINDOW", func(dst, src *Config) { dst.PipelineErrorWindow = src.PipelineErrorWindow }},
+	{"PIPELINE_MIN_REQUESTS", func(dst, src *Config) { dst.PipelineMinRequests = src.PipelineMinRequests }},
+	{"VISION_LABEL_ALLOWLIST", func(dst, src *Config) { dst.VisionLabelAllowList = src.VisionLabelAllowList }},
+	{"VISION_EVENT_EMBEDDING", func(dst, src *Config) { dst.VisionEventEmbedding = src.VisionEventEmbedding }},
+	{"REDUCTION_METHODS", func(dst, src *Config) { dst.ReductionMethods = src.ReductionMethods }},
+	{"REDUCTION_DEFAULT_METHOD", func(dst, src *Config) { dst.ReductionDefaultMethod = src.ReductionDefaultMethod }},
+	{"SERVICE_URLS", func(dst, src *Config) { dst.ServiceURLs = src.ServiceURLs }},
+	{"ML_FALLBACK_URL", func(dst, src *Config) { dst.MLFallbackURL = src.MLFallbackURL }},
+	{"SYNTHETIC_EMBEDDINGS_URL", func(dst, src *Config) { dst.SyntheticEmbeddingsURL = src.SyntheticEmbeddingsURL }},
+}
+
+// Reload applies the reloadable settings of cfg, typically just read with
+// LoadConfig, to the running gateway. Any other setting that differs keeps
+// its current value and is logged as needing a restart; those names are
+// returned.
+func (g *Gateway) Reload(cfg Config) (restart []string) {
+	old := g.config()
+	next := *old
+	next.sources = maps.Clone(old.sources)
+	if next.sources == nil {
+		// A gateway built from a Config literal has no sources yet
+		next.sources = make(map[string]settingSource)
+	}
+	for _, setting := range reloadable {
+		setting.apply(&next, &cfg)
+		if src, ok := cfg.sources[setting.key]; ok {
+			next.sources[setting.key] = src
+		}
+	}
+	g.cfg.Store(&next)
+
+	// Whatever still differs could not be applied
+	nextValue, cfgValue := reflect.ValueOf(next), reflect.ValueOf(cfg)
+	for i := range nextValue.NumField() {
+		field := nextValue.Type().Field(i)
+		if field.IsExported() && !reflect.DeepEqual(nextValue.Field(i).Interface(), cfgValue.Field(i).Interface()) {
+			restart = append(restart, field.Name)
+		}
+	}
+	slices.Sort(restart)
+	for _, name := range restart {
+		log.Printf("config reload: %s changed but needs a restart to take effect", name)
+	}
+	log.Printf("config reloaded")
+	return restart
+}
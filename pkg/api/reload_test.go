@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloadAppliesReloadableSettings(t *testing.T) {
+	logs := captureLog(t)
+	memory := func(id string) string {
+		srv := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[{"id":"` + id + `"}]`))
+		}))
+		return srv.URL
+	}
+	g, srv := newTestGateway(t, Config{
+		MemoryTimeout:      5 * time.Second,
+		CORSAllowedOrigins: []string{"http://localhost:3000"},
+		SSEClientBuffer:    16,
+		ServiceURLs:        map[string]string{serviceSentience: memory("before")},
+	})
+	stream := openSSE(t, srv.URL+"/events", nil)
+	stream.expect("connection")
+	if _, body := doRequest(t, http.MethodGet, srv.URL+"/api/memory", ""); !strings.Contains(body, "before") {
+		t.Fatalf("memory before reload: %s", body)
+	}
+
+	next := *g.config()
+	next.MemoryTimeout = 2 * time.Second
+	next.CORSAllowedOrigins = []string{"https://app.example.com"}
+	next.ServiceURLs = map[string]string{serviceSentience: memory("after")}
+	next.SSEClientBuffer = 4
+	restart := g.Reload(next)
+
+	if !reflect.DeepEqual(restart, []string{"SSEClientBuffer"}) {
+		t.Errorf("Reload reported %v needing a restart, want [SSEClientBuffer]", restart)
+	}
+	if !strings.Contains(logs.String(), "SSEClientBuffer changed but needs a restart") {
+		t.Errorf("log %q does not report the restart", logs.String())
+	}
+	cfg := g.Config()
+	if cfg.MemoryTimeout != 2*time.Second || !reflect.DeepEqual(cfg.CORSAllowedOrigins, next.CORSAllowedOrigins) {
+		t.Errorf("after reload: MemoryTimeout %s, origins %v", cfg.MemoryTimeout, cfg.CORSAllowedOrigins)
+	}
+	if cfg.SSEClientBuffer != 16 {
+		t.Errorf("SSEClientBuffer %d after reload, want it kept at 16 until a restart", cfg.SSEClientBuffer)
+	}
+	if _, body := doRequest(t, http.MethodGet, srv.URL+"/api/memory", ""); !strings.Contains(body, "after") {
+		t.Errorf("memory after reload: %s, want it from the reloaded service URL", body)
+	}
+
+	// The stream opened before the reload is left alone
+	g.hub.Broadcast(`{"type":"marker"}`)
+	stream.expect("marker")
+}
+
+func TestReloadReadsEnvironment(t *testing.T) {
+	g, _ := newTestGateway(t, Config{})
+	t.Setenv("MEMORY_TIMEOUT", "7s")
+	t.Setenv("SSE_RECONNECT_LIMIT", "3")
+	g.Reload(LoadConfig())
+
+	cfg := g.config()
+	if cfg.MemoryTimeout != 7*time.Second || cfg.SSEReconnectLimit != 3 {
+		t.Errorf("after reload: MemoryTimeout %s, SSEReconnectLimit %d, want 7s and 3", cfg.MemoryTimeout, cfg.SSEReconnectLimit)
+	}
+	if src := cfg.sources["MEMORY_TIMEOUT"]; src.Source != sourceEnv || src.Value != "7s" {
+		t.Errorf("MEMORY_TIMEOUT source %+v, want 7s from env", src)
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// openRecording opens an event log for reading, decompressing it when it
+// starts with the gzip magic number, whatever its name, so plain and
+// compressed recordings read the same.
+func openRecording(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	if magic, _ := br.Peek(2); !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, f}, nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{&gzipMembers{f: f, size: info.Size()}, f}, nil
+}
+
+// gzipMembers decompresses a recording one gzip member at a time. The
+// recorder starts a new member each time it opens the file, so after a
+// crash an unfinished member is followed by the one written on restart;
+// rather than stopping at the break, reading resumes at the next member
+// header, with a newline so the cut-off line is not joined to the next.
+type gzipMembers struct {
+	f    io.ReaderAt
+	size int64
+	src  *offsetReader
+	zr   *gzip.Reader
+	// last is the last byte returned, and newline is set when a line
+	// cut off by a break is still to be ended
+	last    byte
+	newline bool
+}
+
+func (m *gzipMembers) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if m.newline {
+		m.newline = false
+		m.last = '\n'
+		p[0] = '\n'
+		return 1, nil
+	}
+	for {
+		if m.zr == nil {
+			if m.src == nil {
+				m.src = m.seek(0)
+			}
+			m.src.start = m.src.off
+			zr, err := gzip.NewReader(m.src)
+			if errors.Is(err, io.EOF) {
+				return 0, io.EOF
+			}
+			if err != nil {
+				m.resync()
+				continue
+			}
+			zr.Multistream(false)
+			m.zr = zr
+		}
+		n, err := m.zr.Read(p)
+		if n > 0 {
+			m.last = p[n-1]
+		}
+		switch {
+		case err == nil:
+			return n, nil
+		case errors.Is(err, io.EOF):
+			// The member is complete and the next one starts right after it
+			m.zr = nil
+		default:
+			m.resync()
+			m.newline = m.last != '\n' && m.src.off < m.size
+		}
+		if n > 0 {
+			return n, nil
+		}
+		if m.newline {
+			return m.Read(p)
+		}
+	}
+}
+
+// resync moves to the next gzip header after the current position,
+// dropping the member being read.
+func (m *gzipMembers) resync() {
+	m.zr = nil
+	buf := make([]byte, 32*1024)
+	for off := m.src.start + 1; off < m.size; {
+		n, err := m.f.ReadAt(buf, off)
+		if i := bytes.Index(buf[:n], []byte{0x1f, 0x8b}); i >= 0 {
+			m.src = m.seek(off + int64(i))
+			return
+		}
+		if err != nil || n < 2 {
+			break
+		}
+		// Step back a byte in case the magic number straddles reads
+		off += int64(n) - 1
+	}
+	m.src = m.seek(m.size)
+}
+
+func (m *gzipMembers) seek(off int64) *offsetReader {
+	sr := io.NewSectionReader(m.f, off, m.size-off)
+	return &offsetReader{br: bufio.NewReader(sr), start: off, off: off}
+}
+
+// offsetReader tracks how far into the file a member has been read. It
+// is a byte reader, so the decompressor reads from it directly and
+// reading stops exactly at the end of each member. start is where the
+// member being read begins.
+type offsetReader struct {
+	br         *bufio.Reader
+	start, off int64
+}
+
+func (r *offsetReader) Read(p []byte) (int, error) {
+	n, err := r.br.Read(p)
+	r.off += int64(n)
+	return n, err
+}
+
+func (r *offsetReader) ReadByte() (byte, error) {
+	b, err := r.br.ReadByte()
+	if err == nil {
+		r.off++
+	}
+	return b, err
+}
+
+// readRecording calls fn with each complete line of a recording. A
+// recording cut short by a crash ends in a truncated line or gzip member;
+// that tail is skipped, so everything written before the last flush is
+// still read.
+func readRecording(r io.Reader, fn func(line []byte) error) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == nil {
+			if err := fn(line); err != nil {
+				return err
+			}
+			continue
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		return err
+	}
+}
+
+// getAdminEventReplay streams the event log back as JSON lines, from after
+// the ?since= seq when given, reading compressed logs transparently.
+func (g *Gateway) getAdminEventReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := g.config().EventLogPath
+	if path == "" {
+		http.Error(w, "event log disabled: EVENT_LOG_PATH is not set", http.StatusNotFound)
+		return
+	}
+	var since uint64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "since must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		since = n
+	}
+
+	rec, err := openRecording(path)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "no events recorded yet", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to open event log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rec.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	err = readRecording(rec, func(line []byte) error {
+		var ev struct {
+			ID uint64 `json:"id"`
+		}
+		if json.Unmarshal(line, &ev) != nil || ev.ID <= since {
+			return nil
+		}
+		_, err := w.Write(line)
+		return err
+	})
+	if err != nil {
+		log.Printf("event log replay stopped: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// retryBackoff is the pause before each retry of a downstream call,
+// multiplied by the retry's number, long enough for a restarting backend to
+// start listening again.
+const retryBackoff = 100 * time.Millisecond
+
+type retryKey struct{}
+
+// withRetries marks ctx so downstream calls made with it are retried on
+// connection errors.
+func withRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, true)
+}
+
+func retriesAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(retryKey{}).(bool)
+	return allowed
+}
+
+// idempotent marks a route whose downstream calls are safe to repeat, such
+// as an upsert by ID, so a call that failed to connect or lost its
+// connection before a response is retried up to ProxyRetries times.
+func (g *Gateway) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(withRetries(r.Context())))
+	}
+}
+
+// retryAttempts is how many times send tries a call with body: once, plus
+// ProxyRetries for idempotent routes when the body is small enough to be
+// kept for replaying.
+func (g *Gateway) retryAttempts(ctx context.Context, body []byte) int {
+	if !retriesAllowed(ctx) || len(body) > g.config().RetryBodyLimit {
+		return 1
+	}
+	return 1 + max(g.config().ProxyRetries, 0)
+}
+
+// connectionError reports whether err means the request never got a
+// response because the connection could not be made or was dropped, the
+// way a restarting backend fails, rather than a timeout or a refusal by the
+// gateway itself.
+func connectionError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
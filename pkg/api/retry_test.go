@@ -0,0 +1,90 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// flakyBackend returns a handler that drops the connection of its first
+// drops requests without answering, as a restarting backend would, and
+// answers the rest; bodies returns every request body it received.
+func flakyBackend(t *testing.T, drops int) (h http.HandlerFunc, bodies func() []string) {
+	var mu sync.Mutex
+	var received []string
+	h = func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, string(b))
+		n := len(received)
+		mu.Unlock()
+		if n <= drops {
+			conn, _, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				t.Errorf("hijacking: %v", err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}
+	return h, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), received...)
+	}
+}
+
+func TestIdempotentPostRetriedWithSameBody(t *testing.T) {
+	g, srv := newTestGateway(t, Config{ProxyRetries: 2})
+	h, bodies := flakyBackend(t, 1)
+	stubService(t, g, serviceEmbeddings, h)
+
+	const add = `{"id":"e1","source":"vision","embedding":[0.1,0.2,0.3]}`
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/embeddings/add", add)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200 after a retry: %s", resp.StatusCode, body)
+	}
+	got := bodies()
+	if len(got) != 2 {
+		t.Fatalf("backend got %d attempts, want 2", len(got))
+	}
+	if got[0] != add || got[1] != add {
+		t.Errorf("attempt bodies %q, want both %q", got, add)
+	}
+}
+
+func TestRetriesLimited(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		service string
+		path    string
+		body    string
+		want    int
+	}{
+		{"not idempotent", Config{ProxyRetries: 2}, serviceEgo, "/api/ego/reflect", `{"prompt":"hi"}`, 1},
+		{"retries off", Config{}, serviceEmbeddings, "/api/embeddings/add", `{"id":"e1","embedding":[1]}`, 1},
+		{"body over the limit", Config{ProxyRetries: 2, RetryBodyLimit: 16}, serviceEmbeddings, "/api/embeddings/add", `{"id":"e1","embedding":[1,2,3,4]}`, 1},
+		{"every attempt dropped", Config{ProxyRetries: 2}, serviceEmbeddings, "/api/embeddings/add", `{"id":"e1","embedding":[1]}`, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, tt.cfg)
+			h, bodies := flakyBackend(t, 10)
+			stubService(t, g, tt.service, h)
+
+			resp, body := doRequest(t, http.MethodPost, srv.URL+tt.path, tt.body)
+			if resp.StatusCode < 500 {
+				t.Errorf("status %d %s, want a 5xx for a dropped connection", resp.StatusCode, body)
+			}
+			if got := bodies(); len(got) != tt.want || strings.Join(got, "") != strings.Repeat(tt.body, tt.want) {
+				t.Errorf("backend got %q, want %d attempts with the request body", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,67 +1,128 @@
 package api
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
-var hub = NewSSEHub()
-
-// Global flag to pause status monitoring during AI generation
-var isAIGenerating = false
-
-// Store last known LLM status to preserve during generation
-var lastKnownLLMStatus = "unknown"
-
+// RegisterRoutes registers the API routes on mux using a Gateway configured
+// from the environment.
 func RegisterRoutes(mux *http.ServeMux) {
-	mux.Handle("/events", hub)
-	mux.HandleFunc("/api/vision/frame", postVisionFrame)
-	mux.HandleFunc("/api/speech/transcript", postSpeechTranscript)
-	mux.HandleFunc("/api/sentience/tokenize", postSentienceTokenize)
-	mux.HandleFunc("/api/llm/generate-thought", postGenerateThought)
-	mux.HandleFunc("/api/llm/consciousness-metrics", getConsciousnessMetrics)
-	mux.HandleFunc("/api/llm/thought-history", getThoughtHistory)
-	mux.HandleFunc("/api/memory", getMemory)
-	mux.HandleFunc("/sentience/memory", getMemory)
+	NewGateway(LoadConfig()).RegisterRoutes(mux)
+}
+
+// RegisterRoutes registers the gateway's routes on mux and starts its
+// service status monitor, which runs until Close is called.
+func (g *Gateway) RegisterRoutes(mux *http.ServeMux) {
+	handle(mux, "/events", g.rejectWhenDraining(g.limitReconnects(g.hub.ServeHTTP)), http.MethodGet)
+	handle(mux, "/ws", g.rejectWhenDraining(g.limitReconnects(g.hub.ServeWS)), http.MethodGet)
+	handle(mux, "/readyz", g.getReady, http.MethodGet)
+	handle(mux, "/api/vision/frame", g.rejectWhenDraining(g.rejectWhenSaturated(g.shedWhenDegraded(g.postVisionFrame), serviceML)), http.MethodPost)
+	handle(mux, "/api/speech/transcript", g.rejectWhenDraining(g.rejectWhenSaturated(g.shedWhenDegraded(g.postSpeechTranscript), serviceML)), http.MethodPost)
+	handle(mux, "/api/sentience/tokenize", g.rejectWhenDraining(g.rejectWhenSaturated(g.shedWhenDegraded(g.postSentienceTokenize), serviceSentience)), http.MethodPost)
+	handle(mux, "/api/llm/generate-thought", g.postGenerateThought, http.MethodPost)
+	handle(mux, "/api/llm/generate-thought/cancel", g.postCancelThought, http.MethodPost)
+	handle(mux, "/api/llm/consciousness-metrics", g.getConsciousnessMetrics, http.MethodGet)
+	handle(mux, "/api/llm/thought-history", g.getThoughtHistory, http.MethodGet)
+	handle(mux, "/api/memory", g.getMemory, http.MethodGet)
+	handle(mux, "/api/events/emit", g.requireAPIKey(g.postEmitEvent), http.MethodPost)
+	handle(mux, "/sentience/memory", g.getMemory, http.MethodGet)
 
 	// Ego service routes
-	mux.HandleFunc("/api/ego/reflect", postEgoReflect)
-	mux.HandleFunc("/api/ego/consolidate", postEgoConsolidate)
-	mux.HandleFunc("/api/ego/memories", getEgoMemories)
-	mux.HandleFunc("/api/ego/status", getEgoStatus)
-	mux.HandleFunc("/api/ego/experiences", getEgoExperiences)
-	mux.HandleFunc("/api/ego/clear-ltm", postEgoClearLTM)
+	handle(mux, "/api/ego/reflect", g.postEgoReflect, http.MethodPost)
+	handle(mux, "/api/ego/consolidate", g.postEgoConsolidate, http.MethodPost)
+	handle(mux, "/api/ego/memories", g.getEgoMemories, http.MethodGet)
+	handle(mux, "/api/ego/status", g.getEgoStatus, http.MethodGet)
+	handle(mux, "/api/ego/experiences", g.getEgoExperiences, http.MethodGet)
+	handle(mux, "/api/ego/clear-ltm", g.idempotent(g.postEgoClearLTM), http.MethodPost)
 
 	// AI generation control routes
-	mux.HandleFunc("/api/ai/generation/start", postAIGenerationStart)
-	mux.HandleFunc("/api/ai/generation/stop", postAIGenerationStop)
+	handle(mux, "/api/ai/generation/start", g.postAIGenerationStart, http.MethodPost)
+	handle(mux, "/api/ai/generation/stop", g.postAIGenerationStop, http.MethodPost)
 
 	// Embeddings service routes
-	mux.HandleFunc("/api/embeddings/add", postAddEmbedding)
-	mux.HandleFunc("/api/embeddings", getEmbeddings)
-	mux.HandleFunc("/api/embeddings/source/", getEmbeddingsBySource)
-	mux.HandleFunc("/api/embeddings/reduce-dimensions", postReduceDimensions)
+	handle(mux, "/api/embeddings/add", g.rejectWhenDraining(g.rejectWhenSaturated(g.shedWhenDegraded(g.idempotent(g.postAddEmbedding)), serviceEmbeddings)), http.MethodPost)
+	handle(mux, "/api/embeddings/batch", g.rejectWhenDraining(g.rejectWhenSaturated(g.shedWhenDegraded(g.idempotent(g.postBatchEmbeddings)), serviceEmbeddings)), http.MethodPost)
+	handle(mux, "/api/embeddings", g.getEmbeddings, http.MethodGet)
+	handle(mux, "/api/embeddings/source/", g.getEmbeddingsBySource, http.MethodGet)
+	handle(mux, "/api/embeddings/reduce-dimensions", g.idempotent(g.postReduceDimensions), http.MethodPost)
+	handle(mux, "/api/embeddings/stats", g.getEmbeddingsStats, http.MethodGet)
+
+	// Admin routes, unless they are served on their own listener
+	if g.config().AdminAddr == "" {
+		g.registerAdminRoutes(mux, g.requireAPIKey)
+	}
 
 	// Health check proxy routes
-	mux.HandleFunc("/llm/health", getLLMHealth)
-	mux.HandleFunc("/ego/health", getEgoHealth)
-	mux.HandleFunc("/embeddings/ping", getEmbeddingsPing)
+	handle(mux, "/llm/health", g.getLLMHealth, http.MethodGet)
+	handle(mux, "/ego/health", g.getEgoHealth, http.MethodGet)
+	handle(mux, "/embeddings/ping", g.getEmbeddingsPing, http.MethodGet)
+	handle(mux, "/api/latency/probe", g.getLatencyProbe, http.MethodGet)
+	handle(mux, "/metrics", g.getMetrics, http.MethodGet)
+	handle(mux, "/api/config", g.getPublicConfig, http.MethodGet)
+	handle(mux, "/api/sdk/typescript", g.getTypeScriptSDK, http.MethodGet)
 
 	// Start service status monitor
-	go startServiceStatusMonitor()
+	go g.startServiceStatusMonitor(g.monitorCtx)
 	fmt.Println("Service status monitor started")
+
+	if g.config().StartupCheck {
+		go g.runStartupCheck(g.monitorCtx)
+	}
+
+	if g.config().JanitorInterval > 0 {
+		go g.runJanitor(g.monitorCtx)
+	}
+
+	if g.config().MetricsPollInterval > 0 {
+		go g.pollMetrics(g.monitorCtx)
+		fmt.Printf("Polling consciousness metrics every %s\n", g.config().MetricsPollInterval)
+	}
+
+	for origin, url := range g.config().UpstreamEvents {
+		go g.consumeUpstream(g.monitorCtx, origin, url)
+		fmt.Printf("Relaying upstream events from %s (%s)\n", origin, url)
+	}
 }
 
+// Request body limits per endpoint, also reported by /api/config.
+const (
+	maxFrameBytes    = 8 << 20  // 8MB
+	maxSpeechBytes   = 10 << 20 // 10MB
+	maxTokenizeBytes = 1 << 20  // 1MB
+	maxThoughtBytes  = 1 << 20  // 1MB
+	maxEmitBytes     = 64 << 10 // 64KB
+	maxBatchBytes    = 32 << 20 // 32MB
+	maxBatchItems    = 1000
+
+	// maxThoughtDepth bounds how deeply a thought request's events and
+	// memory patterns may nest.
+	maxThoughtDepth = 16
+)
+
+// Ingested frames and transcripts may carry the hop count of the event they
+// were derived from; events broadcast for them carry that count plus one.
 type frameIn struct {
 	ImageBase64 string `json:"image_base64"`
+	Hops        int    `json:"hops,omitempty"`
+	CameraID    string `json:"camera_id,omitempty"`
+	Synthetic   bool   `json:"synthetic,omitempty"`
 }
 
 type speechIn struct {
 	AudioBase64 string `json:"audio_base64"`
+	Hops        int    `json:"hops,omitempty"`
+	Synthetic   bool   `json:"synthetic,omitempty"`
 }
 
 type tokenizeIn struct {
@@ -73,16 +134,41 @@ type tokenizeIn struct {
 }
 
 type sentienceTokenResp struct {
-	Type        string                 `json:"type"`
-	Ts          int64                  `json:"ts"`
-	EmbeddingID string                 `json:"embedding_id"`
-	Facets      map[string]interface{} `json:"facets"`
+	Type          string                 `json:"type"`
+	Ts            int64                  `json:"ts"`
+	EmbeddingID   string                 `json:"embedding_id"`
+	Facets        map[string]interface{} `json:"facets"`
+	FacetsPresent bool                   `json:"facets_present"`
 }
 
+// UnmarshalJSON always leaves the token with a facets object the frontend
+// can render: a null, missing or non-object facets field decodes to an
+// empty object with FacetsPresent false.
+func (t *sentienceTokenResp) UnmarshalJSON(b []byte) error {
+	type plain sentienceTokenResp
+	var raw struct {
+		plain
+		Facets json.RawMessage `json:"facets"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*t = sentienceTokenResp(raw.plain)
+
+	if json.Unmarshal(raw.Facets, &t.Facets) != nil || t.Facets == nil {
+		t.Facets = map[string]interface{}{}
+		return nil
+	}
+	t.FacetsPresent = true
+	return nil
+}
+
+// whisperResp uses pointers for the optional fields so an omitted value can
+// be told apart from a real zero confidence or empty language.
 type whisperResp struct {
-	Transcript string  `json:"transcript"`
-	Confidence float64 `json:"confidence"`
-	Language   string  `json:"language"`
+	Transcript string   `json:"transcript"`
+	Confidence *float64 `json:"confidence"`
+	Language   *string  `json:"language"`
 }
 
 type thoughtRequest struct {
@@ -92,150 +178,411 @@ type thoughtRequest struct {
 	MemoryPatterns []map[string]interface{} `json:"memory_patterns"`
 }
 
-func postVisionFrame(w http.ResponseWriter, r *http.Request) {
-	const maxSize = 8 << 20 // 8MB
-	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+// broadcastWarning notifies SSE clients that a pipeline stage produced
+// something unusable and the pipeline stopped or degraded. Like the other
+// events of the request served with ctx, it is tagged as synthetic and
+// with the request's correlation.
+func (g *Gateway) broadcastWarning(ctx context.Context, stage, message string) {
+	ev := map[string]any{
+		"type":      "pipeline.warning",
+		"stage":     stage,
+		"message":   message,
+		"timestamp": g.timestamp(),
+	}
+	evBytes, _ := json.Marshal(ev)
+	g.broadcastFrom(ctx, string(evBytes))
+}
+
+// sentienceEventTypes lists the event types the sentience service returns
+// from /run.
+var sentienceEventTypes = map[string]bool{"sentience.token": true}
+
+// broadcastSentience re-broadcasts a sentience /run response. A response
+// without a type is treated as a sentience.token; malformed responses and
+// unknown types are reported as pipeline warnings instead. The event is
+// stamped with the time the gateway relayed it, tagged with the camera the
+// run came from if any, as synthetic when ctx is and with the correlation
+// of ctx, and returned, or nil when nothing was broadcast.
+func (g *Gateway) broadcastSentience(ctx context.Context, data []byte, cameraID string) map[string]any {
+	var ev map[string]any
+	if err := json.Unmarshal(data, &ev); err != nil || ev == nil {
+		g.countFailure(serviceSentience, outcomeParseError)
+		g.broadcastWarning(ctx, "sentience", "malformed response from sentience service")
+		return nil
+	}
+
+	eventType, _ := ev["type"].(string)
+	if eventType == "" {
+		eventType = "sentience.token"
+	}
+	if !sentienceEventTypes[eventType] {
+		g.broadcastWarning(ctx, "sentience", fmt.Sprintf("unknown event type %q from sentience service", eventType))
+		return nil
+	}
+	ev["type"] = eventType
+	ev["timestamp"] = g.timestamp()
+	if cameraID != "" {
+		ev["camera_id"] = cameraID
+	}
+	if isSynthetic(ctx) {
+		ev["synthetic"] = true
+	}
+
+	evBytes, _ := json.Marshal(ev)
+	g.hub.Broadcast(correlationFrom(ctx).tag(string(evBytes)))
+	return ev
+}
+
+// runSentience calls the sentience service's /run with body, broadcasts the
+// resulting token and records the call on trace. It returns the broadcast
+// token, or nil when the run failed.
+func (g *Gateway) runSentience(ctx context.Context, trace *pipelineTrace, body []byte) map[string]any {
+	start := time.Now()
+	resp, err := g.post(ctx, serviceSentience, g.serviceURL(serviceSentience, "/run"), body, 5*time.Second)
+	if err != nil {
+		trace.record("sentience.run", serviceSentience, start, err)
+		return nil
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		trace.record("sentience.run", serviceSentience, start, fmt.Errorf("status %d", resp.StatusCode))
+		return nil
+	}
+
+	token := g.broadcastSentience(ctx, data, trace.cameraID)
+	if token == nil {
+		err = errors.New("unusable response")
+	}
+	trace.record("sentience.run", serviceSentience, start, err)
+	return token
+}
+
+func (g *Gateway) postVisionFrame(w http.ResponseWriter, r *http.Request) {
+	if err := limitRequestBody(w, r, maxFrameBytes); err != nil {
+		http.Error(w, "bad request: invalid gzip body", http.StatusBadRequest)
+		return
+	}
 
 	var in frameIn
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.ImageBase64 == "" {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	if err := g.decodeJSON(r, &in); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	var verr ValidationError
+	if in.ImageBase64 == "" {
+		verr.Add("image_base64", "is required")
+	}
+	if in.Hops < 0 {
+		verr.Add("hops", "must not be negative")
+	}
+	if in.CameraID == "" {
+		in.CameraID = defaultCameraID
+	} else if !validCameraID(in.CameraID) {
+		verr.Add("camera_id", "must be at most 64 letters, digits, dots, dashes or underscores")
+	}
+	if limit := g.config().VisionMaxPixels; limit > 0 && in.ImageBase64 != "" {
+		if width, height, ok := imageDimensions(in.ImageBase64); ok && int64(width)*int64(height) > int64(limit) {
+			verr.Add("image_base64", fmt.Sprintf("is %dx%d, over the limit of %d pixels", width, height, limit))
+		}
+	}
+	if verr.Err() != nil {
+		writeValidationError(w, &verr)
+		return
+	}
+	if g.dropAtMaxHops(w, r, "vision", in.Hops) {
+		return
+	}
+	if in.Synthetic {
+		r = r.WithContext(withSynthetic(r.Context()))
+	}
+	if isDryRun(r) {
+		g.writeDryRunFrame(w, r, in)
 		return
 	}
+	embeddingID := visionEmbeddingID(in.CameraID, newClientID())
+	r = r.WithContext(withCorrelation(r.Context(), embeddingID))
+	trace := newPipelineTrace("vision", embeddingID)
+	trace.cameraID = in.CameraID
+	trace.synthetic = isSynthetic(r.Context())
+	trace.correlation = correlationFrom(r.Context())
+	defer g.broadcastTrace(trace)
+
+	// A frame identical to the one just processed skips the ML and
+	// sentience calls and re-broadcasts the earlier observation.
+	dedup := g.config().VisionDedupWindow > 0
+	var hash [sha256.Size]byte
+	if dedup {
+		hash = frameHash(in.ImageBase64)
+		if topK, ok := g.cachedObservation(hash, in.CameraID); ok {
+			trace.record("dedup", "", trace.start, nil)
+			evBytes, _ := json.Marshal(map[string]any{
+				"type":         "vision.observation",
+				"clip_topk":    topK,
+				"embedding_id": embeddingID,
+				"camera_id":    in.CameraID,
+				"hops":         in.Hops + 1,
+				"cached":       true,
+			})
+			g.broadcastFrom(r.Context(), string(evBytes))
+			writePipelineOK(w, embeddingID, true)
+			return
+		}
+	}
 
 	body, _ := json.Marshal(map[string]string{"image_base64": in.ImageBase64})
-	resp, err := http.Post("http://localhost:8081/infer/clip", "application/json", bytes.NewReader(body))
+	mlStart := time.Now()
+	resp, degradedML, err := g.inferML(r.Context(), "/infer/clip", body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		trace.record("ml.clip", serviceML, mlStart, err)
+		writeStageError(w, "ml.clip", serviceML, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
-	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		trace.record("ml.clip", serviceML, mlStart, fmt.Errorf("status %d", resp.StatusCode))
+		writeStageError(w, "ml.clip", serviceML, nil, "ml service error", http.StatusBadGateway)
+		return
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		trace.record("ml.clip", serviceML, mlStart, err)
+		writeStageError(w, "ml.clip", serviceML, err, err.Error(), http.StatusBadGateway)
+		return
+	}
 
 	var out struct {
-		TopK []struct {
-			Label string  `json:"label"`
-			Score float64 `json:"score"`
-		} `json:"topk"`
-		Embedding     []float64 `json:"embedding"`
-		DominantColor string    `json:"dominant_color"`
-		AffectValence float64   `json:"affect_valence"`
-		AffectArousal float64   `json:"affect_arousal"`
+		TopK          []scoredLabel `json:"topk"`
+		Embedding     []float64     `json:"embedding"`
+		DominantColor string        `json:"dominant_color"`
+		AffectValence float64       `json:"affect_valence"`
+		AffectArousal float64       `json:"affect_arousal"`
 	}
 	if err := json.Unmarshal(b, &out); err != nil {
-		http.Error(w, "ml parse error", http.StatusBadGateway)
+		g.countFailure(serviceML, outcomeParseError)
+		trace.record("ml.clip", serviceML, mlStart, errors.New("ml parse error"))
+		writeStageError(w, "ml.clip", serviceML, nil, "ml parse error", http.StatusBadGateway)
 		return
 	}
+	trace.record("ml.clip", serviceML, mlStart, nil)
+	// The affect trend is shared by every client, so load-test frames stay
+	// out of it
+	if !isSynthetic(r.Context()) {
+		g.recordAffect(out.AffectValence, out.AffectArousal)
+	}
+	mlLabels := len(out.TopK)
+	out.TopK = g.allowedLabels(out.TopK)
+	if dedup {
+		g.rememberFrame(hash, in.CameraID, out.TopK)
+	}
 
 	// broadcast SSE event
 	ev := map[string]any{
 		"type":         "vision.observation",
 		"clip_topk":    out.TopK,
-		"embedding_id": "emb-1",
+		"embedding_id": embeddingID,
+		"camera_id":    in.CameraID,
+		"hops":         in.Hops + 1,
+	}
+	if degradedML {
+		ev["degraded_ml"] = true
+	}
+	if g.includeEmbedding(r) && !embeddingMissing(out.Embedding) {
+		ev["embedding"] = out.Embedding
 	}
 	evBytes, _ := json.Marshal(ev)
-	hub.Broadcast(string(evBytes))
+	g.broadcastFrom(r.Context(), string(evBytes))
+
+	if mlLabels > 0 && len(out.TopK) == 0 {
+		g.broadcastWarning(r.Context(), "vision", "no labels matched the vision label allow-list, skipping sentience run")
+		writePipelineOK(w, embeddingID, false)
+		return
+	}
 
 	// Also call sentience run for vision
+	var visionObject string
+	if len(out.TopK) > 0 {
+		visionObject = out.TopK[0].Label
+	}
 	runReq := map[string]interface{}{
-		"embedding_id":   "emb-1",
-		"context":        fmt.Sprintf("%s:%.2f %s:%.2f %s:%.2f", out.TopK[0].Label, out.TopK[0].Score, out.TopK[1].Label, out.TopK[1].Score, out.TopK[2].Label, out.TopK[2].Score),
-		"vision_object":  out.TopK[0].Label,
+		"embedding_id":   embeddingID,
+		"camera_id":      in.CameraID,
+		"context":        ContextBuilder{TopK: g.config().TopKContext}.Vision(out.TopK, out.DominantColor, out.AffectValence, out.AffectArousal),
+		"vision_object":  visionObject,
 		"vision_color":   out.DominantColor,
 		"affect_valence": out.AffectValence,
 		"affect_arousal": out.AffectArousal,
 		"embedding":      out.Embedding,
 	}
+	// An empty or all-zero vector would be stored and searched as if it
+	// were real, so the run goes ahead flagged as missing its embedding
+	if embeddingMissing(out.Embedding) {
+		g.broadcastWarning(r.Context(), "vision", "empty or all-zero embedding from ML service, running sentience without it")
+		runReq["embedding"] = nil
+		runReq["embedding_missing"] = true
+	}
 	runBody, _ := json.Marshal(runReq)
 	fmt.Printf("Calling sentience /run with: %s\n", string(runBody))
-	runClient := &http.Client{Timeout: 5 * time.Second}
-	runResp, err := runClient.Post("http://localhost:8082/run", "application/json", bytes.NewReader(runBody))
-	if err == nil && runResp.StatusCode < 400 {
-		runData, _ := io.ReadAll(runResp.Body)
-		runResp.Body.Close()
-
-		// Parse the response and broadcast as sentience.token event
-		var sentienceResp map[string]interface{}
-		if err := json.Unmarshal(runData, &sentienceResp); err == nil {
-			hub.Broadcast(string(runData))
-		}
-	}
+	trace.token = g.runSentience(r.Context(), trace, runBody)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"ok":true}`))
+	writePipelineOK(w, embeddingID, false)
 }
 
-func postSentienceTokenize(w http.ResponseWriter, r *http.Request) {
-	const maxSize = 1 << 20 // 1MB
-	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+func (g *Gateway) postSentienceTokenize(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxTokenizeBytes)
 
 	var in tokenizeIn
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.EmbeddingID == "" {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	if err := g.decodeJSON(r, &in); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	var verr ValidationError
+	if in.EmbeddingID == "" {
+		verr.Add("embedding_id", "is required")
+	}
+	if verr.Err() != nil {
+		writeValidationError(w, &verr)
 		return
 	}
 
 	// call Sentience service
 	body, _ := json.Marshal(in)
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Post("http://localhost:8082/tokenize", "application/json", bytes.NewReader(body))
+	resp, err := g.post(r.Context(), serviceSentience, g.serviceURL(serviceSentience, "/tokenize"), body, 5*time.Second)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		http.Error(w, "sentience service error", http.StatusBadGateway)
+		writeStageError(w, "", serviceSentience, nil, "sentience service error", http.StatusBadGateway)
 		return
 	}
 
-	b, _ := io.ReadAll(resp.Body)
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeStageError(w, "", serviceSentience, err, err.Error(), http.StatusBadGateway)
+		return
+	}
 
 	var out sentienceTokenResp
 	if err := json.Unmarshal(b, &out); err != nil {
-		http.Error(w, "sentience parse error", http.StatusBadGateway)
+		g.countFailure(serviceSentience, outcomeParseError)
+		writeStageError(w, "", serviceSentience, nil, "sentience parse error", http.StatusBadGateway)
 		return
 	}
 
 	// broadcast SSE event
 	evBytes, _ := json.Marshal(out)
-	hub.Broadcast(string(evBytes))
+	g.broadcastFrom(r.Context(), string(evBytes))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"ok":true}`))
 }
 
-func postSpeechTranscript(w http.ResponseWriter, r *http.Request) {
-	const maxSize = 10 << 20 // 10MB
-	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+func (g *Gateway) postSpeechTranscript(w http.ResponseWriter, r *http.Request) {
+	if err := limitRequestBody(w, r, maxSpeechBytes); err != nil {
+		http.Error(w, "bad request: invalid gzip body", http.StatusBadRequest)
+		return
+	}
 
 	var in speechIn
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.AudioBase64 == "" {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	if err := g.decodeJSON(r, &in); err != nil {
+		writeDecodeError(w, err)
 		return
 	}
+	var verr ValidationError
+	if in.AudioBase64 == "" {
+		verr.Add("audio_base64", "is required")
+	}
+	if in.Hops < 0 {
+		verr.Add("hops", "must not be negative")
+	}
+	if verr.Err() != nil {
+		writeValidationError(w, &verr)
+		return
+	}
+	if g.dropAtMaxHops(w, r, "speech", in.Hops) {
+		return
+	}
+	if in.Synthetic {
+		r = r.WithContext(withSynthetic(r.Context()))
+	}
+	embeddingID := speechEmbeddingID()
+	r = r.WithContext(withCorrelation(r.Context(), embeddingID))
+	trace := newPipelineTrace("speech", embeddingID)
+	trace.synthetic = isSynthetic(r.Context())
+	trace.correlation = correlationFrom(r.Context())
+	defer g.broadcastTrace(trace)
+
+	// One deadline bounds all stages together, so a slow stage eats into
+	// the budget of the ones after it instead of each timing out alone
+	ctx, cancel := context.WithTimeout(r.Context(), g.scaleTimeout(g.config().SpeechTimeout))
+	defer cancel()
+	timedOut := func() bool {
+		trace.deadlineExceeded = errors.Is(ctx.Err(), context.DeadlineExceeded)
+		return trace.deadlineExceeded
+	}
 
 	// call ML service for Whisper
 	body, _ := json.Marshal(map[string]string{"audio_base64": in.AudioBase64})
-	resp, err := http.Post("http://localhost:8081/infer/whisper", "application/json", bytes.NewReader(body))
+	mlStart := time.Now()
+	resp, degradedML, err := g.inferML(ctx, "/infer/whisper", body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		trace.record("ml.whisper", serviceML, mlStart, err)
+		timedOut()
+		writeStageError(w, "ml.whisper", serviceML, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
-	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		trace.record("ml.whisper", serviceML, mlStart, fmt.Errorf("status %d", resp.StatusCode))
+		writeStageError(w, "ml.whisper", serviceML, nil, "ml service error", http.StatusBadGateway)
+		return
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		trace.record("ml.whisper", serviceML, mlStart, err)
+		timedOut()
+		writeStageError(w, "ml.whisper", serviceML, err, err.Error(), http.StatusBadGateway)
+		return
+	}
 
 	var out whisperResp
 	if err := json.Unmarshal(b, &out); err != nil {
-		http.Error(w, "whisper parse error", http.StatusBadGateway)
+		g.countFailure(serviceML, outcomeParseError)
+		trace.record("ml.whisper", serviceML, mlStart, errors.New("whisper parse error"))
+		writeStageError(w, "ml.whisper", serviceML, nil, "whisper parse error", http.StatusBadGateway)
+		return
+	}
+
+	if strings.TrimSpace(out.Transcript) == "" {
+		trace.record("ml.whisper", serviceML, mlStart, errors.New("empty transcript"))
+		g.broadcastWarning(ctx, "whisper", "empty transcript from ML service")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"ok":false,"error":"empty transcript"}`))
 		return
 	}
 
+	trace.record("ml.whisper", serviceML, mlStart, nil)
+
 	// Generate text embedding for the transcript
 	var textEmbedding []float64
 	textBody, _ := json.Marshal(map[string]string{"text": out.Transcript})
-	textResp, err := http.Post("http://localhost:8081/infer/text", "application/json", bytes.NewReader(textBody))
-	if err == nil && textResp.StatusCode < 400 {
+	textStart := time.Now()
+	err = g.mlSlots.acquire(ctx, g.config().MLQueueTimeout)
+	var textResp *http.Response
+	if err == nil {
+		textResp, err = g.post(ctx, serviceML, g.serviceURL(serviceML, "/infer/text"), textBody, 0)
+		textResp = g.mlSlots.holdUntilClosed(textResp)
+	}
+	if err == nil && textResp.StatusCode >= 400 {
+		textResp.Body.Close()
+		err = fmt.Errorf("status %d", textResp.StatusCode)
+	}
+	trace.record("ml.text", serviceML, textStart, err)
+	if err == nil {
 		textData, _ := io.ReadAll(textResp.Body)
 		textResp.Body.Close()
 
@@ -256,591 +603,745 @@ func postSpeechTranscript(w http.ResponseWriter, r *http.Request) {
 	ev := map[string]any{
 		"type":         "speech.transcript",
 		"transcript":   out.Transcript,
-		"confidence":   out.Confidence,
-		"language":     out.Language,
-		"embedding_id": "speech-1",
+		"embedding_id": embeddingID,
+		"hops":         in.Hops + 1,
+	}
+	// Only report fields the ML service actually provided
+	if out.Confidence != nil {
+		ev["confidence"] = *out.Confidence
+	}
+	if out.Language != nil {
+		ev["language"] = *out.Language
+	}
+	if degradedML {
+		ev["degraded_ml"] = true
+	}
+	// Out of time after the transcript: still deliver it, flagged as
+	// partial, but skip the sentience run
+	partial := timedOut()
+	if partial {
+		ev["partial"] = true
 	}
 	evBytes, _ := json.Marshal(ev)
-	hub.Broadcast(string(evBytes))
+	g.broadcastFrom(r.Context(), string(evBytes))
+	if partial {
+		writeJSONError(w, http.StatusGatewayTimeout, errorBody{Code: "deadline_exceeded", Message: "speech pipeline deadline exceeded", Service: serviceML, Stage: "ml.text"})
+		return
+	}
 
 	// Also call sentience run for speech
 	runReq := map[string]interface{}{
-		"embedding_id": "speech-1",
-		"context":      "",
+		"embedding_id": embeddingID,
+		"context":      ContextBuilder{TopK: g.config().TopKContext}.Speech(out.Transcript),
 		"transcript":   out.Transcript,
 		"embedding":    textEmbedding,
 	}
 	runBody, _ := json.Marshal(runReq)
-	runClient := &http.Client{Timeout: 5 * time.Second}
-	runResp, err := runClient.Post("http://localhost:8082/run", "application/json", bytes.NewReader(runBody))
-	if err == nil && runResp.StatusCode < 400 {
-		runData, _ := io.ReadAll(runResp.Body)
-		runResp.Body.Close()
-
-		// Parse the response and broadcast as sentience.token event
-		var sentienceResp map[string]interface{}
-		if err := json.Unmarshal(runData, &sentienceResp); err == nil {
-			hub.Broadcast(string(runData))
-		}
+	trace.token = g.runSentience(ctx, trace, runBody)
+	if timedOut() {
+		writeJSONError(w, http.StatusGatewayTimeout, errorBody{Code: "deadline_exceeded", Message: "speech pipeline deadline exceeded", Service: serviceSentience, Stage: "sentience.run"})
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"ok":true}`))
+	writePipelineOK(w, embeddingID, false)
 }
 
-func postGenerateThought(w http.ResponseWriter, r *http.Request) {
-	const maxSize = 1 << 20 // 1MB
-	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+func (g *Gateway) postGenerateThought(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxThoughtBytes)
 
 	var in thoughtRequest
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	if err := limitJSONDepth(r, maxThoughtDepth); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if err := g.decodeJSON(r, &in); err != nil {
+		writeDecodeError(w, err)
 		return
 	}
 
+	// Track the generation so it can be canceled by ID
+	id := r.Header.Get("X-Request-ID")
+	if id == "" {
+		id = newClientID()
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if !g.trackGeneration(id, cancel) {
+		http.Error(w, "a generation with this X-Request-ID is already in flight", http.StatusConflict)
+		return
+	}
+	defer g.untrackGeneration(id)
+	w.Header().Set("X-Request-ID", id)
+
 	// call LLM service
 	body, _ := json.Marshal(in)
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Post("http://localhost:8083/generate-thought", "application/json", bytes.NewReader(body))
+	resp, err := g.requestThought(ctx, body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		if r.Context().Err() == nil && ctx.Err() != nil {
+			http.Error(w, "thought generation canceled", http.StatusConflict)
+			return
+		}
+		if g.config().DegradedThoughts && r.Context().Err() == nil {
+			g.writeDegradedThought(w, r, in)
+			return
+		}
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		http.Error(w, "llm service error", http.StatusBadGateway)
+		writeStageError(w, "", serviceLLM, nil, "llm service error", http.StatusBadGateway)
 		return
 	}
 
-	b, _ := io.ReadAll(resp.Body)
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if r.Context().Err() == nil && ctx.Err() != nil {
+			http.Error(w, "thought generation canceled", http.StatusConflict)
+			return
+		}
+		writeStageError(w, "", serviceLLM, err, err.Error(), http.StatusBadGateway)
+		return
+	}
 
 	var out map[string]interface{}
 	if err := json.Unmarshal(b, &out); err != nil {
-		http.Error(w, "llm parse error", http.StatusBadGateway)
+		g.countFailure(serviceLLM, outcomeParseError)
+		writeStageError(w, "", serviceLLM, nil, "llm parse error", http.StatusBadGateway)
 		return
 	}
 
-	// broadcast SSE event if thought was generated successfully
-	if success, ok := out["success"].(bool); ok && success {
-		if thought, ok := out["thought"].(map[string]interface{}); ok {
-			ev := map[string]any{
-				"type":    "ego.thought",
-				"thought": thought,
-			}
-			evBytes, _ := json.Marshal(ev)
-			hub.Broadcast(string(evBytes))
-		}
-	}
+	g.broadcastThoughtResult(r.Context(), out)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(b)
 }
 
-func getConsciousnessMetrics(w http.ResponseWriter, r *http.Request) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get("http://localhost:8083/consciousness-metrics")
+func (g *Gateway) getConsciousnessMetrics(w http.ResponseWriter, r *http.Request) {
+	resp, err := g.get(r.Context(), serviceLLM, g.serviceURL(serviceLLM, "/consciousness-metrics"), 5*time.Second)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		http.Error(w, "llm service error", http.StatusBadGateway)
+		writeStageError(w, "", serviceLLM, nil, "llm service error", http.StatusBadGateway)
 		return
 	}
 
-	b, _ := io.ReadAll(resp.Body)
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeStageError(w, "", serviceLLM, err, err.Error(), http.StatusBadGateway)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(b)
 }
 
-func getThoughtHistory(w http.ResponseWriter, r *http.Request) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get("http://localhost:8083/thought-history")
+func (g *Gateway) getThoughtHistory(w http.ResponseWriter, r *http.Request) {
+	resp, err := g.get(r.Context(), serviceLLM, g.serviceURL(serviceLLM, "/thought-history"), 5*time.Second)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		http.Error(w, "llm service error", http.StatusBadGateway)
+		writeStageError(w, "", serviceLLM, nil, "llm service error", http.StatusBadGateway)
 		return
 	}
 
-	b, _ := io.ReadAll(resp.Body)
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeStageError(w, "", serviceLLM, err, err.Error(), http.StatusBadGateway)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(b)
 }
 
-func getMemory(w http.ResponseWriter, r *http.Request) {
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+func (g *Gateway) getMemory(w http.ResponseWriter, r *http.Request) {
+	rawQuery := r.URL.RawQuery
+	stream := false
+	if query := r.URL.Query(); query.Has("stream") {
+		stream = query.Get("stream") == "true"
+		query.Del("stream")
+		rawQuery = query.Encode()
+	}
+
+	// Filters the sentience service lacks are applied here, on the full
+	// memory set, which rules out streaming it through.
+	query, _ := url.ParseQuery(rawQuery)
+	filter, verr := parseMemoryFilter(query)
+	if verr != nil {
+		writeValidationError(w, verr)
+		return
+	}
+	if filter.active() || r.URL.Query().Has("after") {
+		rawQuery = query.Encode()
+	}
+	if filter.active() {
+		stream = false
 	}
 
-	url := "http://localhost:8082/memory"
-	if r.URL.RawQuery != "" {
-		url = "http://localhost:8082/memory?" + r.URL.RawQuery
+	url := g.serviceURL(serviceSentience, "/memory")
+	if rawQuery != "" {
+		url += "?" + rawQuery
 	}
 
-	resp, err := client.Get(url)
+	// In stream mode the relay may legitimately outlast the timeout, so the
+	// timer is stopped once the response headers arrive.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	timer := time.AfterFunc(g.scaleTimeout(g.config().MemoryTimeout), cancel)
+	defer timer.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		http.Error(w, "Failed to fetch memory from Sentience service", http.StatusInternalServerError)
 		return
 	}
+	// Forwarding Accept-Encoding stops the transport from transparently
+	// decompressing, so a gzip body is relayed with its Content-Encoding.
+	if encoding := r.Header.Get("Accept-Encoding"); encoding != "" && !filter.active() {
+		req.Header.Set("Accept-Encoding", encoding)
+	}
+
+	if !isForced(r.Context()) && g.serviceOffline(serviceSentience) {
+		writeStageError(w, "", serviceSentience, errServiceOffline, "", 0)
+		return
+	}
+
+	req, span := startClientSpan(req, serviceSentience)
+	resp, err := g.client.Do(req)
+	if err != nil {
+		endClientSpan(span, nil, err)
+		writeStageError(w, "", serviceSentience, err, "Failed to fetch memory from Sentience service", http.StatusInternalServerError)
+		return
+	}
+	defer endClientSpan(span, resp, nil)
+	g.limitBody(serviceSentience, resp)
 	defer resp.Body.Close()
 
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
+	if stream {
+		timer.Stop()
+		relay(w, resp)
+		return
+	}
+	if filter.active() {
+		g.relayFiltered(w, r, resp, filter)
+		return
 	}
 
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	relayWithETag(w, r, resp)
 }
 
 // Ego service handlers
-func postEgoReflect(w http.ResponseWriter, r *http.Request) {
+func (g *Gateway) postEgoReflect(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Read the request body
-	body, err := io.ReadAll(r.Body)
+	// Read the request body, which the ego service decodes as JSON
+	body, err := readJSONBody(r, true)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
 
 	// Forward request to ego service
-	client := &http.Client{}
-	resp, err := client.Post("http://localhost:8084/api/ego/reflect", "application/json", bytes.NewReader(body))
+	resp, err := g.post(r.Context(), serviceEgo, g.serviceURL(serviceEgo, "/api/ego/reflect"), body, 0)
 	if err != nil {
-		http.Error(w, "Failed to call ego service", http.StatusInternalServerError)
+		writeDownstreamError(w, err, "Failed to call ego service", http.StatusInternalServerError)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
-
 	// If successful, broadcast new thought event
 	if resp.StatusCode == 200 {
 		thoughtEvent := map[string]interface{}{
 			"type":      "thought.generated",
-			"timestamp": time.Now().Unix(),
+			"timestamp": g.timestamp(),
 			"source":    "ego",
 		}
 		thoughtBytes, _ := json.Marshal(thoughtEvent)
-		hub.Broadcast(string(thoughtBytes))
+		g.broadcastFrom(r.Context(), string(thoughtBytes))
 	}
 
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	// Copy response headers and body
+	relay(w, resp)
 }
 
-func postEgoConsolidate(w http.ResponseWriter, r *http.Request) {
+func (g *Gateway) postEgoConsolidate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Read the request body
-	body, err := io.ReadAll(r.Body)
+	// Read the request body, which may be empty
+	body, err := readJSONBody(r, false)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
 
 	// Forward request to ego service
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Post("http://localhost:8084/api/ego/consolidate", "application/json", bytes.NewReader(body))
+	resp, err := g.post(r.Context(), serviceEgo, g.serviceURL(serviceEgo, "/api/ego/consolidate"), body, 30*time.Second)
 	if err != nil {
-		http.Error(w, "Failed to call ego service", http.StatusInternalServerError)
+		writeDownstreamError(w, err, "Failed to call ego service", http.StatusInternalServerError)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
-
 	// If successful, broadcast experience consolidation event
 	if resp.StatusCode == 200 {
 		experienceEvent := map[string]interface{}{
 			"type":      "experience.consolidated",
-			"timestamp": time.Now().Unix(),
+			"timestamp": g.timestamp(),
 			"source":    "ego",
 		}
 		experienceBytes, _ := json.Marshal(experienceEvent)
-		hub.Broadcast(string(experienceBytes))
+		g.broadcastFrom(r.Context(), string(experienceBytes))
 	}
 
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	// Copy response headers and body
+	relay(w, resp)
 }
 
-func getEgoMemories(w http.ResponseWriter, r *http.Request) {
+func (g *Gateway) getEgoMemories(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Forward request to ego service
-	client := &http.Client{Timeout: 10 * time.Second}
-	url := "http://localhost:8084/api/ego/memories" + r.URL.RawQuery
-	resp, err := client.Get(url)
+	url := g.serviceURL(serviceEgo, "/api/ego/memories") + r.URL.RawQuery
+	resp, err := g.get(r.Context(), serviceEgo, url, 10*time.Second)
 	if err != nil {
-		http.Error(w, "Failed to call ego service", http.StatusInternalServerError)
+		writeDownstreamError(w, err, "Failed to call ego service", http.StatusInternalServerError)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
-
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	// Copy response headers and body
+	relay(w, resp)
 }
 
-func getEgoStatus(w http.ResponseWriter, r *http.Request) {
+func (g *Gateway) getEgoStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Forward request to ego service
-	client := &http.Client{Timeout: 10 * time.Second}
-	url := "http://localhost:8084/api/ego/status"
-	resp, err := client.Get(url)
+	url := g.serviceURL(serviceEgo, "/api/ego/status")
+	resp, err := g.get(r.Context(), serviceEgo, url, 10*time.Second)
 	if err != nil {
-		http.Error(w, "Failed to call ego service", http.StatusInternalServerError)
+		writeDownstreamError(w, err, "Failed to call ego service", http.StatusInternalServerError)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
-
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	// Copy response headers and body
+	relay(w, resp)
 }
 
-func getEgoExperiences(w http.ResponseWriter, r *http.Request) {
+func (g *Gateway) getEgoExperiences(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Forward request to ego service
-	client := &http.Client{Timeout: 10 * time.Second}
-	url := "http://localhost:8084/api/ego/experiences" + r.URL.RawQuery
-	resp, err := client.Get(url)
+	url := g.serviceURL(serviceEgo, "/api/ego/experiences") + r.URL.RawQuery
+	resp, err := g.get(r.Context(), serviceEgo, url, 10*time.Second)
 	if err != nil {
-		http.Error(w, "Failed to call ego service", http.StatusInternalServerError)
+		writeDownstreamError(w, err, "Failed to call ego service", http.StatusInternalServerError)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
-
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	// Copy response headers and body
+	relay(w, resp)
 }
 
-func postEgoClearLTM(w http.ResponseWriter, r *http.Request) {
+func (g *Gateway) postEgoClearLTM(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Read the request body
-	body, err := io.ReadAll(r.Body)
+	// Read the request body, which the ego service decodes as JSON
+	body, err := readJSONBody(r, true)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
 
 	// Forward request to ego service
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Post("http://localhost:8084/api/ego/clear-ltm", "application/json", bytes.NewReader(body))
+	resp, err := g.post(r.Context(), serviceEgo, g.serviceURL(serviceEgo, "/api/ego/clear-ltm"), body, 10*time.Second)
 	if err != nil {
-		http.Error(w, "Failed to call ego service", http.StatusInternalServerError)
+		writeDownstreamError(w, err, "Failed to call ego service", http.StatusInternalServerError)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
-
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	// Copy response headers and body
+	relay(w, resp)
 }
 
-func postAddEmbedding(w http.ResponseWriter, r *http.Request) {
+func (g *Gateway) postAddEmbedding(w http.ResponseWriter, r *http.Request) {
 	// Read the request body
-	body, err := io.ReadAll(r.Body)
+	body, err := readJSONBody(r, true)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Post("http://localhost:8085/add", "application/json", bytes.NewReader(body))
+	if g.normalizeEmbeddings(r) {
+		var skipped bool
+		if body, skipped = normalizeEmbeddingBody(body); skipped {
+			g.broadcastWarning(r.Context(), "embeddings", "empty or all-zero embedding, storing it without normalizing")
+		}
+	}
+
+	resp, err := g.post(r.Context(), serviceEmbeddings, g.embeddingsURL(r.Context(), "/add"), body, 10*time.Second)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
+	// Copy response headers and body
+	relay(w, resp)
+}
+
+type batchEmbeddingItem struct {
+	ID        string    `json:"id"`
+	Source    string    `json:"source"`
+	Embedding []float64 `json:"embedding"`
+}
+
+type batchEmbeddingResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+var embeddingSources = map[string]bool{"vision": true, "speech": true}
+
+// postBatchEmbeddings validates a JSON array of embeddings and forwards the
+// valid ones to the embeddings service, which only accepts one embedding per
+// call, with a bounded number of requests in flight.
+func (g *Gateway) postBatchEmbeddings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := limitRequestBody(w, r, maxBatchBytes); err != nil {
+		http.Error(w, "bad request: invalid gzip body", http.StatusBadRequest)
+		return
+	}
+
+	var items []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		http.Error(w, "bad request: expected a JSON array of embeddings", http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 || len(items) > maxBatchItems {
+		http.Error(w, fmt.Sprintf("bad request: batch must contain 1-%d embeddings", maxBatchItems), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]batchEmbeddingResult, len(items))
+	dimensions := map[string]int{}
+	var valid []int
+	for i, raw := range items {
+		results[i].Index = i
+
+		var item batchEmbeddingItem
+		if err := json.Unmarshal(raw, &item); err != nil {
+			results[i].Error = "invalid embedding object"
+			continue
+		}
+		results[i].ID = item.ID
+
+		switch {
+		case item.ID == "":
+			results[i].Error = "missing id"
+		case !embeddingSources[item.Source]:
+			results[i].Error = fmt.Sprintf("unknown source %q", item.Source)
+		case len(item.Embedding) == 0:
+			results[i].Error = "empty embedding"
+		case dimensions[item.Source] != 0 && dimensions[item.Source] != len(item.Embedding):
+			results[i].Error = fmt.Sprintf("dimension %d does not match %d for source %q",
+				len(item.Embedding), dimensions[item.Source], item.Source)
+		default:
+			dimensions[item.Source] = len(item.Embedding)
+			valid = append(valid, i)
+		}
+	}
+
+	if g.normalizeEmbeddings(r) {
+		zero := 0
+		for _, i := range valid {
+			var skipped bool
+			if items[i], skipped = normalizeEmbeddingBody(items[i]); skipped {
+				zero++
+			}
+		}
+		if zero > 0 {
+			g.broadcastWarning(r.Context(), "embeddings", fmt.Sprintf("%d all-zero embeddings in batch, storing them without normalizing", zero))
 		}
 	}
 
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	sem := make(chan struct{}, g.config().EmbeddingsBatchConcurrency)
+	var wg sync.WaitGroup
+	for _, i := range valid {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			resp, err := g.post(r.Context(), serviceEmbeddings, g.embeddingsURL(r.Context(), "/add"), items[i], 10*time.Second)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			io.Copy(io.Discard, resp.Body)
+
+			if resp.StatusCode >= 400 {
+				results[i].Error = fmt.Sprintf("embeddings service returned %d", resp.StatusCode)
+				return
+			}
+			results[i].OK = true
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, res := range results {
+		if res.OK {
+			succeeded++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":     len(results),
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	})
 }
 
-func getEmbeddings(w http.ResponseWriter, r *http.Request) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get("http://localhost:8085/embeddings")
+func (g *Gateway) getEmbeddings(w http.ResponseWriter, r *http.Request) {
+	resp, err := g.get(r.Context(), serviceEmbeddings, g.embeddingsURL(r.Context(), "/embeddings"), 10*time.Second)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
-
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	// Relay as JSON, or as msgpack when the client accepts it
+	relayNegotiated(w, r, serviceEmbeddings, resp)
 }
 
-func getEmbeddingsBySource(w http.ResponseWriter, r *http.Request) {
+func (g *Gateway) getEmbeddingsBySource(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 	source := path[len("/api/embeddings/source/"):]
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get("http://localhost:8085/embeddings/source/" + source)
+	resp, err := g.get(r.Context(), serviceEmbeddings, g.embeddingsURL(r.Context(), "/embeddings/source/")+source, 10*time.Second)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
-
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	// Relay as JSON, or as msgpack when the client accepts it
+	relayNegotiated(w, r, serviceEmbeddings, resp)
 }
 
-func postReduceDimensions(w http.ResponseWriter, r *http.Request) {
+func (g *Gateway) postReduceDimensions(w http.ResponseWriter, r *http.Request) {
 	// Read the request body
-	body, err := io.ReadAll(r.Body)
+	body, err := readJSONBody(r, true)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		writeBodyError(w, err)
+		return
+	}
+	if verr := checkUniformDimensions(body); verr != nil {
+		writeValidationError(w, verr)
+		return
+	}
+	body, verr := g.checkReductionParams(body)
+	if verr != nil {
+		writeValidationError(w, verr)
 		return
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Post("http://localhost:8081/reduce-dimensions", "application/json", bytes.NewReader(body))
+	resp, err := g.post(r.Context(), serviceML, g.serviceURL(serviceML, "/reduce-dimensions"), body, 30*time.Second)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
+	if resp.StatusCode != http.StatusOK {
+		relay(w, resp)
+		return
 	}
 
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeStageError(w, "", serviceML, err, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if err := checkReduction(b, embeddingCount(body)); err != nil {
+		writeStageError(w, "", serviceML, nil, "invalid reduction from ml service: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
 }
 
 // Health check proxy functions
-func getLLMHealth(w http.ResponseWriter, r *http.Request) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get("http://localhost:8083/health")
+func (g *Gateway) getLLMHealth(w http.ResponseWriter, r *http.Request) {
+	resp, err := g.get(r.Context(), serviceLLM, g.serviceURL(serviceLLM, "/health"), 5*time.Second)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
-
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	// Copy response headers and body
+	relay(w, resp)
 }
 
-func getEgoHealth(w http.ResponseWriter, r *http.Request) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get("http://localhost:8084/health")
+func (g *Gateway) getEgoHealth(w http.ResponseWriter, r *http.Request) {
+	resp, err := g.get(r.Context(), serviceEgo, g.serviceURL(serviceEgo, "/health"), 5*time.Second)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
-
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	// Copy response headers and body
+	relay(w, resp)
 }
 
-func getEmbeddingsPing(w http.ResponseWriter, r *http.Request) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get("http://localhost:8085/ping")
+func (g *Gateway) getEmbeddingsPing(w http.ResponseWriter, r *http.Request) {
+	resp, err := g.get(r.Context(), serviceEmbeddings, g.embeddingsURL(r.Context(), "/ping"), 5*time.Second)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		writeDownstreamError(w, err, err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
-	}
+	// Copy response headers and body
+	relay(w, resp)
+}
 
-	// Copy response body
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+// servicePorts maps each service watched by the status monitor to its port.
+var servicePorts = map[string]int{
+	"gateway":    8080,
+	"ml":         8081,
+	"sentience":  8082,
+	"llm":        8083,
+	"ego":        8084,
+	"embeddings": 8085,
 }
 
-// Service status monitor
-func startServiceStatusMonitor() {
-	servicePorts := map[string]int{
-		"gateway":    8080,
-		"ml":         8081,
-		"sentience":  8082,
-		"llm":        8083,
-		"ego":        8084,
-		"embeddings": 8085,
+// healthEndpoint returns the path used to check a service's health.
+func healthEndpoint(serviceName string) string {
+	switch serviceName {
+	case "llm", "ego":
+		return "/health"
+	default:
+		return "/ping"
 	}
+}
+
+// statusCheckInterval is how often the status monitor checks each service.
+const statusCheckInterval = 5 * time.Second
 
-	client := &http.Client{Timeout: 500 * time.Millisecond}
+// startServiceStatusMonitor checks every service every five seconds until
+// ctx is canceled, which also aborts the checks still in flight. Each check
+// is delayed by a random part of StatusCheckJitter, so the services are not
+// all hit at the same instant.
+func (g *Gateway) startServiceStatusMonitor(ctx context.Context) {
+	ticker := time.NewTicker(statusCheckInterval)
+	defer ticker.Stop()
+	jitter := min(g.config().StatusCheckJitter, statusCheckInterval)
 
 	for {
-		for service, port := range servicePorts {
-			go func(serviceName string, servicePort int) {
-				// Skip LLM check during generation, use last known status
-				if isAIGenerating && serviceName == "llm" {
-					statusEvent := map[string]interface{}{
-						"type":      "service.status",
-						"service":   serviceName,
-						"status":    lastKnownLLMStatus,
-						"timestamp": time.Now().Unix(),
-					}
-					statusBytes, _ := json.Marshal(statusEvent)
-					hub.Broadcast(string(statusBytes))
+		go runLimited(serviceNames(), g.config().FanOutConcurrency, func(serviceName string) {
+			if jitter > 0 {
+				select {
+				case <-time.After(rand.N(jitter)):
+				case <-ctx.Done():
 					return
 				}
+			}
 
-				// Check service health
-				online := checkServiceHealth(client, servicePort, serviceName)
-				status := map[bool]string{true: "online", false: "offline"}[online]
-
-				// Store LLM status for preservation during generation
-				if serviceName == "llm" {
-					lastKnownLLMStatus = status
-				}
-
-				// Broadcast status update
+			// Skip LLM check during generation, use last known status
+			if g.isAIGenerating.Load() && serviceName == "llm" {
 				statusEvent := map[string]interface{}{
 					"type":      "service.status",
 					"service":   serviceName,
-					"status":    status,
-					"timestamp": time.Now().Unix(),
+					"status":    g.lastKnownLLMStatus.Load(),
+					"timestamp": g.timestamp(),
 				}
-
 				statusBytes, _ := json.Marshal(statusEvent)
-				hub.Broadcast(string(statusBytes))
-			}(service, port)
-		}
+				g.hub.Broadcast(string(statusBytes))
+				return
+			}
+
+			// Check service health
+			online := g.checkServiceHealth(ctx, serviceName)
+			if ctx.Err() != nil {
+				return
+			}
+			status := map[bool]string{true: "online", false: "offline"}[online]
+
+			// Record the status so proxied calls can fail fast
+			g.setServiceStatus(serviceName, status)
+
+			// Store LLM status for preservation during generation
+			if serviceName == "llm" {
+				g.lastKnownLLMStatus.Store(status)
+			}
 
-		time.Sleep(5 * time.Second)
+			// Broadcast status update
+			statusEvent := map[string]interface{}{
+				"type":      "service.status",
+				"service":   serviceName,
+				"status":    status,
+				"timestamp": g.timestamp(),
+			}
+
+			statusBytes, _ := json.Marshal(statusEvent)
+			g.hub.Broadcast(string(statusBytes))
+		})
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
-func checkServiceHealth(client *http.Client, port int, serviceName string) bool {
-	var endpoint string
-	switch serviceName {
-	case "llm", "ego":
-		endpoint = "/health"
-	default:
-		endpoint = "/ping"
-	}
+func (g *Gateway) checkServiceHealth(ctx context.Context, serviceName string) bool {
+	endpoint := healthEndpoint(serviceName)
 
-	resp, err := client.Get(fmt.Sprintf("http://localhost:%d%s", port, endpoint))
+	resp, err := g.get(withForce(ctx), serviceName, g.serviceURL(serviceName, endpoint), 500*time.Millisecond)
 	if err != nil {
 		return false
 	}
@@ -873,15 +1374,15 @@ func checkServiceHealth(client *http.Client, port int, serviceName string) bool
 }
 
 // AI generation control handlers
-func postAIGenerationStart(w http.ResponseWriter, r *http.Request) {
-	isAIGenerating = true
+func (g *Gateway) postAIGenerationStart(w http.ResponseWriter, r *http.Request) {
+	g.isAIGenerating.Store(true)
 	fmt.Println("AI generation started - pausing status checks")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"status": "AI generation started"}`))
 }
 
-func postAIGenerationStop(w http.ResponseWriter, r *http.Request) {
-	isAIGenerating = false
+func (g *Gateway) postAIGenerationStop(w http.ResponseWriter, r *http.Request) {
+	g.isAIGenerating.Store(false)
 	fmt.Println("AI generation stopped - resuming status checks")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"status": "AI generation stopped"}`))
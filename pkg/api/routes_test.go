@@ -0,0 +1,508 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryStreamRelaysLargeBodyPastTimeout(t *testing.T) {
+	g, srv := newTestGateway(t, Config{MemoryTimeout: 100 * time.Millisecond})
+	chunk := strings.Repeat("x", 64<<10)
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("stream") {
+			t.Errorf("stream parameter forwarded to the backend: %s", r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		// Outlast MemoryTimeout, which only bounds the wait for headers
+		// in stream mode
+		time.Sleep(200 * time.Millisecond)
+		for range 64 {
+			w.Write([]byte(chunk))
+		}
+	})
+
+	resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/memory?stream=true", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	if want := 64 * len(chunk); len(body) != want {
+		t.Errorf("relayed %d bytes, want %d", len(body), want)
+	}
+}
+
+func TestMemoryTimeoutBoundsBufferedRelay(t *testing.T) {
+	g, srv := newTestGateway(t, Config{MemoryTimeout: 50 * time.Millisecond})
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+
+	resp, _ := doRequest(t, http.MethodGet, srv.URL+"/api/memory", "")
+	if resp.StatusCode < 500 {
+		t.Errorf("status %d for a backend slower than MemoryTimeout, want a 5xx", resp.StatusCode)
+	}
+}
+
+func TestMemoryPreservesContentEncoding(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	const memories = `[{"id":"m1"}]`
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("Accept-Encoding %q not forwarded", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(memories))
+		zw.Close()
+	})
+
+	for _, query := range []string{"", "?stream=true"} {
+		resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/memory"+query, "", "Accept-Encoding", "gzip")
+		if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("%q: Content-Encoding %q, want gzip", query, got)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatalf("%q: body is not gzip: %v", query, err)
+		}
+		plain, _ := io.ReadAll(zr)
+		if string(plain) != memories {
+			t.Errorf("%q: decompressed body %q, want %q", query, plain, memories)
+		}
+	}
+}
+
+// batchReport is the response of the batch embeddings endpoint.
+type batchReport struct {
+	Total     int                    `json:"total"`
+	Succeeded int                    `json:"succeeded"`
+	Failed    int                    `json:"failed"`
+	Results   []batchEmbeddingResult `json:"results"`
+}
+
+// stubEmbeddingsAdd stubs the embeddings service's add endpoint, recording
+// the IDs it was sent.
+func stubEmbeddingsAdd(t *testing.T, g *Gateway) func() []string {
+	var mu sync.Mutex
+	var ids []string
+	stubService(t, g, serviceEmbeddings, func(w http.ResponseWriter, r *http.Request) {
+		var item batchEmbeddingItem
+		json.NewDecoder(r.Body).Decode(&item)
+		mu.Lock()
+		ids = append(ids, item.ID)
+		mu.Unlock()
+		w.Write([]byte(`{"success":true}`))
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Sorted(slices.Values(ids))
+	}
+}
+
+func TestBatchEmbeddingsAllValid(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	received := stubEmbeddingsAdd(t, g)
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/embeddings/batch", `[
+		{"id":"a","source":"vision","embedding":[0.1,0.2]},
+		{"id":"b","source":"vision","embedding":[0.3,0.4]},
+		{"id":"c","source":"speech","embedding":[0.5,0.6,0.7]}
+	]`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	var report batchReport
+	if err := json.Unmarshal([]byte(body), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 3 || report.Succeeded != 3 || report.Failed != 0 {
+		t.Errorf("report %+v, want 3 of 3 succeeded", report)
+	}
+	if got := received(); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("embeddings service got %v, want [a b c]", got)
+	}
+}
+
+func TestBatchEmbeddingsPartiallyInvalid(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	received := stubEmbeddingsAdd(t, g)
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/embeddings/batch", `[
+		{"id":"ok","source":"vision","embedding":[0.1,0.2]},
+		{"source":"vision","embedding":[0.1,0.2]},
+		{"id":"bad-source","source":"smell","embedding":[0.1,0.2]},
+		{"id":"empty","source":"vision","embedding":[]},
+		{"id":"bad-dim","source":"vision","embedding":[0.1,0.2,0.3]},
+		"not an object"
+	]`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	var report batchReport
+	if err := json.Unmarshal([]byte(body), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 6 || report.Succeeded != 1 || report.Failed != 5 {
+		t.Errorf("report %+v, want 1 of 6 succeeded", report)
+	}
+	wantErrors := []string{"", "missing id", "unknown source", "empty embedding", "does not match", "invalid embedding object"}
+	for i, res := range report.Results {
+		if res.Index != i {
+			t.Errorf("result %d has index %d", i, res.Index)
+		}
+		if want := wantErrors[i]; res.OK != (want == "") || !strings.Contains(res.Error, want) {
+			t.Errorf("result %d = %+v, want error containing %q", i, res, want)
+		}
+	}
+	if got := received(); !slices.Equal(got, []string{"ok"}) {
+		t.Errorf("embeddings service got %v, want only the valid item", got)
+	}
+}
+
+const speechRequest = `{"audio_base64":"UklGRgAAAABXQVZF"}`
+
+func TestSpeechTranscriptReportsWhisperFields(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	stubPipeline(t, g, defaultPipeline())
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/speech/transcript", speechRequest)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	events := recordedEvents(t, g, "speech.transcript")
+	if len(events) != 1 {
+		t.Fatalf("got %d speech.transcript events, want 1", len(events))
+	}
+	ev := events[0]
+	if ev["transcript"] != "hello there" || ev["confidence"] != 0.93 || ev["language"] != "en" {
+		t.Errorf("event %v, want the transcript, confidence and language from whisper", ev)
+	}
+}
+
+func TestSpeechTranscriptOmitsAbsentWhisperFields(t *testing.T) {
+	for name, whisper := range map[string]string{
+		"absent": `{"transcript":"hello there"}`,
+		"zero":   `{"transcript":"hello there","confidence":0,"language":""}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			responses := defaultPipeline()
+			responses["/infer/whisper"] = whisper
+			stubPipeline(t, g, responses)
+
+			if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/speech/transcript", speechRequest); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+			}
+			ev := recordedEvents(t, g, "speech.transcript")[0]
+			confidence, hasConfidence := ev["confidence"]
+			_, hasLanguage := ev["language"]
+			if name == "absent" && (hasConfidence || hasLanguage) {
+				t.Errorf("event %v reports fields whisper did not send", ev)
+			}
+			if name == "zero" && (!hasConfidence || confidence != 0.0 || !hasLanguage) {
+				t.Errorf("event %v drops the zero confidence and empty language whisper sent", ev)
+			}
+		})
+	}
+}
+
+func TestSpeechTranscriptRejectsEmptyTranscript(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	responses := defaultPipeline()
+	responses["/infer/whisper"] = `{"transcript":"  ","confidence":0.2}`
+	calls := stubPipeline(t, g, responses)
+
+	resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/speech/transcript", speechRequest)
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("status %d, want 422", resp.StatusCode)
+	}
+	if events := recordedEvents(t, g, "speech.transcript"); len(events) != 0 {
+		t.Errorf("broadcast %v for an empty transcript", events)
+	}
+	warnings := recordedEvents(t, g, "pipeline.warning")
+	if len(warnings) != 1 || warnings[0]["stage"] != "whisper" {
+		t.Errorf("warnings %v, want one from the whisper stage", warnings)
+	}
+	if runs := calls.get("/run"); len(runs) != 0 {
+		t.Errorf("sentience run called for an empty transcript: %v", runs)
+	}
+}
+
+func TestMemoryEnforcesResponseSizeLimit(t *testing.T) {
+	g, srv := newTestGateway(t, Config{MaxResponseBytes: map[string]int64{"default": 100}})
+	var size atomic.Int64
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strings.Repeat("x", int(size.Load()))))
+	})
+
+	for _, query := range []string{"", "?stream=true"} {
+		size.Store(100)
+		resp, body := doRequest(t, http.MethodGet, srv.URL+"/api/memory"+query, "")
+		if resp.StatusCode != http.StatusOK || len(body) != 100 {
+			t.Errorf("%q: body at the limit gave status %d with %d bytes, want 200 with 100", query, resp.StatusCode, len(body))
+		}
+		size.Store(64 << 10)
+		resp, body = doRequest(t, http.MethodGet, srv.URL+"/api/memory"+query, "")
+		if resp.StatusCode != http.StatusBadGateway {
+			t.Errorf("%q: oversized body gave status %d, want 502", query, resp.StatusCode)
+		}
+		if len(body) >= 64<<10 {
+			t.Errorf("%q: relayed the whole %d-byte oversized body", query, len(body))
+		}
+	}
+}
+
+func TestServiceHealthCheck(t *testing.T) {
+	g, _ := newTestGateway(t, Config{})
+	stubService(t, g, serviceLLM, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"healthy"}`))
+	})
+	stubService(t, g, serviceEgo, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"loading"}`))
+	})
+	if !g.checkServiceHealth(context.Background(), serviceLLM) {
+		t.Error("healthy LLM reported offline")
+	}
+	if g.checkServiceHealth(context.Background(), serviceEgo) {
+		t.Error("ego reporting \"loading\" counted as online")
+	}
+}
+
+func TestServiceHealthCheckReturnsWhenCanceled(t *testing.T) {
+	g, _ := newTestGateway(t, Config{TimeoutMultiplier: 20})
+	stubService(t, g, serviceML, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() { done <- g.checkServiceHealth(ctx, serviceML) }()
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	cancel()
+
+	select {
+	case online := <-done:
+		if online {
+			t.Error("canceled check reported the service online")
+		}
+		if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+			t.Errorf("check returned %s after cancellation", elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("check still running after its context was canceled")
+	}
+}
+
+func TestSentienceResponseIsTypedAndRestamped(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	g, srv := newTestGatewayWith(t, Config{}, func(g *Gateway) { g.SetClock(fixedClock(now)) })
+	responses := defaultPipeline()
+	responses["/run"] = `{"embedding_id":"e1","timestamp":1,"facets":{"vision.object":"person"}}`
+	stubPipeline(t, g, responses)
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", `{"image_base64":"aGVsbG8=","camera_id":"front"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	tokens := recordedEvents(t, g, "sentience.token")
+	if len(tokens) != 1 {
+		t.Fatalf("got %d sentience.token events, want 1", len(tokens))
+	}
+	token := tokens[0]
+	if token["timestamp"] != float64(now.UnixMilli()) || token["camera_id"] != "front" || token["embedding_id"] != "e1" {
+		t.Errorf("token %v, want the backend fields restamped at %d from camera front", token, now.UnixMilli())
+	}
+}
+
+func TestUnusableSentienceResponseBecomesWarning(t *testing.T) {
+	for name, run := range map[string]string{
+		"unknown type": `{"type":"sentience.mystery","embedding_id":"e1"}`,
+		"malformed":    `not json`,
+		"null":         `null`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			responses := defaultPipeline()
+			responses["/run"] = run
+			stubPipeline(t, g, responses)
+
+			doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", `{"image_base64":"aGVsbG8="}`)
+			for _, ev := range recordedEvents(t, g, "") {
+				if ev["type"] == nil || ev["type"] == "sentience.mystery" {
+					t.Errorf("broadcast %v", ev)
+				}
+			}
+			warnings := recordedEvents(t, g, "pipeline.warning")
+			if len(warnings) != 1 || warnings[0]["stage"] != "sentience" {
+				t.Errorf("warnings %v, want one from the sentience stage", warnings)
+			}
+		})
+	}
+}
+
+func TestTokenizeNormalizesFacets(t *testing.T) {
+	for _, tc := range []struct {
+		name, response string
+		facets         map[string]any
+		present        bool
+	}{
+		{"populated", `{"type":"sentience.token","embedding_id":"e1","facets":{"vision.object":"person"}}`, map[string]any{"vision.object": "person"}, true},
+		{"empty", `{"type":"sentience.token","embedding_id":"e1","facets":{}}`, map[string]any{}, true},
+		{"null", `{"type":"sentience.token","embedding_id":"e1","facets":null}`, map[string]any{}, false},
+		{"missing", `{"type":"sentience.token","embedding_id":"e1"}`, map[string]any{}, false},
+		{"not an object", `{"type":"sentience.token","embedding_id":"e1","facets":["person"]}`, map[string]any{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tc.response))
+			})
+
+			if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/sentience/tokenize", `{"embedding_id":"e1"}`); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+			}
+			tokens := recordedEvents(t, g, "sentience.token")
+			if len(tokens) != 1 {
+				t.Fatalf("got %d sentience.token events, want 1", len(tokens))
+			}
+			facets, ok := tokens[0]["facets"].(map[string]any)
+			if !ok || fmt.Sprint(facets) != fmt.Sprint(tc.facets) {
+				t.Errorf("facets %v, want %v", tokens[0]["facets"], tc.facets)
+			}
+			if tokens[0]["facets_present"] != tc.present {
+				t.Errorf("facets_present %v, want %t", tokens[0]["facets_present"], tc.present)
+			}
+		})
+	}
+}
+
+func TestSpeechDeadlineBoundsAllStages(t *testing.T) {
+	g, srv := newTestGateway(t, Config{SpeechTimeout: 200 * time.Millisecond})
+	calls := &backendCalls{bodies: make(map[string][]string)}
+	responses := defaultPipeline()
+	h := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls.add(r.URL.Path, string(body))
+		// A text embedding slow enough to use up the whole budget alone
+		if r.URL.Path == "/infer/text" {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(responses[r.URL.Path]))
+	}
+	stubService(t, g, serviceML, h)
+	stubService(t, g, serviceSentience, h)
+
+	start := time.Now()
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/speech/transcript", speechRequest)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("answered after %s, want the 200ms deadline honored", elapsed)
+	}
+	if resp.StatusCode != http.StatusGatewayTimeout || !strings.Contains(body, `"deadline_exceeded"`) {
+		t.Errorf("status %d %s, want 504 deadline_exceeded", resp.StatusCode, body)
+	}
+	if runs := calls.get("/run"); len(runs) != 0 {
+		t.Errorf("sentience run called %d times after the deadline", len(runs))
+	}
+
+	// The transcript that completed is still delivered, flagged partial
+	transcripts := recordedEvents(t, g, "speech.transcript")
+	if len(transcripts) != 1 || transcripts[0]["partial"] != true || transcripts[0]["transcript"] != "hello there" {
+		t.Errorf("broadcast %v, want the transcript flagged partial", transcripts)
+	}
+	traces := recordedEvents(t, g, "pipeline.trace")
+	if len(traces) != 1 || traces[0]["deadline_exceeded"] != true {
+		t.Errorf("traces %v, want one marked deadline_exceeded", traces)
+	}
+}
+
+// checkTimes runs one status monitor cycle with jitter and returns when each
+// service's health check was dispatched.
+func checkTimes(t *testing.T, jitter time.Duration) []time.Time {
+	t.Helper()
+	var mu sync.Mutex
+	var times []time.Time
+	fake := &fakeClient{respond: func(*http.Request) (*http.Response, error) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		return jsonResponse(http.StatusOK, `{"status":"healthy"}`), nil
+	}}
+	g := NewGateway(Config{StatusCheckJitter: jitter})
+	g.SetClient(fake)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		g.Close(context.Background())
+	})
+	go g.startServiceStatusMonitor(ctx)
+
+	// The next cycle starts only after statusCheckInterval, well past this
+	want := len(serviceNames())
+	deadline := time.Now().Add(jitter + 2*time.Second)
+	for {
+		mu.Lock()
+		n := len(times)
+		mu.Unlock()
+		if n >= want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d health checks dispatched", n, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]time.Time(nil), times...)
+}
+
+// spread is the time between the first and last of times.
+func spread(times []time.Time) time.Duration {
+	first, last := times[0], times[0]
+	for _, at := range times {
+		if at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	return last.Sub(first)
+}
+
+func TestStatusChecksAreStaggeredByJitter(t *testing.T) {
+	if got := spread(checkTimes(t, time.Second)); got < 50*time.Millisecond {
+		t.Errorf("checks dispatched within %s of each other, want them spread over the jitter", got)
+	}
+	if got := spread(checkTimes(t, 0)); got > 200*time.Millisecond {
+		t.Errorf("checks without jitter spread over %s, want them dispatched together", got)
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// sseEventTypes lists the type of every event broadcast on /events, for
+// the generated TypeScript SDK.
+var sseEventTypes = []string{
+	"connection",
+	"ping",
+	"resync_required",
+	"reconnect",
+	"vision.observation",
+	"affect.trend",
+	"speech.transcript",
+	"sentience.token",
+	"pipeline.warning",
+	"pipeline.trace",
+	"pipeline.degraded",
+	"pipeline.recovered",
+	"service.status",
+	"thought.generated",
+	"ego.thought",
+	"ego.thought.failed",
+	"experience.consolidated",
+	"consciousness.delta",
+	"upstream.message",
+}
+
+// getTypeScriptSDK serves TypeScript definitions and a fetch-based client
+// for the gateway, generated from the registered routes so the frontend
+// types cannot drift from the backend.
+func (g *Gateway) getTypeScriptSDK(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/typescript; charset=utf-8")
+	w.Write([]byte(typeScriptSDK()))
+}
+
+func typeScriptSDK() string {
+	var b strings.Builder
+	b.WriteString("// Generated by the gateway from its registered routes. Do not edit.\n\n")
+
+	quoted := make([]string, len(sseEventTypes))
+	for i, eventType := range sseEventTypes {
+		quoted[i] = fmt.Sprintf("%q", eventType)
+	}
+	fmt.Fprintf(&b, "export type EventType =\n  | %s;\n\n", strings.Join(quoted, "\n  | "))
+	fmt.Fprintf(&b, "export const EVENT_SCHEMA_VERSION = %d;\n\n", EventSchemaVersion)
+	b.WriteString(`export interface GatewayEvent {
+  type: EventType;
+  schema_version?: number;
+  timestamp?: number;
+  synthetic?: boolean;
+  [field: string]: unknown;
+}
+
+export interface GatewayClientOptions {
+  baseUrl?: string;
+  headers?: Record<string, string>;
+}
+
+export class GatewayError extends Error {
+  constructor(public readonly status: number, message: string) {
+    super(message);
+  }
+}
+
+export class GatewayClient {
+  private readonly baseUrl: string;
+  private readonly headers: Record<string, string>;
+
+  constructor(options: GatewayClientOptions = {}) {
+    this.baseUrl = (options.baseUrl ?? "").replace(/\/$/, "");
+    this.headers = options.headers ?? {};
+  }
+
+  private async request<T>(method: string, path: string, body?: unknown, query?: Record<string, string>): Promise<T> {
+    const search = query ? "?" + new URLSearchParams(query).toString() : "";
+    const res = await fetch(this.baseUrl + path + search, {
+      method,
+      headers: body === undefined ? this.headers : { "Content-Type": "application/json", ...this.headers },
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (!res.ok) {
+      throw new GatewayError(res.status, await res.text());
+    }
+    return (await res.json()) as T;
+  }
+
+  subscribe(onEvent: (event: GatewayEvent) => void, session?: string): EventSource {
+    const search = session ? "?session=" + encodeURIComponent(session) : "";
+    const source = new EventSource(this.baseUrl + "/events" + search);
+    source.onmessage = (msg) => onEvent(JSON.parse(msg.data) as GatewayEvent);
+    return source;
+  }
+`)
+
+	routeMethodsMu.RLock()
+	patterns := make([]string, 0, len(routeMethods))
+	for pattern := range routeMethods {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		// Events are consumed through subscribe instead
+		if pattern == "/events" || pattern == "/ws" || pattern == "/api/sdk/typescript" {
+			continue
+		}
+		for _, method := range routeMethods[pattern] {
+			if method != http.MethodOptions && method != http.MethodHead {
+				writeTypeScriptMethod(&b, method, pattern)
+			}
+		}
+	}
+	routeMethodsMu.RUnlock()
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// writeTypeScriptMethod writes the client method for one route, named after
+// the HTTP method and path, e.g. postApiVisionFrame. Subtree patterns take
+// the rest of the path as their first argument.
+func writeTypeScriptMethod(b *strings.Builder, method, pattern string) {
+	name := strings.ToLower(method)
+	for _, segment := range strings.FieldsFunc(pattern, func(r rune) bool { return r == '/' || r == '-' }) {
+		name += strings.ToUpper(segment[:1]) + segment[1:]
+	}
+
+	var params []string
+	path := fmt.Sprintf("%q", pattern)
+	if strings.HasSuffix(pattern, "/") {
+		params = append(params, "rest: string")
+		path += " + encodeURIComponent(rest)"
+	}
+	body := "undefined"
+	if method == http.MethodPost || method == http.MethodPut {
+		params = append(params, "body?: unknown")
+		body = "body"
+	}
+	params = append(params, "query?: Record<string, string>")
+
+	fmt.Fprintf(b, "\n  %s<T = unknown>(%s): Promise<T> {\n", name, strings.Join(params, ", "))
+	fmt.Fprintf(b, "    return this.request<T>(%q, %s, %s, query);\n  }\n", method, path, body)
+}
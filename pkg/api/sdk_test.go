@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTypeScriptSDKCoversRoutesAndEvents(t *testing.T) {
+	_, srv := newTestGateway(t, Config{})
+	resp, sdk := doRequest(t, http.MethodGet, srv.URL+"/api/sdk/typescript", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/typescript") {
+		t.Errorf("Content-Type %q, want application/typescript", ct)
+	}
+
+	for _, want := range []string{
+		"export type EventType =",
+		`| "sentience.token"`,
+		`| "pipeline.trace"`,
+		"export interface GatewayEvent {",
+		"export interface GatewayClientOptions {",
+		"export class GatewayClient {",
+		"export const EVENT_SCHEMA_VERSION = 1;",
+		"subscribe(onEvent: (event: GatewayEvent) => void",
+		`postApiVisionFrame<T = unknown>(body?: unknown, query?: Record<string, string>): Promise<T> {`,
+		`return this.request<T>("POST", "/api/vision/frame", body, query);`,
+		`getApiMemory<T = unknown>(query?: Record<string, string>): Promise<T> {`,
+		`postApiEgoClearLtm<T = unknown>(`,
+		`getApiEmbeddingsSource<T = unknown>(rest: string, query?: Record<string, string>): Promise<T> {`,
+		`"/api/embeddings/source/" + encodeURIComponent(rest)`,
+	} {
+		if !strings.Contains(sdk, want) {
+			t.Errorf("SDK is missing %q", want)
+		}
+	}
+	// Streams are reached through subscribe, and the SDK does not describe
+	// itself
+	for _, unwanted := range []string{"getEvents<", "getWs<", "getApiSdkTypescript<", "optionsApi", "headApi"} {
+		if strings.Contains(sdk, unwanted) {
+			t.Errorf("SDK contains %q", unwanted)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"errors"
+	"time"
+)
+
+var errSelfCheckTimeout = errors.New("sse self-check: probe not delivered before the deadline")
+
+// SelfCheck sends a probe through an internal loopback client, taking the
+// same lock, client map and buffered channel as real deliveries, and
+// reports how long it took to arrive. It fails if the probe does not arrive
+// within timeout, such as when the hub is wedged holding its lock.
+func (h *SSEHub) SelfCheck(timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	// A wedged hub would block the loopback indefinitely, so it runs on its
+	// own goroutine and is abandoned when the deadline passes
+	done := make(chan error, 1)
+	go func() { done <- h.loopback(timeout) }()
+
+	select {
+	case err := <-done:
+		return time.Since(start), err
+	case <-time.After(timeout):
+		return time.Since(start), errSelfCheckTimeout
+	}
+}
+
+func (h *SSEHub) loopback(timeout time.Duration) error {
+	id := "selfcheck-" + newClientID()
+	ch := make(chan sseEvent, 1)
+
+	h.mu.Lock()
+	h.clients[id] = sseClient{ch: ch, meta: ClientMeta{ID: id}, drops: &clientDrops{}, internal: true}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, id)
+		h.mu.Unlock()
+	}()
+
+	probe := `{"type":"selfcheck","probe":"` + id + `"}`
+	if !h.SendTo(id, probe) {
+		return errors.New("sse self-check: probe could not be queued")
+	}
+	select {
+	case ev := <-ch:
+		if ev.data != probe {
+			return errors.New("sse self-check: unexpected event delivered to the loopback client")
+		}
+		return nil
+	case <-time.After(timeout):
+		return errSelfCheckTimeout
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSelfCheckDeliversProbe(t *testing.T) {
+	h := NewSSEHub()
+	latency, err := h.SelfCheck(time.Second)
+	if err != nil {
+		t.Fatalf("self-check on a healthy hub: %v", err)
+	}
+	if latency <= 0 || latency >= time.Second {
+		t.Errorf("latency %s, want within the deadline", latency)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.clients) != 0 {
+		t.Errorf("loopback client left registered: %v", h.clients)
+	}
+}
+
+func TestSelfCheckFailsWhenHubIsStalled(t *testing.T) {
+	h := NewSSEHub()
+	// Holding the lock wedges the hub as a stuck broadcast would
+	h.mu.Lock()
+	latency, err := h.SelfCheck(50 * time.Millisecond)
+	h.mu.Unlock()
+
+	if !errors.Is(err, errSelfCheckTimeout) {
+		t.Errorf("self-check on a stalled hub: %v, want %v", err, errSelfCheckTimeout)
+	}
+	if latency > time.Second {
+		t.Errorf("self-check took %s, want it bounded by its deadline", latency)
+	}
+
+	// The abandoned loopback finishes once the hub recovers
+	if _, err := h.SelfCheck(time.Second); err != nil {
+		t.Errorf("self-check after the hub recovered: %v", err)
+	}
+}
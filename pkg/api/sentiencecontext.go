@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// contextEscaper escapes the characters that separate pairs (space),
+// labels from scores (colon) and attributes from their values (equals),
+// plus the escape character itself.
+var contextEscaper = strings.NewReplacer(`\`, `\\`, " ", `\ `, ":", `\:`, "=", `\=`)
+
+// ContextBuilder formats the context string sent with each sentience run,
+// so the vision and speech pipelines share the one format the sentience
+// service reads:
+//
+//	person:0.91 dog:0.05 color=red valence=0.62 arousal=0.40
+//	transcript=hello\ there
+//
+// Items are separated by unescaped spaces. CLIP labels are label:score
+// pairs with two-decimal scores; everything else is a key=value attribute.
+// Spaces, colons, equals signs and backslashes inside a label or value are
+// backslash-escaped, and runs of whitespace, including newlines, collapse
+// to a single space first. Blank values and non-finite numbers are left out
+// rather than sent as placeholders.
+type ContextBuilder struct {
+	// TopK caps the CLIP labels included
+	TopK int
+}
+
+// Vision builds the context for a vision frame from up to TopK of its CLIP
+// labels, fewer when the ML service returned fewer, and its dominant color
+// and affect.
+func (b ContextBuilder) Vision(topK []scoredLabel, color string, valence, arousal float64) string {
+	items := make([]string, 0, min(max(b.TopK, 0), len(topK))+3)
+	labels := 0
+	for _, l := range topK {
+		if labels == b.TopK {
+			break
+		}
+		label := contextValue(l.Label)
+		if label == "" || !finite(l.Score) {
+			continue
+		}
+		items = append(items, fmt.Sprintf("%s:%.2f", label, l.Score))
+		labels++
+	}
+	items = appendAttr(items, "color", contextValue(color))
+	if finite(valence) {
+		items = appendAttr(items, "valence", fmt.Sprintf("%.2f", valence))
+	}
+	if finite(arousal) {
+		items = appendAttr(items, "arousal", fmt.Sprintf("%.2f", arousal))
+	}
+	return strings.Join(items, " ")
+}
+
+// Speech builds the context for a transcript, which is empty when the
+// transcript is blank.
+func (b ContextBuilder) Speech(transcript string) string {
+	return strings.Join(appendAttr(nil, "transcript", contextValue(transcript)), " ")
+}
+
+// contextValue normalizes whitespace in s and escapes it for the context.
+func contextValue(s string) string {
+	return contextEscaper.Replace(strings.Join(strings.Fields(s), " "))
+}
+
+// appendAttr adds key=value to items unless value is empty.
+func appendAttr(items []string, key, value string) []string {
+	if value == "" {
+		return items
+	}
+	return append(items, key+"="+value)
+}
+
+func finite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestContextBuilderVision(t *testing.T) {
+	tests := []struct {
+		name     string
+		topK     []scoredLabel
+		color    string
+		valence  float64
+		arousal  float64
+		expected string
+	}{
+		{
+			name:     "plain labels",
+			topK:     []scoredLabel{{"person", 0.912}, {"dog", 0.05}},
+			color:    "red",
+			valence:  0.615,
+			arousal:  0.4,
+			expected: "person:0.91 dog:0.05 color=red valence=0.61 arousal=0.40",
+		},
+		{
+			name:     "label with spaces",
+			topK:     []scoredLabel{{"traffic  light", 0.7}},
+			color:    "dark\nblue",
+			expected: `traffic\ light:0.70 color=dark\ blue valence=0.00 arousal=0.00`,
+		},
+		{
+			name:     "label with colon, equals and backslash",
+			topK:     []scoredLabel{{`ratio 16:9`, 0.5}, {`a=b\c`, 0.25}},
+			expected: `ratio\ 16\:9:0.50 a\=b\\c:0.25 valence=0.00 arousal=0.00`,
+		},
+		{
+			name:     "unicode label",
+			topK:     []scoredLabel{{"café crème", 0.33}, {"猫", 0.2}},
+			color:    "ámbar",
+			expected: `café\ crème:0.33 猫:0.20 color=ámbar valence=0.00 arousal=0.00`,
+		},
+		{
+			name:     "blank labels and non-finite numbers left out",
+			topK:     []scoredLabel{{"  ", 0.9}, {"cat", math.NaN()}, {"dog", 0.4}},
+			valence:  math.Inf(1),
+			arousal:  0.1,
+			expected: "dog:0.40 arousal=0.10",
+		},
+		{
+			name:     "nothing detected",
+			expected: "valence=0.00 arousal=0.00",
+		},
+		{
+			name:     "capped at TopK",
+			topK:     []scoredLabel{{"a", 0.4}, {"b", 0.3}, {"c", 0.2}, {"d", 0.1}},
+			expected: "a:0.40 b:0.30 c:0.20 valence=0.00 arousal=0.00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ContextBuilder{TopK: 3}.Vision(tt.topK, tt.color, tt.valence, tt.arousal)
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestContextBuilderSpeech(t *testing.T) {
+	b := ContextBuilder{TopK: 3}
+	if got, want := b.Speech(" hello:  there\n"), `transcript=hello\:\ there`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := b.Speech(" \t "); got != "" {
+		t.Errorf("blank transcript gave %q, want an empty context", got)
+	}
+}
+
+func TestSpeechRunCarriesTranscriptContext(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	calls := stubPipeline(t, g, defaultPipeline())
+
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/speech/transcript", speechRequest); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	runs := calls.get("/run")
+	if len(runs) != 1 {
+		t.Fatalf("sentience run called %d times, want 1", len(runs))
+	}
+	var run struct {
+		Context string `json:"context"`
+	}
+	json.Unmarshal([]byte(runs[0]), &run)
+	if want := `transcript=hello\ there`; run.Context != want {
+		t.Errorf("context %q, want %q", run.Context, want)
+	}
+}
+
+func TestTopKContextUsesAvailableLabels(t *testing.T) {
+	fourLabels := `{"topk":[{"label":"person","score":0.6},{"label":"dog","score":0.2},{"label":"cat","score":0.1},{"label":"lamp","score":0.05}],"dominant_color":"red","affect_valence":0.6,"affect_arousal":0.4}`
+	for _, tc := range []struct {
+		name   string
+		topK   int
+		clip   string
+		labels int
+		want   string
+	}{
+		{"more wanted than returned", 5, clipResponse, 2, "person:0.91 dog:0.05 color=red valence=0.60 arousal=0.40"},
+		{"fewer wanted than returned", 2, fourLabels, 4, "person:0.60 dog:0.20 color=red valence=0.60 arousal=0.40"},
+		{"default of three", 0, fourLabels, 4, "person:0.60 dog:0.20 cat:0.10 color=red valence=0.60 arousal=0.40"},
+		{"no labels", 5, `{"topk":[],"dominant_color":"red","affect_valence":0.6,"affect_arousal":0.4}`, 0, "color=red valence=0.60 arousal=0.40"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{TopKContext: tc.topK})
+			responses := defaultPipeline()
+			responses["/infer/clip"] = tc.clip
+			calls := stubPipeline(t, g, responses)
+
+			if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+			}
+			runs := calls.get("/run")
+			if len(runs) != 1 {
+				t.Fatalf("sentience run called %d times, want 1", len(runs))
+			}
+			var run struct {
+				Context string `json:"context"`
+			}
+			json.Unmarshal([]byte(runs[0]), &run)
+			if run.Context != tc.want {
+				t.Errorf("context %q, want %q", run.Context, tc.want)
+			}
+			// The broadcast keeps every label, whatever the context uses
+			if labels := observedLabels(t, g); len(labels) != 1 || len(labels[0]) != tc.labels {
+				t.Errorf("observed %v, want %d labels", labels, tc.labels)
+			}
+		})
+	}
+}
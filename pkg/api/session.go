@@ -0,0 +1,64 @@
+package api
+
+import "time"
+
+// maxSessions bounds how many sessions the hub remembers checkpoints for.
+// The least recently seen session is forgotten to make room.
+const maxSessions = 1024
+
+// sessionMark is the newest event a session's clients were sent. An event
+// written just as the connection dropped may not have arrived, so a
+// checkpoint the client sends itself still takes precedence.
+type sessionMark struct {
+	seq    uint64
+	seenAt time.Time
+}
+
+// rememberSession records that a client of session was sent events up to
+// cp, keeping the higher mark when several clients share the session.
+// h.mu must be held.
+func (h *SSEHub) rememberSession(session string, cp checkpoint) {
+	if session == "" || cp.epoch != h.epoch {
+		return
+	}
+	mark, ok := h.sessions[session]
+	if !ok && len(h.sessions) >= maxSessions {
+		h.forgetOldestSession()
+	}
+	h.sessions[session] = sessionMark{seq: max(mark.seq, cp.seq), seenAt: h.clock.Now()}
+}
+
+// forgetOldestSession drops the least recently seen session. h.mu must be
+// held.
+func (h *SSEHub) forgetOldestSession() {
+	var oldest string
+	var oldestAt time.Time
+	for session, mark := range h.sessions {
+		if oldest == "" || mark.seenAt.Before(oldestAt) {
+			oldest, oldestAt = session, mark.seenAt
+		}
+	}
+	delete(h.sessions, oldest)
+}
+
+// forgetStaleSessions drops the sessions not seen within ttl.
+func (h *SSEHub) forgetStaleSessions(ttl time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cutoff := h.clock.Now().Add(-ttl)
+	for session, mark := range h.sessions {
+		if mark.seenAt.Before(cutoff) {
+			delete(h.sessions, session)
+		}
+	}
+}
+
+// sessionCheckpoint returns where session left off, or nil when the hub
+// has not seen it. h.mu must be held.
+func (h *SSEHub) sessionCheckpoint(session string) *checkpoint {
+	mark, ok := h.sessions[session]
+	if session == "" || !ok {
+		return nil
+	}
+	return &checkpoint{epoch: h.epoch, seq: mark.seq}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// waitDisconnected waits for the hub to unregister every client.
+func waitDisconnected(t *testing.T, hub *SSEHub) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(hub.clientsSnapshot()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("clients still registered after disconnecting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSessionReconnectResumesWithoutDuplicates(t *testing.T) {
+	hub := NewSSEHub()
+	srv := serve(t, hub)
+
+	// Each subtest's stream is closed when the subtest ends
+	t.Run("first connection", func(t *testing.T) {
+		stream := openSSE(t, srv.URL+"?session=kiosk", nil)
+		if ev := stream.expect("connection"); ev["resumed"] != nil {
+			t.Errorf("first connection of a session flagged resumed: %v", ev)
+		}
+		hub.Broadcast(`{"type":"seen","n":1}`)
+		hub.Broadcast(`{"type":"seen","n":2}`)
+		stream.expect("seen")
+		stream.expect("seen")
+	})
+	waitDisconnected(t, hub)
+
+	hub.Broadcast(`{"type":"missed","n":3}`)
+	hub.Broadcast(`{"type":"missed","n":4}`)
+
+	t.Run("reconnect", func(t *testing.T) {
+		stream := openSSE(t, srv.URL+"?session=kiosk", nil)
+		if ev := stream.expect("connection"); ev["resumed"] != true {
+			t.Errorf("reconnect of a known session not flagged resumed: %v", ev)
+		}
+		// Only what the session missed, never what it already saw
+		for n := 3.0; n <= 4; n++ {
+			if ev := stream.expect("missed"); ev["n"] != n {
+				t.Errorf("replayed %v, want missed event %v", ev, n)
+			}
+		}
+		hub.Broadcast(`{"type":"live","n":5}`)
+		stream.expect("live")
+	})
+	waitDisconnected(t, hub)
+
+	t.Run("reconnect again", func(t *testing.T) {
+		stream := openSSE(t, srv.URL+"?session=kiosk", nil)
+		stream.expect("connection")
+		hub.Broadcast(`{"type":"live","n":6}`)
+		if ev := stream.expect("live"); ev["n"] != 6.0 {
+			t.Errorf("got %v, want only the new event 6", ev)
+		}
+	})
+
+	t.Run("other session", func(t *testing.T) {
+		stream := openSSE(t, srv.URL+"?session=phone", nil)
+		if ev := stream.expect("connection"); ev["resumed"] != nil {
+			t.Errorf("unknown session flagged resumed: %v", ev)
+		}
+		hub.Broadcast(`{"type":"live","n":7}`)
+		if ev := stream.expect("live"); ev["n"] != 7.0 {
+			t.Errorf("new session got %v, want only the live event 7", ev)
+		}
+	})
+}
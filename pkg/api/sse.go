@@ -1,85 +1,587 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// sseHeartbeatInterval is how often an idle SSE connection gets a ping.
+const sseHeartbeatInterval = 15 * time.Second
+
+// ClientMeta describes a connected SSE client for targeted broadcasts.
+type ClientMeta struct {
+	// ID is the identifier sent to the client in its connection event.
+	ID string
+
+	// Session is the ?session= value the client connected with, if any.
+	Session string
+
+	// RemoteAddr is the address the client connected from.
+	RemoteAddr string
+
+	// ConnectedSince is when the client connected.
+	ConnectedSince time.Time
+
+	// Fields is the ?fields= projection applied to the client's events.
+	Fields string
+
+	// Cameras is the ?camera= list of cameras the client subscribed to.
+	Cameras string
+}
+
+type sseClient struct {
+	ch    chan sseEvent
+	meta  ClientMeta
+	drops *clientDrops
+
+	// internal marks the self-check's loopback client, which only receives
+	// messages sent to it directly and is not listed
+	internal bool
+}
+
 type SSEHub struct {
-	clients map[chan string]struct{}
+	clients map[string]sseClient
 	mu      sync.Mutex
+
+	// epoch identifies this hub instance in resume tokens, and history
+	// holds the recent broadcasts replayed to reconnecting clients.
+	epoch   string
+	history eventHistory
+
+	// clock stamps client connections and recorded events
+	clock Clock
+
+	// sessions remembers where each ?session= left off, so a reconnect
+	// without a checkpoint resumes instead of starting over
+	sessions map[string]sessionMark
+
+	// While paused, broadcasts are only recorded in the history; pausedAt
+	// is the last event clients were sent before the pause.
+	paused   bool
+	pausedAt uint64
+
+	// historyExclude are the event types broadcast without being recorded
+	historyExclude map[string]bool
+
+	// recorder, when set, appends every recorded broadcast to the event log
+	recorder *eventRecorder
+
+	// webhooks receive the recorded broadcasts matching their types
+	webhooks []*webhook
+
+	// writeTimeout is the deadline for each write to a client; a client that
+	// cannot accept a write in time is disconnected.
+	writeTimeout time.Duration
+
+	// maxLifetime closes each event stream this long after it opened, with
+	// a reconnect event; zero keeps streams open.
+	maxLifetime time.Duration
+
+	// bufferSize is each client's send buffer. Broadcasts to a client whose
+	// buffer is full are dropped, so it trades memory for burst tolerance.
+	bufferSize int
+
+	// broadcastWorkers is the number of goroutines a broadcast fans out
+	// across. With one worker the snapshot is sent to sequentially.
+	broadcastWorkers int
+
+	// wsCompression negotiates permessage-deflate with WebSocket clients
+	// that offer it, and events of at least wsBinaryThreshold bytes are sent
+	// to them as binary msgpack frames
+	wsCompression     bool
+	wsBinaryThreshold int
+
+	// queue, when set, decouples Broadcast from the fan-out
+	queue *broadcastQueue
+
+	// broadcasts counts Broadcast calls and dropped counts the deliveries
+	// skipped because a client's buffer was full.
+	broadcasts atomic.Uint64
+	dropped    atomic.Uint64
 }
 
 func NewSSEHub() *SSEHub {
-	return &SSEHub{clients: make(map[chan string]struct{})}
+	return &SSEHub{
+		clients:          make(map[string]sseClient),
+		epoch:            newClientID(),
+		history:          newEventHistory(256),
+		sessions:         make(map[string]sessionMark),
+		historyExclude:   map[string]bool{"ping": true, "service.status": true},
+		clock:            systemClock{},
+		writeTimeout:     10 * time.Second,
+		bufferSize:       16,
+		broadcastWorkers: 1,
+
+		wsCompression:     true,
+		wsBinaryThreshold: 16 << 10,
+	}
 }
 
-func (h *SSEHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers first
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Cache-Control")
-	w.Header().Set("Access-Control-Max-Age", "86400")
-
-	// Handle preflight requests
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
+// newClientID returns a random identifier assigned to a client for the
+// lifetime of its connection.
+func newClientID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// register adds a client described by meta, assigning its ID. For a client
+// resuming from cp it also returns the events to replay, or the reason a
+// full resync is needed instead. Both are taken under the same lock as
+// broadcasts, so every event is either replayed or delivered live. The
+// returned checkpoint is the point the client's stream starts from. A client
+// without a checkpoint whose session the hub has seen before resumes where
+// the session left off, which is reported as resumed. Failing both, a
+// client asking to catch up is replayed the last catchup events the
+// history retains.
+func (h *SSEHub) register(meta ClientMeta, cp *checkpoint, catchup int) (id string, ch chan sseEvent, replay []sseEvent, resync string, start checkpoint, resumed bool) {
+	ch = make(chan sseEvent, h.bufferSize)
+
+	id = newClientID()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	meta.ID = id
+	h.clients[id] = sseClient{ch: ch, meta: meta, drops: &clientDrops{}}
+
+	start = checkpoint{epoch: h.epoch, seq: h.visible()}
+	if cp == nil {
+		cp = h.sessionCheckpoint(meta.Session)
+		resumed = cp != nil
+	}
+	if cp == nil && catchup > 0 {
+		from := start.seq - min(uint64(catchup), start.seq)
+		cp = &checkpoint{epoch: h.epoch, seq: min(max(from, h.history.oldest()-1), start.seq)}
+	}
+	if cp == nil {
+		return id, ch, nil, "", start, false
 	}
+	replay, resync = h.resumeFrom(*cp)
+	if resync == "" {
+		start.seq = cp.seq
+	}
+	return id, ch, replay, resync, start, resumed && resync == ""
+}
+
+// visible returns the newest event clients may see, which excludes events
+// held back by a pause. h.mu must be held.
+func (h *SSEHub) visible() uint64 {
+	if h.paused {
+		return h.pausedAt
+	}
+	return h.history.last
+}
+
+// Pause stops pushing broadcasts to clients without disconnecting them.
+// Broadcasts keep being recorded in the history and heartbeats continue.
+func (h *SSEHub) Pause() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.paused {
+		h.paused = true
+		h.pausedAt = h.history.last
+	}
+}
+
+// Resume pushes the broadcasts held back since Pause to every client, in
+// order, and returns how many there were. If more were held back than the
+// history retains, clients get a resync_required event instead.
+func (h *SSEHub) Resume() int {
+	h.mu.Lock()
+	if !h.paused {
+		h.mu.Unlock()
+		return 0
+	}
+	held := h.history.since(h.pausedAt)
+	lost := h.pausedAt+1 < h.history.oldest()
+	h.paused = false
+	targets := make([]sseClient, 0, len(h.clients))
+	for _, c := range h.clients {
+		if !c.internal {
+			targets = append(targets, c)
+		}
+	}
+	h.mu.Unlock()
+
+	if lost {
+		resync, _ := json.Marshal(map[string]string{
+			"type":   "resync_required",
+			"reason": "events dropped while broadcasting was paused",
+		})
+		h.dropped.Add(fanOut(targets, sseEvent{data: string(resync)}))
+		return 0
+	}
+	for _, ev := range held {
+		h.dropped.Add(fanOut(targets, ev))
+	}
+	return len(held)
+}
+
+// clientInfo is a connected client as listed by the admin API.
+type clientInfo struct {
+	ID             string    `json:"id"`
+	Session        string    `json:"session,omitempty"`
+	Fields         string    `json:"fields,omitempty"`
+	Cameras        string    `json:"cameras,omitempty"`
+	RemoteAddr     string    `json:"remote_addr"`
+	ConnectedSince time.Time `json:"connected_since"`
+	DroppedCount   uint64    `json:"dropped_count"`
+}
+
+// clientsSnapshot returns the connected clients, longest connected first.
+func (h *SSEHub) clientsSnapshot() []clientInfo {
+	h.mu.Lock()
+	infos := make([]clientInfo, 0, len(h.clients))
+	for _, c := range h.clients {
+		if c.internal {
+			continue
+		}
+		infos = append(infos, clientInfo{
+			ID:             c.meta.ID,
+			Session:        c.meta.Session,
+			Fields:         c.meta.Fields,
+			Cameras:        c.meta.Cameras,
+			RemoteAddr:     c.meta.RemoteAddr,
+			ConnectedSince: c.meta.ConnectedSince,
+			DroppedCount:   c.drops.total.Load(),
+		})
+	}
+	h.mu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ConnectedSince.Before(infos[j].ConnectedSince) })
+	return infos
+}
+
+// unregister removes a client, remembering last as where its session left
+// off. Its channel is left open because a broadcast may still hold it in a
+// snapshot; the buffered sends are simply dropped with the channel once the
+// snapshot is done.
+func (h *SSEHub) unregister(id string, last checkpoint) {
+	h.mu.Lock()
+	if c, ok := h.clients[id]; ok {
+		h.rememberSession(c.meta.Session, last)
+	}
+	delete(h.clients, id)
+	h.mu.Unlock()
+}
+
+func (h *SSEHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// CORS headers and preflight requests are handled by the gateway's CORS
+	// middleware, which reads the configured allow lists.
 
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+	if r.ProtoMajor == 1 {
+		// Connection-specific headers are not allowed over HTTP/2.
+		w.Header().Set("Connection", "keep-alive")
+	}
 
-	flusher, ok := w.(http.Flusher)
-	if !ok {
+	if _, ok := w.(http.Flusher); !ok {
 		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
 		return
 	}
 
-	ch := make(chan string, 16)
+	// A reconnecting client resumes from ?resume=<token> or Last-Event-ID.
+	// A token that cannot be parsed is treated like an uncoverable gap.
+	cp, err := h.requestCheckpoint(r)
+	resyncReason := ""
+	if err != nil {
+		resyncReason = err.Error()
+	}
 
-	h.mu.Lock()
-	h.clients[ch] = struct{}{}
-	h.mu.Unlock()
-	defer func() {
-		h.mu.Lock()
-		delete(h.clients, ch)
-		h.mu.Unlock()
-		close(ch)
-	}()
+	id, ch, replay, resync, last, resumed := h.register(ClientMeta{
+		Session:        r.URL.Query().Get("session"),
+		RemoteAddr:     r.RemoteAddr,
+		ConnectedSince: h.clock.Now().UTC(),
+		Fields:         r.URL.Query().Get("fields"),
+		Cameras:        r.URL.Query().Get("camera"),
+	}, cp, parseCatchup(r))
+	defer func() { h.unregister(id, last) }()
+	if resyncReason == "" {
+		resyncReason = resync
+	}
+
+	// With ?named=true each event also carries an "event:" line set to its
+	// type, so browsers can use addEventListener instead of onmessage.
+	named, _ := strconv.ParseBool(r.URL.Query().Get("named"))
+
+	// With ?fields=type,clip_topk.0.label broadcast events are cut down to
+	// the listed paths for clients short on bandwidth. Control events such
+	// as pings are always sent whole.
+	fields := parseProjection(r.URL.Query().Get("fields"))
+
+	// With ?camera=cam-1,cam-2 events from other cameras are skipped, while
+	// events not tied to a camera still arrive.
+	cameras := parseCameraFilter(r.URL.Query().Get("camera"))
 
-	// Send initial connection message
-	w.Write([]byte("data: {\"type\":\"connection\",\"message\":\"connected\"}\n\n"))
-	flusher.Flush()
+	// With ?synthetic=false events from synthetic traffic are skipped, and
+	// with ?synthetic=only everything else is.
+	synthetic := parseSyntheticFilter(r.URL.Query().Get("synthetic"))
+
+	// The stream outlives the server's read and write timeouts, so they are
+	// lifted; instead every write gets a deadline so a half-open client
+	// whose socket buffer has filled up is disconnected instead of wedging
+	// this goroutine.
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	send := func(ev sseEvent) bool {
+		if ev.broadcast() {
+			if !cameras.allows(ev.data) || !synthetic.allows(ev.data) {
+				last.seq = max(last.seq, ev.id)
+				return true
+			}
+			ev.data = fields.apply(ev.data)
+		}
+		err := rc.SetWriteDeadline(time.Now().Add(h.writeTimeout))
+		if err == nil || errors.Is(err, http.ErrNotSupported) {
+			_, err = w.Write([]byte(formatEvent(ev, named)))
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			log.Printf("sse client %s: write failed, disconnecting: %v", id, err)
+			return false
+		}
+		if ev.id > 0 {
+			last.seq = ev.id
+		}
+		return true
+	}
+
+	// Send initial connection message including the assigned client ID and
+	// a resume token for the point the stream starts from. A resumed session
+	// is flagged so the client can keep the state it already has.
+	connected := map[string]any{
+		"type":           "connection",
+		"message":        "connected",
+		"client_id":      id,
+		"resume_token":   resumeToken(last),
+		"schema_version": EventSchemaVersion,
+	}
+	if resumed {
+		connected["resumed"] = true
+	}
+	connectedBytes, _ := json.Marshal(connected)
+	if !send(sseEvent{data: string(connectedBytes)}) {
+		return
+	}
+
+	if resyncReason != "" {
+		resyncEvent, _ := json.Marshal(map[string]string{
+			"type":         "resync_required",
+			"reason":       resyncReason,
+			"resume_token": resumeToken(last),
+		})
+		if !send(sseEvent{data: string(resyncEvent)}) {
+			return
+		}
+	}
+	for _, ev := range replay {
+		if !send(ev) {
+			return
+		}
+	}
 
 	// Send keep-alive messages and handle client messages
-	ticker := time.NewTicker(15 * time.Second)
+	ticker := time.NewTicker(sseHeartbeatInterval)
 	defer ticker.Stop()
 
+	// Past its maximum lifetime the stream asks the client to reconnect and
+	// closes. The client resumes from the event's token, or from
+	// Last-Event-ID, which browsers send on their own.
+	var expired <-chan time.Time
+	if h.maxLifetime > 0 {
+		lifetime := time.NewTimer(h.maxLifetime)
+		defer lifetime.Stop()
+		expired = lifetime.C
+	}
+
 	for {
 		select {
-		case msg := <-ch:
-			w.Write([]byte("data: " + msg + "\n\n"))
-			flusher.Flush()
+		case ev := <-ch:
+			if !send(ev) {
+				return
+			}
+		case <-expired:
+			reconnect, _ := json.Marshal(map[string]string{
+				"type":         "reconnect",
+				"reason":       "max_lifetime",
+				"resume_token": resumeToken(last),
+			})
+			send(sseEvent{data: string(reconnect)})
+			return
 		case <-ticker.C:
-			w.Write([]byte("data: {\"type\":\"ping\"}\n\n"))
-			flusher.Flush()
+			// Pings carry a fresh resume token so the client can store
+			// its latest checkpoint
+			ping, _ := json.Marshal(map[string]string{
+				"type":         "ping",
+				"resume_token": resumeToken(last),
+			})
+			if !send(sseEvent{data: string(ping)}) {
+				return
+			}
 		case <-r.Context().Done():
 			return
 		}
 	}
 }
 
+// formatEvent frames ev as an SSE event. Broadcast events get an "id:"
+// line. When named is set and the payload has a "type" field, an "event:"
+// line with that type precedes the data.
+func formatEvent(ev sseEvent, named bool) string {
+	var b strings.Builder
+	if ev.id > 0 {
+		b.WriteString("id: " + strconv.FormatUint(ev.id, 10) + "\n")
+	}
+	if named {
+		var event struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal([]byte(ev.data), &event) == nil && validEventName(event.Type) {
+			b.WriteString("event: " + event.Type + "\n")
+		}
+	}
+	b.WriteString("data: " + ev.data + "\n\n")
+	return b.String()
+}
+
+// validEventName reports whether name can be sent on an "event:" line
+// without breaking the stream framing.
+func validEventName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "\r\n")
+}
+
+// Broadcast delivers msg to every connected client and records it in the
+// event history. With a broadcast queue it only queues msg, and the events
+// go out in the order they were queued.
 func (h *SSEHub) Broadcast(msg string) {
+	if h.queue != nil && h.queue.push(msg) {
+		return
+	}
+	h.broadcast(msg, func(ClientMeta) bool { return true }, true)
+}
+
+// BroadcastFunc delivers msg to the connected clients whose metadata
+// satisfies pred. Targeted messages are not kept in the event history,
+// since replaying them could reach clients they were not meant for, and
+// are delivered even while broadcasting is paused.
+func (h *SSEHub) BroadcastFunc(msg string, pred func(ClientMeta) bool) {
+	h.broadcast(msg, pred, false)
+}
+
+// broadcast snapshots the matching clients under the lock and sends outside
+// it, split across the configured workers. Clients whose buffer is full
+// miss the message.
+func (h *SSEHub) broadcast(msg string, pred func(ClientMeta) bool, record bool) {
+	msg = withSchemaVersion(msg)
+	var typ string
+	if record && (len(h.historyExclude) > 0 || len(h.webhooks) > 0) {
+		typ = eventType(msg)
+	}
 	h.mu.Lock()
-	for ch := range h.clients {
+	ev := sseEvent{data: msg}
+	if record {
+		if h.historyExclude[typ] {
+			ev.live = true
+		} else {
+			ev = h.history.add(msg)
+			if h.recorder != nil {
+				h.recorder.record(ev, h.clock.Now())
+			}
+		}
+		if len(h.webhooks) > 0 {
+			for _, wh := range h.webhooks {
+				if wh.matches(typ) {
+					wh.rec.record(ev, h.clock.Now())
+				}
+			}
+		}
+		if h.paused {
+			h.mu.Unlock()
+			h.broadcasts.Add(1)
+			return
+		}
+	}
+	targets := make([]sseClient, 0, len(h.clients))
+	for _, c := range h.clients {
+		if !c.internal && pred(c.meta) {
+			targets = append(targets, c)
+		}
+	}
+	h.mu.Unlock()
+	h.broadcasts.Add(1)
+
+	workers := min(h.broadcastWorkers, len(targets))
+	if workers <= 1 {
+		h.dropped.Add(fanOut(targets, ev))
+		return
+	}
+
+	var wg sync.WaitGroup
+	chunk := (len(targets) + workers - 1) / workers
+	for start := 0; start < len(targets); start += chunk {
+		end := min(start+chunk, len(targets))
+		wg.Add(1)
+		go func(part []sseClient) {
+			defer wg.Done()
+			h.dropped.Add(fanOut(part, ev))
+		}(targets[start:end])
+	}
+	wg.Wait()
+}
+
+// fanOut does a non-blocking send of ev to each client and returns how
+// many sends were dropped. Each drop is also counted against its client.
+func fanOut(targets []sseClient, ev sseEvent) uint64 {
+	var dropped uint64
+	for _, c := range targets {
 		select {
-		case ch <- msg:
+		case c.ch <- ev:
 		default:
+			dropped++
+			noteDrop(c)
 		}
 	}
-	h.mu.Unlock()
+	return dropped
+}
+
+// resetCounters zeroes the broadcast and drop counters, returning their
+// previous values. queueDropped counts the broadcasts lost to a full
+// broadcast queue.
+func (h *SSEHub) resetCounters() (broadcasts, dropped, queueDropped uint64) {
+	if h.queue != nil {
+		queueDropped = h.queue.dropped.Swap(0)
+	}
+	return h.broadcasts.Swap(0), h.dropped.Swap(0), queueDropped
+}
+
+// SendTo delivers msg to a single client. It reports false when the client
+// is not connected or its buffer is full.
+func (h *SSEHub) SendTo(clientID string, msg string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c, ok := h.clients[clientID]
+	if !ok {
+		return false
+	}
+	select {
+	case c.ch <- sseEvent{data: msg}:
+		return true
+	default:
+		return false
+	}
 }
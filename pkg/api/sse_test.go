@@ -0,0 +1,406 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseMessage is one event read off an SSE stream.
+type sseMessage struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// sseStream reads the events of an SSE response as they arrive.
+type sseStream struct {
+	t    *testing.T
+	msgs chan sseMessage
+}
+
+// openSSE connects to an event stream, failing the test unless it answers
+// 200. The connection is closed when the test ends.
+func openSSE(t *testing.T, url string, header http.Header) *sseStream {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		cancel()
+		resp.Body.Close()
+		t.Fatalf("GET %s: status %d, want 200", url, resp.StatusCode)
+	}
+	t.Cleanup(func() {
+		cancel()
+		resp.Body.Close()
+	})
+
+	s := &sseStream{t: t, msgs: make(chan sseMessage, 64)}
+	go func() {
+		defer close(s.msgs)
+		sc := bufio.NewScanner(resp.Body)
+		sc.Buffer(make([]byte, 64<<10), 4<<20)
+		var m sseMessage
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				if m.Data != "" {
+					select {
+					case s.msgs <- m:
+					case <-ctx.Done():
+						return
+					}
+				}
+				m = sseMessage{}
+			case strings.HasPrefix(line, "id: "):
+				m.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				m.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				m.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return s
+}
+
+// nextMessage returns the next event, failing the test if none arrives in
+// time or the stream ends.
+func (s *sseStream) nextMessage() sseMessage {
+	s.t.Helper()
+	select {
+	case m, ok := <-s.msgs:
+		if !ok {
+			s.t.Fatal("event stream closed")
+		}
+		return m
+	case <-time.After(2 * time.Second):
+		s.t.Fatal("timed out waiting for an event")
+	}
+	return sseMessage{}
+}
+
+// next returns the payload of the next event.
+func (s *sseStream) next() map[string]any {
+	s.t.Helper()
+	return decodeEvent(s.t, s.nextMessage().Data)
+}
+
+// expect returns the payload of the next event, failing the test unless it
+// has type typ.
+func (s *sseStream) expect(typ string) map[string]any {
+	s.t.Helper()
+	ev := s.next()
+	if ev["type"] != typ {
+		s.t.Fatalf("got %v event, want %s: %v", ev["type"], typ, ev)
+	}
+	return ev
+}
+
+// closed waits for the server to end the stream, skipping any events still
+// on their way, and fails the test if it does not end in time.
+func (s *sseStream) closed(within time.Duration) {
+	s.t.Helper()
+	deadline := time.After(within)
+	for {
+		select {
+		case _, ok := <-s.msgs:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			s.t.Fatal("event stream still open")
+		}
+	}
+}
+
+// quiet fails the test if an event arrives within d.
+func (s *sseStream) quiet(d time.Duration) {
+	s.t.Helper()
+	select {
+	case m, ok := <-s.msgs:
+		if ok {
+			s.t.Fatalf("got event %s, want none", m.Data)
+		}
+	case <-time.After(d):
+	}
+}
+
+// serve starts a test server for h. It is closed when the test ends, after
+// the streams opened against it, so open streams do not hold it up.
+func serve(t *testing.T, h http.Handler) *httptest.Server {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func decodeEvent(t *testing.T, data string) map[string]any {
+	t.Helper()
+	var ev map[string]any
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		t.Fatalf("event %q is not JSON: %v", data, err)
+	}
+	return ev
+}
+
+func TestSendToReachesOnlyTargetedClient(t *testing.T) {
+	hub := NewSSEHub()
+	srv := serve(t, hub)
+
+	first := openSSE(t, srv.URL, nil)
+	second := openSSE(t, srv.URL, nil)
+	firstID, _ := first.expect("connection")["client_id"].(string)
+	secondID, _ := second.expect("connection")["client_id"].(string)
+	if firstID == "" || secondID == "" || firstID == secondID {
+		t.Fatalf("client IDs %q and %q, want two distinct IDs", firstID, secondID)
+	}
+
+	if !hub.SendTo(firstID, `{"type":"ack"}`) {
+		t.Fatal("SendTo to a connected client reported false")
+	}
+	hub.Broadcast(`{"type":"marker"}`)
+
+	first.expect("ack")
+	first.expect("marker")
+	second.expect("marker")
+
+	if hub.SendTo("no-such-client", `{"type":"ack"}`) {
+		t.Error("SendTo to an unknown client reported true")
+	}
+}
+
+func TestStuckClientIsReapedAfterWriteDeadline(t *testing.T) {
+	g := NewGateway(Config{SSEWriteTimeout: 100 * time.Millisecond})
+	hub := g.Hub()
+	srv := serve(t, hub)
+
+	// A client that sends its request and then never reads, like a
+	// half-open connection, until the socket buffers fill up
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: gateway\r\n\r\n")
+
+	big := fmt.Sprintf(`{"type":"bulk","pad":%q}`, strings.Repeat("x", 1<<20))
+	deadline := time.Now().Add(10 * time.Second)
+	for len(hub.clientsSnapshot()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("client never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for len(hub.clientsSnapshot()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stuck client still registered")
+		}
+		hub.Broadcast(big)
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientBufferOverflowsAtConfiguredSize(t *testing.T) {
+	t.Setenv("SSE_CLIENT_BUFFER", "1")
+	g := NewGateway(LoadConfig())
+	t.Cleanup(func() { g.Close(context.Background()) })
+	hub := g.Hub()
+
+	// A registered client that never drains its channel
+	id, ch, _, _, _, _ := hub.register(ClientMeta{}, nil, 0)
+	defer hub.unregister(id, checkpoint{})
+	if cap(ch) != 1 {
+		t.Fatalf("client buffer holds %d events, want 1", cap(ch))
+	}
+
+	hub.Broadcast(`{"type":"first"}`)
+	if got := hub.dropped.Load(); got != 0 {
+		t.Fatalf("dropped %d events before the buffer filled", got)
+	}
+	hub.Broadcast(`{"type":"second"}`)
+	hub.Broadcast(`{"type":"third"}`)
+	if got := hub.dropped.Load(); got != 2 {
+		t.Errorf("dropped %d events once the buffer was full, want 2", got)
+	}
+	if ev := <-ch; eventType(ev.data) != "first" {
+		t.Errorf("buffered %q, want the first event", ev.data)
+	}
+}
+
+func TestBroadcastWorkersReachEveryClient(t *testing.T) {
+	for _, workers := range []int{1, 4, 64} {
+		hub := NewSSEHub()
+		hub.broadcastWorkers = workers
+		hub.bufferSize = 1
+		var chans []chan sseEvent
+		for range 50 {
+			id, ch, _, _, _, _ := hub.register(ClientMeta{}, nil, 0)
+			defer hub.unregister(id, checkpoint{})
+			chans = append(chans, ch)
+		}
+
+		hub.Broadcast(`{"type":"first"}`)
+		hub.Broadcast(`{"type":"second"}`)
+		for i, ch := range chans {
+			if len(ch) != 1 || eventType((<-ch).data) != "first" {
+				t.Errorf("%d workers: client %d did not get exactly the first event", workers, i)
+			}
+		}
+		// The second broadcast found every buffer full and never blocked
+		if got := hub.dropped.Load(); got != 50 {
+			t.Errorf("%d workers: dropped %d events, want 50", workers, got)
+		}
+	}
+}
+
+func BenchmarkBroadcast(b *testing.B) {
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			hub := NewSSEHub()
+			hub.broadcastWorkers = workers
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			for range 1000 {
+				_, ch, _, _, _, _ := hub.register(ClientMeta{}, nil, 0)
+				go func() {
+					for {
+						select {
+						case <-ch:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}()
+			}
+			for b.Loop() {
+				hub.Broadcast(`{"type":"bench"}`)
+			}
+		})
+	}
+}
+
+func TestNamedEventsCarryTheirType(t *testing.T) {
+	hub := NewSSEHub()
+	srv := serve(t, hub)
+	named := openSSE(t, srv.URL+"?named=true", nil)
+	plain := openSSE(t, srv.URL, nil)
+
+	if m := named.nextMessage(); m.Event != "connection" {
+		t.Errorf("named stream framed the connection event as %q", m.Event)
+	}
+	if m := plain.nextMessage(); m.Event != "" {
+		t.Errorf("default stream sent an event line %q", m.Event)
+	}
+
+	hub.Broadcast(`{"type":"sentience.token","embedding_id":"e1"}`)
+	hub.Broadcast(`{"type":"bad\ntype"}`)
+	hub.Broadcast(`{"untyped":true}`)
+
+	if m := named.nextMessage(); m.Event != "sentience.token" {
+		t.Errorf("named stream framed sentience.token as %q", m.Event)
+	}
+	if m := plain.nextMessage(); m.Event != "" {
+		t.Errorf("default stream sent an event line %q", m.Event)
+	}
+	for _, want := range []string{"bad\ntype", "untyped"} {
+		if m := named.nextMessage(); m.Event != "" {
+			t.Errorf("named stream framed a payload without a usable type (%s) as %q", want, m.Event)
+		}
+	}
+}
+
+func TestFormatEvent(t *testing.T) {
+	ev := sseEvent{id: 7, data: `{"type":"ego.thought"}`}
+	if got, want := formatEvent(ev, true), "id: 7\nevent: ego.thought\ndata: {\"type\":\"ego.thought\"}\n\n"; got != want {
+		t.Errorf("named: got %q, want %q", got, want)
+	}
+	if got, want := formatEvent(ev, false), "id: 7\ndata: {\"type\":\"ego.thought\"}\n\n"; got != want {
+		t.Errorf("unnamed: got %q, want %q", got, want)
+	}
+}
+
+func TestBroadcastFuncDeliversByPredicate(t *testing.T) {
+	hub := NewSSEHub()
+	srv := serve(t, hub)
+	alpha := openSSE(t, srv.URL+"?session=alpha", nil)
+	beta := openSSE(t, srv.URL+"?session=beta&camera=front", nil)
+	anonymous := openSSE(t, srv.URL, nil)
+	alphaID, _ := alpha.expect("connection")["client_id"].(string)
+	beta.expect("connection")
+	anonymous.expect("connection")
+
+	hub.BroadcastFunc(`{"type":"for.alpha"}`, func(m ClientMeta) bool { return m.Session == "alpha" })
+	hub.BroadcastFunc(`{"type":"for.cameras"}`, func(m ClientMeta) bool { return m.Cameras != "" })
+	hub.BroadcastFunc(`{"type":"by.id"}`, func(m ClientMeta) bool { return m.ID == alphaID })
+	hub.BroadcastFunc(`{"type":"for.nobody"}`, func(ClientMeta) bool { return false })
+	hub.Broadcast(`{"type":"for.all"}`)
+
+	alpha.expect("for.alpha")
+	alpha.expect("by.id")
+	alpha.expect("for.all")
+	beta.expect("for.cameras")
+	beta.expect("for.all")
+	anonymous.expect("for.all")
+}
+
+func TestStreamClosedAtMaxLifetime(t *testing.T) {
+	g, srv := newTestGateway(t, Config{SSEMaxLifetime: 300 * time.Millisecond})
+	stream := openSSE(t, srv.URL+"/events", nil)
+	stream.expect("connection")
+	g.hub.Broadcast(`{"type":"before"}`)
+	seen := stream.nextMessage()
+
+	reconnect := stream.expect("reconnect")
+	if reconnect["reason"] != "max_lifetime" || reconnect["resume_token"] == "" {
+		t.Errorf("reconnect event %v, want reason max_lifetime and a resume token", reconnect)
+	}
+	stream.closed(time.Second)
+
+	// Reconnecting from the token or Last-Event-ID picks up where it left off
+	g.hub.Broadcast(`{"type":"after"}`)
+	resumed := openSSE(t, srv.URL+"/events?resume="+reconnect["resume_token"].(string), nil)
+	resumed.expect("connection")
+	resumed.expect("after")
+	header := http.Header{"Last-Event-ID": {seen.ID}}
+	fromID := openSSE(t, srv.URL+"/events", header)
+	fromID.expect("connection")
+	fromID.expect("after")
+}
+
+func TestStreamLifetimeUnlimitedByDefault(t *testing.T) {
+	t.Setenv("SSE_MAX_LIFETIME", "")
+	if got := LoadConfig().SSEMaxLifetime; got != 0 {
+		t.Fatalf("SSEMaxLifetime %v, want unlimited", got)
+	}
+
+	_, srv := newTestGateway(t, Config{})
+	stream := openSSE(t, srv.URL+"/events", nil)
+	stream.expect("connection")
+	select {
+	case m, ok := <-stream.msgs:
+		if !ok {
+			t.Fatal("event stream closed with no max lifetime set")
+		}
+		t.Fatalf("got event %s, want none", m.Data)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
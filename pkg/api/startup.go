@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// startupResult is how one backend answered the startup check.
+type startupResult struct {
+	OK        bool    `json:"ok"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// startupBackends lists the services the startup check probes.
+func startupBackends() []string {
+	backends := slices.DeleteFunc(serviceNames(), func(service string) bool { return service == "gateway" })
+	slices.Sort(backends)
+	return backends
+}
+
+// startupCheck reaches each of services once, up to FanOutConcurrency at a
+// time, within StartupCheckTimeout.
+func (g *Gateway) startupCheck(ctx context.Context, services []string) map[string]startupResult {
+	results := make(map[string]startupResult)
+	var mu sync.Mutex
+	runLimited(services, g.config().FanOutConcurrency, func(service string) {
+		result := startupResult{Critical: slices.Contains(g.config().StartupCritical, service)}
+		start := time.Now()
+		// The status monitor may not have checked the service yet
+		resp, err := g.get(withForce(ctx), service, g.serviceURL(service, healthEndpoint(service)), g.config().StartupCheckTimeout)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				err = fmt.Errorf("status %d", resp.StatusCode)
+			}
+		}
+		result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.OK = true
+		}
+
+		mu.Lock()
+		results[service] = result
+		mu.Unlock()
+	})
+	return results
+}
+
+// logStartupReport logs a startup check as a JSON line.
+func logStartupReport(results map[string]startupResult, waiting []string) {
+	line, _ := json.Marshal(map[string]any{
+		"msg":         "startup check",
+		"services":    results,
+		"ready":       len(waiting) == 0,
+		"waiting_for": waiting,
+	})
+	log.Print(string(line))
+}
+
+// runStartupCheck probes every backend once and logs the report. The
+// gateway is not ready until the critical services have answered, so the
+// ones that did not are retried every StartupCheckInterval until they do
+// or ctx is done.
+func (g *Gateway) runStartupCheck(ctx context.Context) {
+	services := startupBackends()
+	for _, service := range g.config().StartupCritical {
+		if !slices.Contains(services, service) {
+			log.Printf("unknown STARTUP_CRITICAL_SERVICES entry %q, ignoring it", service)
+		}
+	}
+
+	ticker := time.NewTicker(g.config().StartupCheckInterval)
+	defer ticker.Stop()
+	for {
+		results := g.startupCheck(ctx, services)
+		waiting := []string{}
+		for _, service := range services {
+			if result := results[service]; result.Critical && !result.OK {
+				waiting = append(waiting, service)
+			}
+		}
+		logStartupReport(results, waiting)
+		g.setStartupWaiting(waiting)
+		if len(waiting) == 0 {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		services = waiting
+	}
+}
+
+// setStartupWaiting records the critical services the gateway still waits
+// for; none left makes it ready.
+func (g *Gateway) setStartupWaiting(waiting []string) {
+	g.startupMu.Lock()
+	g.startupWaiting = waiting
+	g.startupMu.Unlock()
+	if len(waiting) == 0 {
+		g.ready.Store(true)
+	}
+}
+
+// getReady reports whether the gateway is ready for traffic: always, unless
+// STARTUP_CHECK is on, in which case only once the startup check has run
+// and the critical services have answered.
+func (g *Gateway) getReady(w http.ResponseWriter, r *http.Request) {
+	g.startupMu.Lock()
+	waiting := g.startupWaiting
+	g.startupMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !g.ready.Load() {
+		if waiting == nil {
+			// The first check has not finished yet
+			waiting = append([]string{}, g.config().StartupCritical...)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]any{
+			"ready":       false,
+			"waiting_for": waiting,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"ready": true})
+}
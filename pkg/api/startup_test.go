@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startupGateway returns a gateway with the startup check on and every
+// backend stubbed, answering 200 while its flag in the returned map is set.
+// Its routes are not registered, so the check only runs when a test starts
+// it.
+func startupGateway(t *testing.T, critical []string, down ...string) (*Gateway, map[string]*atomic.Bool) {
+	t.Helper()
+	g := NewGateway(Config{
+		StartupCheck:         true,
+		StartupCheckTimeout:  time.Second,
+		StartupCheckInterval: 20 * time.Millisecond,
+		StartupCritical:      critical,
+	})
+	g.stopMonitor()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		g.Close(ctx)
+	})
+
+	up := make(map[string]*atomic.Bool)
+	for _, service := range startupBackends() {
+		flag := &atomic.Bool{}
+		flag.Store(!slices.Contains(down, service))
+		up[service] = flag
+		stubService(t, g, service, func(w http.ResponseWriter, r *http.Request) {
+			if !flag.Load() {
+				http.Error(w, "down", http.StatusServiceUnavailable)
+			}
+		})
+	}
+	return g, up
+}
+
+type readiness struct {
+	Ready      bool     `json:"ready"`
+	WaitingFor []string `json:"waiting_for"`
+}
+
+func ready(t *testing.T, g *Gateway) (int, readiness) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	g.getReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var out readiness
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	return rec.Code, out
+}
+
+// startupReport decodes the last startup check report in logs.
+func startupReport(t *testing.T, logs *syncBuffer) (report struct {
+	Services   map[string]startupResult `json:"services"`
+	Ready      bool                     `json:"ready"`
+	WaitingFor []string                 `json:"waiting_for"`
+}) {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if _, line, ok := strings.Cut(lines[i], `{"msg":"startup check"`); ok {
+			if err := json.Unmarshal([]byte(`{"msg":"startup check"`+line), &report); err != nil {
+				t.Fatalf("decoding report %q: %v", lines[i], err)
+			}
+			return report
+		}
+	}
+	t.Fatalf("no startup report in %q", logs.String())
+	return report
+}
+
+func TestStartupCheckAllUp(t *testing.T) {
+	logs := captureLog(t)
+	g, _ := startupGateway(t, []string{serviceML, serviceSentience})
+	if code, r := ready(t, g); code != http.StatusServiceUnavailable || r.Ready {
+		t.Fatalf("before the check: status %d %+v, want 503 not ready", code, r)
+	}
+
+	g.runStartupCheck(context.Background())
+
+	report := startupReport(t, logs)
+	if !report.Ready || len(report.WaitingFor) != 0 {
+		t.Errorf("report ready %t waiting for %v, want ready", report.Ready, report.WaitingFor)
+	}
+	if len(report.Services) != len(startupBackends()) {
+		t.Errorf("report covers %d services, want %d", len(report.Services), len(startupBackends()))
+	}
+	for service, result := range report.Services {
+		if !result.OK || result.Error != "" {
+			t.Errorf("%s: %+v, want ok", service, result)
+		}
+		if want := service == serviceML || service == serviceSentience; result.Critical != want {
+			t.Errorf("%s critical %t, want %t", service, result.Critical, want)
+		}
+	}
+	if code, r := ready(t, g); code != http.StatusOK || !r.Ready {
+		t.Errorf("after the check: status %d %+v, want 200 ready", code, r)
+	}
+}
+
+func TestStartupCheckWaitsForCriticalServices(t *testing.T) {
+	logs := captureLog(t)
+	g, up := startupGateway(t, []string{serviceML}, serviceML, serviceLLM)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		g.runStartupCheck(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logs.String(), "startup check") {
+		if time.Now().After(deadline) {
+			t.Fatal("no startup report logged")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	report := startupReport(t, logs)
+	if report.Ready || !reflect.DeepEqual(report.WaitingFor, []string{serviceML}) {
+		t.Errorf("report ready %t waiting for %v, want waiting for ml only", report.Ready, report.WaitingFor)
+	}
+	for service, want := range map[string]bool{serviceML: false, serviceLLM: false, serviceSentience: true} {
+		if got := report.Services[service]; got.OK != want || (got.Error == "") != want {
+			t.Errorf("%s: %+v, want ok %t", service, got, want)
+		}
+	}
+	code, r := ready(t, g)
+	if code != http.StatusServiceUnavailable || !reflect.DeepEqual(r.WaitingFor, []string{serviceML}) {
+		t.Errorf("while ml is down: status %d %+v, want 503 waiting for ml", code, r)
+	}
+
+	// A non-critical service staying down does not hold up readiness
+	up[serviceML].Store(true)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("startup check still retrying after ml came up")
+	}
+	if code, r := ready(t, g); code != http.StatusOK || !r.Ready {
+		t.Errorf("once ml is up: status %d %+v, want 200 ready", code, r)
+	}
+	if report := startupReport(t, logs); !report.Ready || !report.Services[serviceML].OK {
+		t.Errorf("final report %+v, want ready with ml ok", report)
+	}
+}
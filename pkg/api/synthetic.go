@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// syntheticHeader marks a request as test or load-test traffic. It is passed
+// on to every downstream call the request makes, and the events it leads to
+// are tagged "synthetic":true.
+const syntheticHeader = "X-Synthetic"
+
+type syntheticKey struct{}
+
+// withSynthetic marks ctx as belonging to synthetic traffic.
+func withSynthetic(ctx context.Context) context.Context {
+	return context.WithValue(ctx, syntheticKey{}, true)
+}
+
+func isSynthetic(ctx context.Context) bool {
+	synthetic, _ := ctx.Value(syntheticKey{}).(bool)
+	return synthetic
+}
+
+// syntheticRequest reports whether r carries an X-Synthetic header set to a
+// true value.
+func syntheticRequest(r *http.Request) bool {
+	synthetic, _ := strconv.ParseBool(r.Header.Get(syntheticHeader))
+	return synthetic
+}
+
+// tagSynthetic inserts "synthetic":true at the start of a JSON event made
+// while serving synthetic traffic. Other events are returned unchanged.
+func tagSynthetic(ctx context.Context, data string) string {
+	if !isSynthetic(ctx) {
+		return data
+	}
+	return prependField(data, `"synthetic":true`)
+}
+
+// broadcastFrom broadcasts an event made while serving a request with ctx,
+// tagged when the request is synthetic and with the request's correlation.
+func (g *Gateway) broadcastFrom(ctx context.Context, data string) {
+	g.hub.Broadcast(tagSynthetic(ctx, correlationFrom(ctx).tag(data)))
+}
+
+// embeddingsURL returns the URL of path on the embeddings service. Synthetic
+// traffic goes to SyntheticEmbeddingsURL instead when it is set, so load
+// tests do not fill the real embedding store.
+func (g *Gateway) embeddingsURL(ctx context.Context, path string) string {
+	if base := g.config().SyntheticEmbeddingsURL; isSynthetic(ctx) && base != "" {
+		return strings.TrimSuffix(base, "/") + path
+	}
+	return g.serviceURL(serviceEmbeddings, path)
+}
+
+// syntheticFilter decides which events a client gets by their synthetic
+// tag, from the ?synthetic= it connected with: "false" drops synthetic
+// events, "only" keeps nothing else, and anything else lets every event
+// through.
+type syntheticFilter string
+
+func parseSyntheticFilter(spec string) syntheticFilter {
+	if spec == "only" {
+		return "only"
+	}
+	if keep, err := strconv.ParseBool(spec); err == nil && !keep {
+		return "exclude"
+	}
+	return ""
+}
+
+// allows reports whether an event should reach the client.
+func (f syntheticFilter) allows(data string) bool {
+	if f == "" {
+		return true
+	}
+	var ev struct {
+		Synthetic bool `json:"synthetic"`
+	}
+	json.Unmarshal([]byte(data), &ev)
+	if f == "only" {
+		return ev.Synthetic
+	}
+	return !ev.Synthetic
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"io"
+	"maps"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syntheticHeaders stubs the pipeline with defaultPipeline's responses and
+// records the X-Synthetic header of each downstream call, by path.
+func syntheticHeaders(t *testing.T, g *Gateway) func() map[string]string {
+	t.Helper()
+	var mu sync.Mutex
+	headers := make(map[string]string)
+	responses := defaultPipeline()
+	h := func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		mu.Lock()
+		headers[r.URL.Path] = r.Header.Get(syntheticHeader)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(responses[r.URL.Path]))
+	}
+	stubService(t, g, serviceML, h)
+	stubService(t, g, serviceSentience, h)
+	return func() map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := make(map[string]string, len(headers))
+		for path, v := range headers {
+			got[path] = v
+		}
+		return got
+	}
+}
+
+func TestSyntheticTagPropagates(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		header    []string
+		synthetic bool
+	}{
+		{"vision header", "/api/vision/frame", testFrame, []string{syntheticHeader, "true"}, true},
+		{"vision body flag", "/api/vision/frame", `{"image_base64":"aGVsbG8=","synthetic":true}`, nil, true},
+		{"speech header", "/api/speech/transcript", speechRequest, []string{syntheticHeader, "1"}, true},
+		{"speech body flag", "/api/speech/transcript", `{"audio_base64":"UklGRgAAAABXQVZF","synthetic":true}`, nil, true},
+		{"real traffic", "/api/vision/frame", testFrame, nil, false},
+		{"header false", "/api/vision/frame", testFrame, []string{syntheticHeader, "false"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			headers := syntheticHeaders(t, g)
+
+			resp, body := doRequest(t, http.MethodPost, srv.URL+tt.path, tt.body, tt.header...)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+			}
+
+			want := ""
+			if tt.synthetic {
+				want = "true"
+			}
+			calls := headers()
+			if len(calls) < 2 {
+				t.Fatalf("downstream calls %v, want the ML service and the sentience run", calls)
+			}
+			for path, got := range calls {
+				if got != want {
+					t.Errorf("%s called with %s %q, want %q", path, syntheticHeader, got, want)
+				}
+			}
+
+			events := recordedEvents(t, g, "")
+			if len(events) == 0 {
+				t.Fatal("no events broadcast")
+			}
+			types := map[any]bool{}
+			for _, ev := range events {
+				types[ev["type"]] = true
+				if tagged := ev["synthetic"] == true; tagged != tt.synthetic {
+					t.Errorf("%v event tagged synthetic %t, want %t", ev["type"], tagged, tt.synthetic)
+				}
+			}
+			if types["affect.trend"] && tt.synthetic {
+				t.Error("synthetic frame fed the shared affect trend")
+			}
+		})
+	}
+}
+
+func TestSyntheticEmbeddingsUseSeparateStore(t *testing.T) {
+	var mu sync.Mutex
+	stores := map[string]int{}
+	store := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			stores[name]++
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ok":true}`))
+		})
+	}
+	synthetic := serve(t, store("synthetic"))
+	g, srv := newTestGateway(t, Config{SyntheticEmbeddingsURL: synthetic.URL})
+	g.SetServiceURL(serviceEmbeddings, serve(t, store("real")).URL)
+
+	const add = `{"id":"e1","source":"vision","embedding":[0.1,0.2]}`
+	doRequest(t, http.MethodPost, srv.URL+"/api/embeddings/add", add, syntheticHeader, "true")
+	doRequest(t, http.MethodPost, srv.URL+"/api/embeddings/add", add)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if stores["synthetic"] != 1 || stores["real"] != 1 {
+		t.Errorf("store calls %v, want one each", stores)
+	}
+}
+
+func TestStreamFiltersSyntheticEvents(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	all := openSSE(t, srv.URL+"/events", nil)
+	withoutSynthetic := openSSE(t, srv.URL+"/events?synthetic=false", nil)
+	onlySynthetic := openSSE(t, srv.URL+"/events?synthetic=only", nil)
+	for _, s := range []*sseStream{all, withoutSynthetic, onlySynthetic} {
+		s.expect("connection")
+	}
+
+	g.hub.Broadcast(`{"type":"load","synthetic":true}`)
+	g.hub.Broadcast(`{"type":"user"}`)
+
+	all.expect("load")
+	all.expect("user")
+	withoutSynthetic.expect("user")
+	onlySynthetic.expect("load")
+	onlySynthetic.quiet(50 * time.Millisecond)
+}
+
+func TestSyntheticWarningsAreTagged(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    Config
+		responses map[string]string
+		path      string
+		body      string
+	}{
+		{"label allow-list", Config{VisionLabelAllowList: []string{"cat"}}, nil, "/api/vision/frame", testFrame},
+		{"malformed sentience response", Config{}, map[string]string{"/run": "not json"}, "/api/vision/frame", testFrame},
+		{"empty transcript", Config{}, map[string]string{"/infer/whisper": `{"transcript":" "}`}, "/api/speech/transcript", speechRequest},
+		{"max hops", Config{MaxEventHops: 2}, nil, "/api/vision/frame", `{"image_base64":"aGVsbG8=","hops":2}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, tt.config)
+			responses := defaultPipeline()
+			maps.Copy(responses, tt.responses)
+			stubPipeline(t, g, responses)
+			withoutSynthetic := openSSE(t, srv.URL+"/events?synthetic=false", nil)
+			withoutSynthetic.expect("connection")
+
+			doRequest(t, http.MethodPost, srv.URL+tt.path, tt.body, syntheticHeader, "true")
+
+			warnings := recordedEvents(t, g, "pipeline.warning")
+			if len(warnings) != 1 {
+				t.Fatalf("got %d pipeline.warning events, want 1", len(warnings))
+			}
+			if warnings[0]["synthetic"] != true {
+				t.Errorf("warning %v, want it tagged synthetic", warnings[0])
+			}
+			// Nothing the synthetic request caused reaches a client filtering it out
+			withoutSynthetic.quiet(50 * time.Millisecond)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestThought calls the LLM service, retrying connection failures and
+// 5xx responses up to the configured number of attempts.
+func (g *Gateway) requestThought(ctx context.Context, body []byte) (*http.Response, error) {
+	var err error
+	for attempt := 1; attempt <= g.config().LLMAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(time.Duration(attempt-1) * 500 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		var resp *http.Response
+		resp, err = g.post(ctx, serviceLLM, g.serviceURL(serviceLLM, "/generate-thought"), body, 60*time.Second)
+		if err == nil && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = fmt.Errorf("llm service error: status %d", resp.StatusCode)
+		}
+		if ctx.Err() != nil || g.serviceOffline(serviceLLM) {
+			break
+		}
+	}
+	return nil, err
+}
+
+// trackGeneration registers the cancel function of an in-flight thought
+// generation under id. It reports false when id is already in flight.
+func (g *Gateway) trackGeneration(id string, cancel context.CancelFunc) bool {
+	g.genMu.Lock()
+	defer g.genMu.Unlock()
+	if _, ok := g.generations[id]; ok {
+		return false
+	}
+	g.generations[id] = cancel
+	return true
+}
+
+func (g *Gateway) untrackGeneration(id string) {
+	g.genMu.Lock()
+	delete(g.generations, id)
+	g.genMu.Unlock()
+}
+
+// postCancelThought cancels the in-flight generation whose X-Request-ID is
+// given by ?id=, aborting its call to the LLM service.
+func (g *Gateway) postCancelThought(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "bad request: id is required", http.StatusBadRequest)
+		return
+	}
+
+	g.genMu.Lock()
+	cancel, ok := g.generations[id]
+	g.genMu.Unlock()
+	if !ok {
+		http.Error(w, "no generation in flight with this id", http.StatusNotFound)
+		return
+	}
+	cancel()
+	fmt.Printf("Canceled thought generation %s\n", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"canceled": id})
+}
+
+// degradedThought builds a placeholder thought from the request alone. It
+// is deterministic for a given input apart from its timestamp, taken from now.
+func degradedThought(in thoughtRequest, now time.Time) map[string]any {
+	inputBytes, _ := json.Marshal(in)
+	hash := sha256.Sum256(inputBytes)
+
+	var evidence []string
+	for _, ev := range in.RecentEvents {
+		if len(evidence) == 3 {
+			break
+		}
+		if t, ok := ev["type"].(string); ok && t != "" {
+			evidence = append(evidence, t)
+		}
+	}
+
+	tone := "neutral"
+	if valence, ok := in.EmotionalState["valence"]; ok {
+		switch {
+		case valence > 0.6:
+			tone = "positive"
+		case valence < 0.4:
+			tone = "negative"
+		}
+	}
+
+	focus := "nothing in particular"
+	if len(in.AttentionFocus) > 0 {
+		focus = strings.Join(in.AttentionFocus, ", ")
+	}
+
+	content := fmt.Sprintf("Reflection is offline, so this is a quiet observation: %d recent events, attention on %s, a %s mood.",
+		len(in.RecentEvents), focus, tone)
+	if len(evidence) > 0 {
+		content += " Most recently: " + strings.Join(evidence, ", ") + "."
+	}
+
+	return map[string]any{
+		"content":          content,
+		"confidence":       0.1,
+		"evidence":         evidence,
+		"emotional_tone":   tone,
+		"self_reference":   true,
+		"creative_insight": false,
+		"timestamp":        now.Format(time.RFC3339),
+		"context_hash":     hex.EncodeToString(hash[:8]),
+		"degraded":         true,
+	}
+}
+
+// writeDegradedThought answers a generate-thought request with a
+// placeholder thought and broadcasts it as a degraded ego.thought event.
+func (g *Gateway) writeDegradedThought(w http.ResponseWriter, r *http.Request, in thoughtRequest) {
+	thought := degradedThought(in, g.now())
+
+	ev := map[string]any{
+		"type":     "ego.thought",
+		"thought":  thought,
+		"degraded": true,
+	}
+	evBytes, _ := json.Marshal(ev)
+	g.broadcastFrom(r.Context(), string(evBytes))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success":   true,
+		"thought":   thought,
+		"degraded":  true,
+		"timestamp": g.now().Format(time.RFC3339),
+	})
+}
+
+// broadcastThoughtResult broadcasts the outcome of a generate-thought call
+// to the LLM service: an ego.thought event for a successful generation, or
+// an ego.thought.failed event carrying the service's reason so clients are
+// not left waiting. A response without a boolean "success", or claiming
+// success without a thought, counts as failed.
+func (g *Gateway) broadcastThoughtResult(ctx context.Context, out map[string]any) {
+	var ev map[string]any
+	success, ok := out["success"].(bool)
+	thought, hasThought := out["thought"].(map[string]any)
+	switch {
+	case !ok:
+		ev = map[string]any{"type": "ego.thought.failed", "reason": "llm response has no success field"}
+	case !success:
+		ev = map[string]any{"type": "ego.thought.failed", "reason": thoughtFailureReason(out)}
+	case !hasThought:
+		ev = map[string]any{"type": "ego.thought.failed", "reason": "llm response has no thought"}
+	default:
+		ev = map[string]any{"type": "ego.thought", "thought": thought}
+	}
+	evBytes, _ := json.Marshal(ev)
+	g.broadcastFrom(ctx, string(evBytes))
+}
+
+// thoughtFailureReason returns the reason the LLM service gave for a failed
+// generation, from its "error" or "reason" field.
+func thoughtFailureReason(out map[string]any) string {
+	for _, key := range []string{"error", "reason"} {
+		if reason, ok := out[key].(string); ok && strings.TrimSpace(reason) != "" {
+			return reason
+		}
+	}
+	return "unspecified"
+}
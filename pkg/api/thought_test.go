@@ -0,0 +1,226 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const thoughtInput = `{"recent_events":[{"type":"vision.observation"},{"type":"speech.transcript"}],"emotional_state":{"valence":0.8},"attention_focus":["person"]}`
+
+// stubLLMDown stubs an LLM service that fails every call, returning the
+// number of calls it received.
+func stubLLMDown(t *testing.T, g *Gateway) *atomic.Int32 {
+	var calls atomic.Int32
+	stubService(t, g, serviceLLM, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "model not loaded", http.StatusInternalServerError)
+	})
+	return &calls
+}
+
+func TestGenerateThoughtDegradesWhenLLMDown(t *testing.T) {
+	g, srv := newTestGateway(t, Config{DegradedThoughts: true, LLMAttempts: 2})
+	calls := stubLLMDown(t, g)
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/llm/generate-thought", thoughtInput)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("called the LLM %d times, want 2 attempts before degrading", n)
+	}
+	var out struct {
+		Degraded bool           `json:"degraded"`
+		Thought  map[string]any `json:"thought"`
+	}
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Degraded || out.Thought["degraded"] != true {
+		t.Errorf("response %s is not flagged as degraded", body)
+	}
+	content, _ := out.Thought["content"].(string)
+	if out.Thought["emotional_tone"] != "positive" || !strings.Contains(content, "person") || !strings.Contains(content, "vision.observation") {
+		t.Errorf("thought %v does not reflect the input", out.Thought)
+	}
+
+	events := recordedEvents(t, g, "ego.thought")
+	if len(events) != 1 || events[0]["degraded"] != true {
+		t.Errorf("broadcast %v, want one degraded ego.thought", events)
+	}
+
+	// The placeholder is the same for the same input, timestamp aside
+	_, again := doRequest(t, http.MethodPost, srv.URL+"/api/llm/generate-thought", thoughtInput)
+	var second struct {
+		Thought map[string]any `json:"thought"`
+	}
+	json.Unmarshal([]byte(again), &second)
+	if second.Thought["content"] != content || second.Thought["context_hash"] != out.Thought["context_hash"] {
+		t.Errorf("second placeholder %v differs from the first %v", second.Thought, out.Thought)
+	}
+}
+
+func TestGenerateThoughtFailsWhenDegradedModeOff(t *testing.T) {
+	g, srv := newTestGateway(t, Config{LLMAttempts: 1})
+	stubLLMDown(t, g)
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/llm/generate-thought", thoughtInput)
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status %d, want 502: %s", resp.StatusCode, body)
+	}
+	if events := recordedEvents(t, g, "ego.thought"); len(events) != 0 {
+		t.Errorf("broadcast %v without degraded mode", events)
+	}
+}
+
+func TestGenerateThoughtRejectsDeepNesting(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	var calls atomic.Int32
+	stubService(t, g, serviceLLM, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"success":true,"thought":{"content":"hello"}}`))
+	})
+
+	deep := strings.Repeat("[", maxThoughtDepth) + strings.Repeat("]", maxThoughtDepth)
+	payload := `{"recent_events":[{"type":"x","detail":` + deep + `}]}`
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/llm/generate-thought", payload)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "too deep") {
+		t.Errorf("status %d %q for a deeply nested payload, want a 400 saying it nests too deep", resp.StatusCode, body)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("deeply nested payload reached the LLM")
+	}
+
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/llm/generate-thought", thoughtInput); resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d for a normal payload, want 200: %s", resp.StatusCode, body)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("normal payload made %d LLM calls, want 1", n)
+	}
+}
+
+func TestCancelThoughtAbortsLLMCall(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	started := make(chan struct{})
+	aborted := make(chan struct{})
+	stubService(t, g, serviceLLM, func(w http.ResponseWriter, r *http.Request) {
+		// The server notices the gateway hanging up only once the body is read
+		io.ReadAll(r.Body)
+		close(started)
+		select {
+		case <-r.Context().Done():
+			close(aborted)
+		case <-time.After(10 * time.Second):
+		}
+	})
+
+	done := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/llm/generate-thought", strings.NewReader(thoughtInput))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-ID", "gen-1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("generation never reached the LLM")
+	}
+
+	resp, _ := doRequest(t, http.MethodPost, srv.URL+"/api/llm/generate-thought", thoughtInput, "X-Request-ID", "gen-1")
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("second generation with the same ID: status %d, want 409", resp.StatusCode)
+	}
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/llm/generate-thought/cancel?id=gen-1", "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"canceled":"gen-1"`) {
+		t.Fatalf("cancel: status %d %s, want 200 naming the generation", resp.StatusCode, body)
+	}
+
+	select {
+	case <-aborted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("LLM call still running after cancel")
+	}
+	select {
+	case status := <-done:
+		if status != http.StatusConflict {
+			t.Errorf("canceled generation: status %d, want 409", status)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("canceled generation never answered")
+	}
+
+	for _, tc := range []struct {
+		url    string
+		status int
+	}{
+		{"/api/llm/generate-thought/cancel?id=gen-1", http.StatusNotFound},
+		{"/api/llm/generate-thought/cancel", http.StatusBadRequest},
+	} {
+		if resp, _ := doRequest(t, http.MethodPost, srv.URL+tc.url, ""); resp.StatusCode != tc.status {
+			t.Errorf("POST %s: status %d, want %d", tc.url, resp.StatusCode, tc.status)
+		}
+	}
+}
+
+func TestGenerateThoughtBroadcastsOutcome(t *testing.T) {
+	tests := []struct {
+		name   string
+		llm    string
+		typ    string
+		reason string
+	}{
+		{name: "success", llm: `{"success":true,"thought":{"content":"hello"}}`, typ: "ego.thought"},
+		{name: "failed with error", llm: `{"success":false,"error":"context window exceeded"}`, typ: "ego.thought.failed", reason: "context window exceeded"},
+		{name: "failed with reason", llm: `{"success":false,"reason":"rate limited"}`, typ: "ego.thought.failed", reason: "rate limited"},
+		{name: "failed without a reason", llm: `{"success":false,"error":"  "}`, typ: "ego.thought.failed", reason: "unspecified"},
+		{name: "success missing", llm: `{"thought":{"content":"hello"}}`, typ: "ego.thought.failed", reason: "llm response has no success field"},
+		{name: "success not a boolean", llm: `{"success":"yes","thought":{"content":"hello"}}`, typ: "ego.thought.failed", reason: "llm response has no success field"},
+		{name: "success without a thought", llm: `{"success":true}`, typ: "ego.thought.failed", reason: "llm response has no thought"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			stubService(t, g, serviceLLM, func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.llm))
+			})
+
+			// The LLM's answer is still relayed to the caller
+			resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/llm/generate-thought", thoughtInput)
+			if resp.StatusCode != http.StatusOK || body != tt.llm {
+				t.Errorf("status %d %q, want 200 relaying %q", resp.StatusCode, body, tt.llm)
+			}
+
+			thoughts, failures := recordedEvents(t, g, "ego.thought"), recordedEvents(t, g, "ego.thought.failed")
+			if tt.typ == "ego.thought" {
+				if len(thoughts) != 1 || len(failures) != 0 {
+					t.Fatalf("got %d ego.thought and %d ego.thought.failed, want one ego.thought", len(thoughts), len(failures))
+				}
+				if content := thoughts[0]["thought"].(map[string]any)["content"]; content != "hello" {
+					t.Errorf("thought content %v, want hello", content)
+				}
+				return
+			}
+			if len(thoughts) != 0 || len(failures) != 1 {
+				t.Fatalf("got %d ego.thought and %d ego.thought.failed, want one ego.thought.failed", len(thoughts), len(failures))
+			}
+			if failures[0]["reason"] != tt.reason {
+				t.Errorf("reason %v, want %q", failures[0]["reason"], tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider that keeps finished spans in
+// memory, restoring the previous provider when the test ends.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return exporter
+}
+
+func TestVisionFrameTracesDownstreamCalls(t *testing.T) {
+	exporter := recordSpans(t)
+	g, srv := newTestGateway(t, Config{})
+	stubPipeline(t, g, defaultPipeline())
+	var traceparent atomic.Value
+	stubService(t, g, serviceSentience, func(w http.ResponseWriter, r *http.Request) {
+		traceparent.Store(r.Header.Get("traceparent"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(runResponse))
+	})
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", `{"image_base64":"aGVsbG8="}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+
+	// The server span ends once the handler returns, which may be just
+	// after the client has read the response
+	var spans tracetest.SpanStubs
+	server := -1
+	for deadline := time.Now().Add(2 * time.Second); server < 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no server span for the request among %d spans", len(spans))
+		}
+		spans = exporter.GetSpans()
+		server = slices.IndexFunc(spans, func(s tracetest.SpanStub) bool {
+			return s.Name == "POST /api/vision/frame" && s.SpanKind == trace.SpanKindServer
+		})
+	}
+	traceID := spans[server].SpanContext.TraceID()
+
+	var clients []string
+	for _, s := range spans {
+		if s.SpanKind == trace.SpanKindClient && s.SpanContext.TraceID() == traceID {
+			clients = append(clients, s.Name)
+		}
+	}
+	for _, want := range []string{"ml POST /infer/clip", "sentience POST /run"} {
+		if !slices.Contains(clients, want) {
+			t.Errorf("client spans %v, want one named %q", clients, want)
+		}
+	}
+
+	got, _ := traceparent.Load().(string)
+	if !strings.Contains(got, traceID.String()) {
+		t.Errorf("sentience got traceparent %q, want one in trace %s", got, traceID)
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	upstreamMinBackoff = 500 * time.Millisecond
+	upstreamMaxBackoff = 30 * time.Second
+)
+
+// consumeUpstream relays the SSE stream at url into the hub, tagging every
+// event with origin. It reconnects with exponential backoff whenever the
+// stream fails or ends, until ctx is canceled.
+func (g *Gateway) consumeUpstream(ctx context.Context, origin, url string) {
+	backoff := upstreamMinBackoff
+	for {
+		connected, err := g.relayUpstream(ctx, origin, url)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = upstreamMinBackoff
+		}
+		fmt.Printf("Upstream events from %s disconnected (%v), retrying in %s\n", origin, err, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, upstreamMaxBackoff)
+	}
+}
+
+// relayUpstream reads one connection to an upstream SSE stream and
+// broadcasts its events. It reports whether the connection was established.
+func (g *Gateway) relayUpstream(ctx context.Context, origin, url string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var name string
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				g.hub.Broadcast(upstreamEvent(origin, name, strings.Join(data, "\n")))
+			}
+			name, data = "", nil
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, err
+	}
+	return true, fmt.Errorf("stream ended")
+}
+
+// upstreamEvent turns an upstream SSE message into a hub event tagged with
+// its origin. A JSON object without a type takes the SSE event name, and
+// anything else is wrapped as an upstream.message.
+func upstreamEvent(origin, name, data string) string {
+	var ev map[string]any
+	if json.Unmarshal([]byte(data), &ev) != nil || ev == nil {
+		ev = map[string]any{"type": "upstream.message", "data": data}
+	}
+	if _, ok := ev["type"].(string); !ok {
+		ev["type"] = "upstream.message"
+		if name != "" {
+			ev["type"] = name
+		}
+	}
+	ev["origin"] = origin
+
+	evBytes, _ := json.Marshal(ev)
+	return string(evBytes)
+}
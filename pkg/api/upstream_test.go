@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUpstreamEventsAreRelayedAcrossReconnects(t *testing.T) {
+	g, srv := newTestGateway(t, Config{})
+	var connections atomic.Int32
+	upstream := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if connections.Add(1) == 1 {
+			// The first connection drops after two events
+			fmt.Fprint(w, "data: {\"type\":\"ego.reflection\",\"depth\":1}\n\n")
+			fmt.Fprint(w, "event: ego.mood\ndata: {\"mood\":\"calm\"}\n\n")
+			return
+		}
+		fmt.Fprint(w, "data: not json\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+
+	stream := openSSE(t, srv.URL+"/events", nil)
+	stream.expect("connection")
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go g.consumeUpstream(ctx, "ego", upstream.URL)
+
+	reflection := stream.expect("ego.reflection")
+	if reflection["origin"] != "ego" || reflection["depth"] != float64(1) {
+		t.Errorf("relayed %v, want the upstream fields tagged with origin ego", reflection)
+	}
+	if mood := stream.expect("ego.mood"); mood["mood"] != "calm" || mood["origin"] != "ego" {
+		t.Errorf("relayed %v, want the event named by its SSE event line", mood)
+	}
+
+	// After the backoff the consumer reconnects and keeps relaying
+	deadline := time.After(2 * upstreamMinBackoff)
+	select {
+	case m := <-stream.msgs:
+		ev := decodeEvent(t, m.Data)
+		if ev["type"] != "upstream.message" || ev["data"] != "not json" || ev["origin"] != "ego" {
+			t.Errorf("relayed %v, want the non-JSON payload wrapped as upstream.message", ev)
+		}
+	case <-deadline:
+		t.Fatal("consumer did not reconnect after the upstream dropped")
+	}
+	if n := connections.Load(); n != 2 {
+		t.Errorf("upstream saw %d connections, want 2", n)
+	}
+}
+
+func TestUpstreamEvent(t *testing.T) {
+	for _, tc := range []struct {
+		name, event, data, want string
+	}{
+		{"typed", "", `{"type":"ego.thought"}`, `{"origin":"sentience","type":"ego.thought"}`},
+		{"typed ignores name", "other", `{"type":"ego.thought"}`, `{"origin":"sentience","type":"ego.thought"}`},
+		{"untyped takes name", "ego.mood", `{"mood":"calm"}`, `{"mood":"calm","origin":"sentience","type":"ego.mood"}`},
+		{"untyped without name", "", `{"mood":"calm"}`, `{"mood":"calm","origin":"sentience","type":"upstream.message"}`},
+		{"not json", "ego.mood", `hello`, `{"data":"hello","origin":"sentience","type":"upstream.message"}`},
+		{"not an object", "", `[1,2]`, `{"data":"[1,2]","origin":"sentience","type":"upstream.message"}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := upstreamEvent("sentience", tc.event, tc.data); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
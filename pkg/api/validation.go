@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// FieldError is a single validation failure. Path is the dotted path of the
+// offending field, such as "emotional_state.joy".
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every field that failed validation so clients
+// get all of them in one response instead of fixing them one at a time.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Add records a failure for the field at path.
+func (v *ValidationError) Add(path, message string) {
+	v.Fields = append(v.Fields, FieldError{Path: path, Message: message})
+}
+
+// Err returns v as an error, or nil when nothing failed.
+func (v *ValidationError) Err() error {
+	if len(v.Fields) == 0 {
+		return nil
+	}
+	return v
+}
+
+func (v *ValidationError) Error() string {
+	msgs := make([]string, len(v.Fields))
+	for i, f := range v.Fields {
+		msgs[i] = f.Path + ": " + f.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// MarshalJSON encodes v as
+// {"error":{"code":"validation","fields":[{"path":...,"message":...}]}}.
+func (v *ValidationError) MarshalJSON() ([]byte, error) {
+	type body struct {
+		Code   string       `json:"code"`
+		Fields []FieldError `json:"fields"`
+	}
+	return json.Marshal(map[string]body{
+		"error": {Code: "validation", Fields: v.Fields},
+	})
+}
+
+// writeValidationError responds 400 with the machine-readable form of v.
+func writeValidationError(w http.ResponseWriter, v *ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidationErrorShape(t *testing.T) {
+	var v ValidationError
+	if v.Err() != nil {
+		t.Fatal("empty ValidationError is not nil")
+	}
+	v.Add("emotional_state.joy", "must be in [0,1]")
+	v.Add("recent_events.2.type", "is required")
+
+	rec := httptest.NewRecorder()
+	writeValidationError(rec, &v)
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("status %d, Content-Type %q, want a JSON 400", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	want := `{"error":{"code":"validation","fields":[{"path":"emotional_state.joy","message":"must be in [0,1]"},{"path":"recent_events.2.type","message":"is required"}]}}`
+	if got := compactJSON(t, rec.Body.String()); got != want {
+		t.Errorf("body %s, want %s", got, want)
+	}
+	if got := v.Error(); got != "validation failed: emotional_state.joy: must be in [0,1]; recent_events.2.type: is required" {
+		t.Errorf("Error() = %q", got)
+	}
+}
+
+func TestVisionFrameReportsEveryInvalidField(t *testing.T) {
+	_, srv := newTestGateway(t, Config{})
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", `{"hops":-1,"camera_id":"bad camera"}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400: %s", resp.StatusCode, body)
+	}
+	var out struct {
+		Error struct {
+			Code   string       `json:"code"`
+			Fields []FieldError `json:"fields"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range out.Error.Fields {
+		paths = append(paths, f.Path)
+	}
+	if out.Error.Code != "validation" || len(paths) != 3 || paths[0] != "image_base64" || paths[1] != "hops" || paths[2] != "camera_id" {
+		t.Errorf("body %s, want a validation error for image_base64, hops and camera_id", body)
+	}
+}
+
+func TestTokenizeRequiresEmbeddingID(t *testing.T) {
+	_, srv := newTestGateway(t, Config{})
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/sentience/tokenize", `{"clip_topk":[{"label":"cat","score":0.9}]}`)
+	want := `{"error":{"code":"validation","fields":[{"path":"embedding_id","message":"is required"}]}}`
+	if resp.StatusCode != http.StatusBadRequest || compactJSON(t, body) != want {
+		t.Errorf("missing embedding_id gave status %d %s, want 400 %s", resp.StatusCode, body, want)
+	}
+
+	// A body that does not decode is still a plain decode error
+	resp, body = doRequest(t, http.MethodPost, srv.URL+"/api/sentience/tokenize", `{"embedding_id":`)
+	if resp.StatusCode != http.StatusBadRequest || strings.Contains(body, "validation") {
+		t.Errorf("malformed body gave status %d %q, want a 400 decode error", resp.StatusCode, body)
+	}
+}
+
+// compactJSON strips insignificant whitespace from s.
+func compactJSON(t *testing.T, s string) string {
+	t.Helper()
+	var v json.RawMessage
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("%q is not JSON: %v", s, err)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/base64"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type scoredLabel struct {
+	Label string  `json:"label"`
+	Score float64 `json:"score"`
+}
+
+// includeEmbedding reports whether the vision event for a frame posted
+// with r carries the raw CLIP embedding: ?include_embedding= when given,
+// VisionEventEmbedding otherwise. Observations reused for a duplicate frame
+// never do, since only their labels are kept.
+func (g *Gateway) includeEmbedding(r *http.Request) bool {
+	if include, err := strconv.ParseBool(r.URL.Query().Get("include_embedding")); err == nil {
+		return include
+	}
+	return g.config().VisionEventEmbedding
+}
+
+// allowedLabels keeps the labels on the configured allow-list, comparing
+// case-insensitively and preserving order and scores. An empty allow-list
+// keeps every label.
+func (g *Gateway) allowedLabels(topK []scoredLabel) []scoredLabel {
+	if len(g.config().VisionLabelAllowList) == 0 {
+		return topK
+	}
+	kept := make([]scoredLabel, 0, len(topK))
+	for _, l := range topK {
+		for _, allowed := range g.config().VisionLabelAllowList {
+			if strings.EqualFold(strings.TrimSpace(l.Label), allowed) {
+				kept = append(kept, l)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// imageDimensions reads the width and height declared in the header of a
+// base64 image, which may be a data URL, without decoding its pixels. ok
+// is false when the header cannot be read, such as for formats other than
+// JPEG, PNG and GIF.
+func imageDimensions(b64 string) (width, height int, ok bool) {
+	if i := strings.LastIndexByte(b64, ','); i >= 0 {
+		b64 = b64[i+1:]
+	}
+	cfg, _, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(b64)))
+	if err != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
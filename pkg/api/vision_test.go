@@ -0,0 +1,258 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFrame = `{"image_base64":"aGVsbG8="}`
+
+// observedLabels returns the labels of the vision.observation events
+// recorded on g.
+func observedLabels(t *testing.T, g *Gateway) [][]scoredLabel {
+	t.Helper()
+	var labels [][]scoredLabel
+	for _, ev := range recordedEvents(t, g, "vision.observation") {
+		b, _ := json.Marshal(ev["clip_topk"])
+		var topK []scoredLabel
+		json.Unmarshal(b, &topK)
+		labels = append(labels, topK)
+	}
+	return labels
+}
+
+func TestLabelAllowListKeepsListedLabels(t *testing.T) {
+	g, srv := newTestGateway(t, Config{VisionLabelAllowList: []string{"dog", "Person"}})
+	calls := stubPipeline(t, g, defaultPipeline())
+
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	labels := observedLabels(t, g)
+	want := []scoredLabel{{"person", 0.91}, {"dog", 0.05}}
+	if len(labels) != 1 || len(labels[0]) != 2 || labels[0][0] != want[0] || labels[0][1] != want[1] {
+		t.Errorf("observed %v, want %v in order with their scores", labels, want)
+	}
+	if runs := calls.get("/run"); len(runs) != 1 {
+		t.Errorf("sentience run called %d times, want 1", len(runs))
+	}
+}
+
+func TestLabelAllowListFiltersContext(t *testing.T) {
+	g, srv := newTestGateway(t, Config{VisionLabelAllowList: []string{"dog"}})
+	calls := stubPipeline(t, g, defaultPipeline())
+
+	doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame)
+	labels := observedLabels(t, g)
+	if len(labels) != 1 || len(labels[0]) != 1 || labels[0][0] != (scoredLabel{"dog", 0.05}) {
+		t.Errorf("observed %v, want only dog", labels)
+	}
+	runs := calls.get("/run")
+	if len(runs) != 1 {
+		t.Fatalf("sentience run called %d times, want 1", len(runs))
+	}
+	var run struct {
+		Context      string `json:"context"`
+		VisionObject string `json:"vision_object"`
+	}
+	json.Unmarshal([]byte(runs[0]), &run)
+	if run.VisionObject != "dog" || run.Context != "dog:0.05 color=red valence=0.60 arousal=0.40" {
+		t.Errorf("sentience run got object %q and context %q, want only dog", run.VisionObject, run.Context)
+	}
+}
+
+func TestLabelAllowListRemovingAllSkipsRun(t *testing.T) {
+	g, srv := newTestGateway(t, Config{VisionLabelAllowList: []string{"cat"}})
+	calls := stubPipeline(t, g, defaultPipeline())
+
+	if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+	}
+	if runs := calls.get("/run"); len(runs) != 0 {
+		t.Errorf("sentience run called with every label filtered out: %v", runs)
+	}
+	warnings := recordedEvents(t, g, "pipeline.warning")
+	if len(warnings) != 1 || warnings[0]["stage"] != "vision" {
+		t.Errorf("warnings %v, want one from the vision stage", warnings)
+	}
+}
+
+func TestMissingEmbeddingIsFlagged(t *testing.T) {
+	for _, tc := range []struct {
+		name, embedding string
+		missing         bool
+	}{
+		{"empty", `[]`, true},
+		{"all zero", `[0,0,0]`, true},
+		{"absent", `null`, true},
+		{"populated", `[0,0.2,0]`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{})
+			responses := defaultPipeline()
+			responses["/infer/clip"] = `{"topk":[{"label":"person","score":0.91}],"embedding":` + tc.embedding + `,"dominant_color":"red"}`
+			calls := stubPipeline(t, g, responses)
+
+			if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+			}
+			runs := calls.get("/run")
+			if len(runs) != 1 {
+				t.Fatalf("sentience run called %d times, want 1", len(runs))
+			}
+			var run map[string]any
+			json.Unmarshal([]byte(runs[0]), &run)
+			warnings := recordedEvents(t, g, "pipeline.warning")
+
+			if !tc.missing {
+				if run["embedding_missing"] != nil || run["embedding"] == nil || len(warnings) != 0 {
+					t.Errorf("run %v with warnings %v, want the embedding passed on without a warning", run, warnings)
+				}
+				return
+			}
+			if run["embedding_missing"] != true || run["embedding"] != nil {
+				t.Errorf("run %v, want embedding null and embedding_missing set", run)
+			}
+			if len(warnings) != 1 || warnings[0]["stage"] != "vision" {
+				t.Errorf("warnings %v, want one from the vision stage", warnings)
+			}
+		})
+	}
+}
+
+// pngFrame returns a frame carrying a real width x height PNG.
+func pngFrame(t *testing.T, width, height int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return `{"image_base64":"` + base64.StdEncoding.EncodeToString(buf.Bytes()) + `"}`
+}
+
+// gifBomb returns the base64 of a 13-byte GIF whose header declares a
+// width x height image, far larger than the file.
+func gifBomb(width, height uint16) string {
+	b := []byte("GIF89a")
+	b = binary.LittleEndian.AppendUint16(b, width)
+	b = binary.LittleEndian.AppendUint16(b, height)
+	b = append(b, 0, 0, 0)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestVisionFrameRejectsDecompressionBombs(t *testing.T) {
+	bomb := gifBomb(60000, 60000)
+	tests := []struct {
+		name      string
+		maxPixels int
+		frame     string
+		rejected  bool
+	}{
+		{"normal image", 40_000_000, pngFrame(t, 64, 48), false},
+		{"at the limit", 64 * 48, pngFrame(t, 64, 48), false},
+		{"over the limit", 64*48 - 1, pngFrame(t, 64, 48), true},
+		{"huge dimensions", 40_000_000, `{"image_base64":"` + bomb + `"}`, true},
+		{"huge dimensions in a data URL", 40_000_000, `{"image_base64":"data:image/gif;base64,` + bomb + `"}`, true},
+		{"unreadable header", 40_000_000, testFrame, false},
+		{"check disabled", 0, `{"image_base64":"` + bomb + `"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{VisionMaxPixels: tt.maxPixels})
+			calls := stubPipeline(t, g, defaultPipeline())
+
+			resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", tt.frame)
+			if tt.rejected {
+				if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "image_base64") {
+					t.Errorf("status %d %s, want 400 naming image_base64", resp.StatusCode, body)
+				}
+				if n := len(calls.get("/infer/clip")); n != 0 {
+					t.Errorf("ML service called %d times for a rejected frame", n)
+				}
+				return
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("status %d %s, want 200", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestVisionMaxPixelsFromEnv(t *testing.T) {
+	for value, want := range map[string]int{"": 40_000_000, "0": 0, "1000000": 1_000_000, "-1": 40_000_000} {
+		t.Setenv("VISION_MAX_PIXELS", value)
+		if got := NewGateway(LoadConfig()).config().VisionMaxPixels; got != want {
+			t.Errorf("VISION_MAX_PIXELS=%q: VisionMaxPixels %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestVisionEventEmbeddingOptIn(t *testing.T) {
+	tests := []struct {
+		name   string
+		config bool
+		query  string
+		want   bool
+	}{
+		{name: "off by default"},
+		{name: "requested per frame", query: "?include_embedding=true", want: true},
+		{name: "enabled by config", config: true, want: true},
+		{name: "declined per frame", config: true, query: "?include_embedding=false"},
+		{name: "unparsable falls back to config", query: "?include_embedding=maybe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, srv := newTestGateway(t, Config{VisionEventEmbedding: tt.config})
+			calls := stubPipeline(t, g, defaultPipeline())
+
+			if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame"+tt.query, testFrame); resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+			}
+			events := recordedEvents(t, g, "vision.observation")
+			if len(events) != 1 {
+				t.Fatalf("got %d vision.observation events, want 1", len(events))
+			}
+			embedding, ok := events[0]["embedding"]
+			if ok != tt.want {
+				t.Fatalf("embedding in event %v, want %v", ok, tt.want)
+			}
+			if ok && !reflect.DeepEqual(embedding, []any{0.1, 0.2, 0.3}) {
+				t.Errorf("embedding %v, want the one ML returned", embedding)
+			}
+			// Sentience gets the embedding either way
+			if runs := calls.get("/run"); len(runs) != 1 || !strings.Contains(runs[0], "[0.1,0.2,0.3]") {
+				t.Errorf("sentience run %v, want the embedding passed on", runs)
+			}
+		})
+	}
+}
+
+func TestVisionEventEmbeddingLeftOffDuplicates(t *testing.T) {
+	g, srv := newTestGateway(t, Config{VisionEventEmbedding: true, VisionDedupWindow: time.Minute})
+	stubPipeline(t, g, defaultPipeline())
+
+	for range 2 {
+		if resp, body := doRequest(t, http.MethodPost, srv.URL+"/api/vision/frame", testFrame); resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d, want 200: %s", resp.StatusCode, body)
+		}
+	}
+	events := recordedEvents(t, g, "vision.observation")
+	if len(events) != 2 {
+		t.Fatalf("got %d vision.observation events, want 2", len(events))
+	}
+	if _, ok := events[0]["embedding"]; !ok {
+		t.Error("first observation has no embedding")
+	}
+	if _, ok := events[1]["embedding"]; ok {
+		t.Error("reused observation carries an embedding")
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Webhook pushes broadcast events of the listed types to URL. An empty
+// Types list matches every event. With a Secret, each delivery is signed
+// with an HMAC-SHA256 of the body in the X-Signature-256 header.
+type Webhook struct {
+	URL    string   `json:"url"`
+	Types  []string `json:"types"`
+	Secret string   `json:"secret"`
+}
+
+// webhook delivers matching events through an eventRecorder, which gives
+// it the recorder's bounded queue and retry with backoff, so a slow or
+// failing endpoint never blocks the broadcast path.
+type webhook struct {
+	types []string
+	rec   *eventRecorder
+}
+
+func newWebhook(hook Webhook, queueSize int) *webhook {
+	sink := &webhookSink{
+		url:    hook.URL,
+		secret: []byte(hook.Secret),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	return &webhook{types: hook.Types, rec: newEventRecorder("webhook "+hook.URL, sink, queueSize, 0)}
+}
+
+func (wh *webhook) matches(eventType string) bool {
+	return len(wh.types) == 0 || slices.Contains(wh.types, eventType)
+}
+
+// eventType returns the type field of a broadcast event, if it has one.
+func eventType(data string) string {
+	var ev struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal([]byte(data), &ev)
+	return ev.Type
+}
+
+// webhookSink POSTs each line the recorder writes to a webhook URL. Server
+// errors and failed requests are returned so the recorder retries them;
+// a 4xx means the endpoint rejected the event, so it is dropped instead.
+type webhookSink struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func (s *webhookSink) Write(p []byte) (int, error) {
+	body := bytes.TrimSuffix(p, []byte("\n"))
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.secret) > 0 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return 0, fmt.Errorf("webhook %s returned %d", s.url, resp.StatusCode)
+	}
+	if resp.StatusCode >= 400 {
+		log.Printf("webhook %s rejected event with %d, dropping it", s.url, resp.StatusCode)
+	}
+	return len(p), nil
+}
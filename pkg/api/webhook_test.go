@@ -0,0 +1,144 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// delivery is one webhook POST as the endpoint received it.
+type delivery struct {
+	body      string
+	signature string
+}
+
+// event returns the broadcast event a delivery carries.
+func (d delivery) event(t *testing.T) map[string]any {
+	t.Helper()
+	var envelope struct {
+		Event map[string]any `json:"event"`
+		ID    uint64         `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(d.body), &envelope); err != nil || envelope.Event == nil || envelope.ID == 0 {
+		t.Fatalf("delivery %s is not an event envelope", d.body)
+	}
+	return envelope.Event
+}
+
+// webhookEndpoint records the deliveries a stub webhook endpoint accepted.
+// It answers 500 to the first failures requests.
+type webhookEndpoint struct {
+	mu         sync.Mutex
+	deliveries []delivery
+	failures   atomic.Int32
+}
+
+func (e *webhookEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if e.failures.Add(-1) >= 0 {
+		http.Error(w, "try again", http.StatusInternalServerError)
+		return
+	}
+	e.mu.Lock()
+	e.deliveries = append(e.deliveries, delivery{string(body), r.Header.Get("X-Signature-256")})
+	e.mu.Unlock()
+}
+
+// await returns the deliveries once there are n, failing the test if they
+// do not arrive in time.
+func (e *webhookEndpoint) await(t *testing.T, n int) []delivery {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		e.mu.Lock()
+		got := append([]delivery(nil), e.deliveries...)
+		e.mu.Unlock()
+		if len(got) >= n {
+			return got
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("webhook received %d deliveries, want %d", len(got), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookReceivesSignedMatchingEvents(t *testing.T) {
+	endpoint := &webhookEndpoint{}
+	hook := serve(t, endpoint)
+	g, _ := newTestGateway(t, Config{Webhooks: []Webhook{{URL: hook.URL, Types: []string{"sentience.token"}, Secret: "s3cret"}}})
+
+	g.Hub().Broadcast(`{"type":"vision.observation","embedding_id":"e1"}`)
+	g.Hub().Broadcast(`{"type":"sentience.token","embedding_id":"e1"}`)
+	g.Hub().Broadcast(`{"type":"speech.transcript","embedding_id":"e2"}`)
+	g.Hub().Broadcast(`{"type":"sentience.token","embedding_id":"e2"}`)
+
+	deliveries := endpoint.await(t, 2)
+	// Give skipped events time to show up if they were going to
+	time.Sleep(100 * time.Millisecond)
+	deliveries = endpoint.await(t, 2)
+	if len(deliveries) != 2 {
+		t.Fatalf("webhook received %d deliveries, want only the 2 sentience tokens", len(deliveries))
+	}
+	for i, want := range []string{"e1", "e2"} {
+		d := deliveries[i]
+		ev := d.event(t)
+		if ev["type"] != "sentience.token" || ev["embedding_id"] != want {
+			t.Errorf("delivery %d is %s, want the sentience.token for %s", i, d.body, want)
+		}
+		if d.signature != sign("s3cret", d.body) {
+			t.Errorf("delivery %d signed %q, want the HMAC of its body", i, d.signature)
+		}
+	}
+}
+
+func TestWebhookRetriesServerErrors(t *testing.T) {
+	endpoint := &webhookEndpoint{}
+	endpoint.failures.Store(2)
+	hook := serve(t, endpoint)
+	g, _ := newTestGateway(t, Config{Webhooks: []Webhook{{URL: hook.URL}}})
+
+	g.Hub().Broadcast(`{"type":"ego.thought"}`)
+	deliveries := endpoint.await(t, 1)
+	if ev := deliveries[0].event(t); ev["type"] != "ego.thought" {
+		t.Errorf("delivered %s, want the ego.thought after two failures", deliveries[0].body)
+	}
+	if deliveries[0].signature != "" {
+		t.Errorf("unsigned webhook sent signature %q", deliveries[0].signature)
+	}
+}
+
+func TestSlowWebhookDoesNotBlockBroadcast(t *testing.T) {
+	release := make(chan struct{})
+	hook := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	g, _ := newTestGateway(t, Config{Webhooks: []Webhook{{URL: hook.URL}}, WebhookQueue: 4})
+	// Cleanups run last first, so the endpoint lets go before the gateway
+	// closes and waits on the delivery in flight
+	t.Cleanup(func() { close(release) })
+
+	start := time.Now()
+	for range 50 {
+		g.Hub().Broadcast(`{"type":"tick"}`)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("50 broadcasts took %s behind a stuck webhook", elapsed)
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// wsFrame encodes an event for a WebSocket client. Events of at least
+// binaryThreshold bytes, such as ones carrying embeddings, go out as a
+// binary msgpack frame; smaller ones, and anything that is not JSON, stay
+// text JSON. A threshold of zero sends everything as text.
+func wsFrame(data string, binaryThreshold int) (websocket.MessageType, []byte) {
+	if binaryThreshold <= 0 || len(data) < binaryThreshold {
+		return websocket.MessageText, []byte(data)
+	}
+	var v any
+	if json.Unmarshal([]byte(data), &v) != nil {
+		return websocket.MessageText, []byte(data)
+	}
+	// JSON numbers decode as floats, so whole ones such as seq are packed
+	// back as integers
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	if enc.Encode(v) != nil {
+		return websocket.MessageText, []byte(data)
+	}
+	return websocket.MessageBinary, buf.Bytes()
+}
+
+// ServeWS streams the same events as ServeHTTP over a WebSocket, for
+// clients that cannot use SSE or want smaller frames. permessage-deflate is
+// negotiated when the client offers it and compression is enabled. Query
+// parameters and resuming work as for /events; messages from the client
+// are ignored.
+func (h *SSEHub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	// The server's read and write deadlines stay on the connection after
+	// the upgrade and would cut the stream short, so they are lifted; each
+	// write gets its own timeout instead
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	mode := websocket.CompressionDisabled
+	if h.wsCompression {
+		mode = websocket.CompressionContextTakeover
+	}
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		// Like /events, the stream is open to any origin; the CORS
+		// middleware allows every origin as well
+		InsecureSkipVerify: true,
+		CompressionMode:    mode,
+	})
+	if err != nil {
+		// Accept has already written the error response
+		return
+	}
+	defer conn.CloseNow()
+
+	cp, err := h.requestCheckpoint(r)
+	resyncReason := ""
+	if err != nil {
+		resyncReason = err.Error()
+	}
+
+	id, ch, replay, resync, last, resumed := h.register(ClientMeta{
+		Session:        r.URL.Query().Get("session"),
+		RemoteAddr:     r.RemoteAddr,
+		ConnectedSince: h.clock.Now().UTC(),
+		Fields:         r.URL.Query().Get("fields"),
+		Cameras:        r.URL.Query().Get("camera"),
+	}, cp, parseCatchup(r))
+	defer func() { h.unregister(id, last) }()
+	if resyncReason == "" {
+		resyncReason = resync
+	}
+
+	fields := parseProjection(r.URL.Query().Get("fields"))
+	cameras := parseCameraFilter(r.URL.Query().Get("camera"))
+	synthetic := parseSyntheticFilter(r.URL.Query().Get("synthetic"))
+
+	// Reading in the background answers pings and notices the client
+	// closing the connection, which cancels ctx
+	ctx := conn.CloseRead(r.Context())
+
+	send := func(ev sseEvent) bool {
+		if ev.broadcast() {
+			if !cameras.allows(ev.data) || !synthetic.allows(ev.data) {
+				last.seq = max(last.seq, ev.id)
+				return true
+			}
+			ev.data = fields.apply(ev.data)
+		}
+		typ, msg := wsFrame(ev.data, h.wsBinaryThreshold)
+		writeCtx, cancel := context.WithTimeout(ctx, h.writeTimeout)
+		err := conn.Write(writeCtx, typ, msg)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("ws client %s: write failed, disconnecting: %v", id, err)
+			}
+			return false
+		}
+		if ev.id > 0 {
+			last.seq = ev.id
+		}
+		return true
+	}
+
+	connected := map[string]any{
+		"type":           "connection",
+		"message":        "connected",
+		"client_id":      id,
+		"resume_token":   resumeToken(last),
+		"schema_version": EventSchemaVersion,
+	}
+	if resumed {
+		connected["resumed"] = true
+	}
+	connectedBytes, _ := json.Marshal(connected)
+	if !send(sseEvent{data: string(connectedBytes)}) {
+		return
+	}
+
+	if resyncReason != "" {
+		resyncEvent, _ := json.Marshal(map[string]string{
+			"type":         "resync_required",
+			"reason":       resyncReason,
+			"resume_token": resumeToken(last),
+		})
+		if !send(sseEvent{data: string(resyncEvent)}) {
+			return
+		}
+	}
+	for _, ev := range replay {
+		if !send(ev) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(sseHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev := <-ch:
+			if !send(ev) {
+				return
+			}
+		case <-ticker.C:
+			ping, _ := json.Marshal(map[string]string{
+				"type":         "ping",
+				"resume_token": resumeToken(last),
+			})
+			if !send(sseEvent{data: string(ping)}) {
+				return
+			}
+		case <-ctx.Done():
+			conn.Close(websocket.StatusNormalClosure, "")
+			return
+		}
+	}
+}
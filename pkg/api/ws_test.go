@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// dialWS connects to srv's /ws, offering permessage-deflate when compress
+// is set, and returns the connection with its handshake response.
+func dialWS(t *testing.T, srvURL string, compress bool) (*websocket.Conn, *http.Response) {
+	t.Helper()
+	mode := websocket.CompressionDisabled
+	if compress {
+		mode = websocket.CompressionContextTakeover
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, resp, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srvURL, "http")+"/ws", &websocket.DialOptions{CompressionMode: mode})
+	if err != nil {
+		t.Fatalf("dial /ws: %v", err)
+	}
+	conn.SetReadLimit(1 << 20)
+	t.Cleanup(func() { conn.CloseNow() })
+	return conn, resp
+}
+
+// readWS reads messages from conn until one whose type is typ, decoding
+// binary frames as msgpack and text frames as JSON.
+func readWS(t *testing.T, conn *websocket.Conn, typ string) (websocket.MessageType, map[string]any) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for {
+		kind, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", typ, err)
+		}
+		var ev map[string]any
+		if kind == websocket.MessageBinary {
+			err = msgpack.Unmarshal(data, &ev)
+		} else {
+			err = json.Unmarshal(data, &ev)
+		}
+		if err != nil {
+			t.Fatalf("decoding %v frame %q: %v", kind, data, err)
+		}
+		if ev["type"] == typ {
+			return kind, ev
+		}
+	}
+}
+
+func TestWSFrame(t *testing.T) {
+	large := `{"type":"vision.observation","embedding":[` + strings.Repeat("0.25,", 63) + `0.25]}`
+	tests := []struct {
+		name      string
+		data      string
+		threshold int
+		want      websocket.MessageType
+	}{
+		{"small", `{"type":"ping"}`, 64, websocket.MessageText},
+		{"large", large, 64, websocket.MessageBinary},
+		{"threshold off", large, 0, websocket.MessageText},
+		{"not JSON", strings.Repeat("x", 100), 64, websocket.MessageText},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typ, msg := wsFrame(tt.data, tt.threshold)
+			if typ != tt.want {
+				t.Fatalf("frame type %v, want %v", typ, tt.want)
+			}
+			if typ == websocket.MessageText && string(msg) != tt.data {
+				t.Errorf("text frame %q, want the event unchanged", msg)
+			}
+		})
+	}
+}
+
+func TestWSNegotiatesCompressionAndSendsLargeEventsAsBinary(t *testing.T) {
+	g, srv := newTestGateway(t, Config{WSCompression: true, WSBinaryThreshold: 1024})
+	conn, resp := dialWS(t, srv.URL, true)
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Fatalf("Sec-WebSocket-Extensions %q, want permessage-deflate negotiated", ext)
+	}
+	if kind, _ := readWS(t, conn, "connection"); kind != websocket.MessageText {
+		t.Errorf("connection event sent as %v, want text", kind)
+	}
+
+	embedding := make([]float64, 512)
+	for i := range embedding {
+		embedding[i] = float64(i) / 512
+	}
+	large, _ := json.Marshal(map[string]any{"type": "vision.observation", "embedding": embedding})
+	g.hub.Broadcast(string(large))
+	g.hub.Broadcast(`{"type":"small.event","ok":true}`)
+
+	kind, ev := readWS(t, conn, "vision.observation")
+	if kind != websocket.MessageBinary {
+		t.Fatalf("large event sent as %v, want binary", kind)
+	}
+	got := make([]float64, 0, len(embedding))
+	for _, v := range ev["embedding"].([]any) {
+		got = append(got, toFloat(t, v))
+	}
+	if !reflect.DeepEqual(got, embedding) {
+		t.Errorf("decoded embedding differs from the one broadcast")
+	}
+	if _, ok := ev["seq"]; !ok {
+		t.Errorf("binary event %v lacks its seq", ev["type"])
+	}
+
+	if kind, ev := readWS(t, conn, "small.event"); kind != websocket.MessageText || ev["ok"] != true {
+		t.Errorf("small event sent as %v %v, want text JSON", kind, ev)
+	}
+}
+
+func TestWSCompressionDisabled(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		server, client bool
+	}{
+		{"by the server", false, true},
+		{"by the client", true, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, srv := newTestGateway(t, Config{WSCompression: tt.server})
+			conn, resp := dialWS(t, srv.URL, tt.client)
+			if ext := resp.Header.Get("Sec-WebSocket-Extensions"); ext != "" {
+				t.Errorf("Sec-WebSocket-Extensions %q, want no compression", ext)
+			}
+			readWS(t, conn, "connection")
+		})
+	}
+}
+
+// toFloat converts a number decoded from msgpack, which packs whole
+// numbers as integers, to a float64.
+func toFloat(t *testing.T, v any) float64 {
+	t.Helper()
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int8:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint8:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	}
+	t.Fatalf("%v (%T) is not a number", v, v)
+	return 0
+}